@@ -0,0 +1,253 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Entry is one line of the audit log.
+type Entry struct {
+	Seq      int64     `json:"seq"`
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Domain   string    `json:"domain,omitempty"`
+	Username string    `json:"username,omitempty"`
+	Command  string    `json:"command"`
+	PID      int       `json:"pid"`
+	PPID     int       `json:"ppid"`
+	Parent   string    `json:"parent,omitempty"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+	// MAC chains this entry to the previous one:
+	// HMAC-SHA256(key, previous MAC || entry JSON without MAC).
+	MAC string `json:"mac"`
+}
+
+// Head is the sequence number and MAC of the newest entry. It is kept
+// outside the log file so that removing entries from the end is detected.
+type Head struct {
+	Seq int64  `json:"seq"`
+	MAC string `json:"mac"`
+}
+
+// HeadStore persists the log head somewhere an attacker who can edit the
+// log file cannot, such as the keychain.
+type HeadStore interface {
+	LoadHead() (*Head, error)
+	SaveHead(*Head) error
+}
+
+// Logger appends entries to an audit log file.
+type Logger struct {
+	Path  string
+	Key   []byte
+	Heads HeadStore
+}
+
+// DefaultPath returns the audit log location in the user config directory.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find config directory: %v", err)
+	}
+	return filepath.Join(dir, "passkc", "audit.log"), nil
+}
+
+// Append completes e with its sequence number, time, process details and
+// MAC, and appends it to the log.
+func (l *Logger) Append(e Entry) error {
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0o700); err != nil {
+		return fmt.Errorf("cannot create audit log directory: %v", err)
+	}
+	f, err := os.OpenFile(l.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("cannot open audit log: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	// Serialize concurrent passkc processes so the chain does not fork
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("cannot lock audit log: %v", err)
+	}
+	defer func() { _ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN) }()
+
+	prev, err := lastEntry(f)
+	if err != nil {
+		return err
+	}
+
+	e.Seq = 1
+	prevMAC := ""
+	if prev != nil {
+		e.Seq = prev.Seq + 1
+		prevMAC = prev.MAC
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.PID == 0 {
+		e.PID = os.Getpid()
+		e.PPID = os.Getppid()
+		e.Parent = processName(e.PPID)
+	}
+	if e.MAC, err = computeMAC(l.Key, prevMAC, e); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("cannot write audit log: %v", err)
+	}
+
+	if l.Heads != nil {
+		return l.Heads.SaveHead(&Head{Seq: e.Seq, MAC: e.MAC})
+	}
+	return nil
+}
+
+func computeMAC(key []byte, prevMAC string, e Entry) (string, error) {
+	e.MAC = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(prevMAC))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// lastEntry returns the final entry of the log, or nil if it is empty.
+func lastEntry(f *os.File) (*Entry, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, nil
+	}
+
+	// Entries are short, so the last one is within the final few KB
+	const tail = 16 << 10
+	offset := size - tail
+	if offset < 0 {
+		offset = 0
+	}
+	buf := make([]byte, size-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("cannot read audit log: %v", err)
+	}
+
+	buf = bytes.TrimRight(buf, "\n")
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		buf = buf[i+1:]
+	}
+	var e Entry
+	if err := json.Unmarshal(buf, &e); err != nil {
+		return nil, fmt.Errorf("audit log is corrupt at its last line; run 'passkc log verify'")
+	}
+	return &e, nil
+}
+
+// Read returns all entries in the log. A missing log has no entries.
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open audit log: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	entries := make([]Entry, 0)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("audit log line %d is not a valid entry", lineNum)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Verify checks every MAC in the chain and that the log ends at the stored
+// head. It returns nil if the log is intact.
+func Verify(path string, key []byte, heads HeadStore) error {
+	entries, err := Read(path)
+	if err != nil {
+		return err
+	}
+
+	prevMAC := ""
+	for i, e := range entries {
+		if e.Seq != int64(i+1) {
+			return fmt.Errorf("entry %d has sequence number %d: entries were removed or reordered", i+1, e.Seq)
+		}
+		want, err := computeMAC(key, prevMAC, e)
+		if err != nil {
+			return err
+		}
+		if !hmac.Equal([]byte(want), []byte(e.MAC)) {
+			return fmt.Errorf("entry %d does not match its MAC: it or an earlier entry was modified", e.Seq)
+		}
+		prevMAC = e.MAC
+	}
+
+	if heads == nil {
+		return nil
+	}
+	head, err := heads.LoadHead()
+	if err != nil {
+		return err
+	}
+	if head == nil {
+		if len(entries) > 0 {
+			return fmt.Errorf("no stored head for a log with %d entries", len(entries))
+		}
+		return nil
+	}
+	if len(entries) == 0 || entries[len(entries)-1].Seq != head.Seq || prevMAC != head.MAC {
+		return fmt.Errorf("log ends before entry %d: it was truncated", head.Seq)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryHeads struct {
+	head *Head
+}
+
+func (m *memoryHeads) LoadHead() (*Head, error) { return m.head, nil }
+func (m *memoryHeads) SaveHead(h *Head) error   { m.head = h; return nil }
+
+func newTestLogger(t *testing.T) *Logger {
+	t.Helper()
+	return &Logger{
+		Path:  filepath.Join(t.TempDir(), "audit.log"),
+		Key:   []byte("test-key"),
+		Heads: &memoryHeads{},
+	}
+}
+
+func appendEntries(t *testing.T, l *Logger, domains ...string) {
+	t.Helper()
+	for _, domain := range domains {
+		assert.NoError(t, l.Append(Entry{Action: "get", Domain: domain, Command: "passkc get", Success: true}))
+	}
+}
+
+func TestAppendAndVerify(t *testing.T) {
+	l := newTestLogger(t)
+	appendEntries(t, l, "a.com", "b.com", "c.com")
+
+	entries, err := Read(l.Path)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, int64(3), entries[2].Seq)
+	assert.Equal(t, os.Getpid(), entries[0].PID)
+	assert.NoError(t, Verify(l.Path, l.Key, l.Heads))
+
+	assert.Error(t, Verify(l.Path, []byte("wrong-key"), l.Heads))
+}
+
+func TestVerifyDetectsEdits(t *testing.T) {
+	l := newTestLogger(t)
+	appendEntries(t, l, "a.com", "b.com", "c.com")
+
+	data, _ := os.ReadFile(l.Path)
+	assert.NoError(t, os.WriteFile(l.Path, []byte(strings.Replace(string(data), "b.com", "x.com", 1)), 0o600))
+	assert.ErrorContains(t, Verify(l.Path, l.Key, l.Heads), "entry 2 does not match")
+}
+
+func TestVerifyDetectsTruncation(t *testing.T) {
+	l := newTestLogger(t)
+	appendEntries(t, l, "a.com", "b.com", "c.com")
+
+	data, _ := os.ReadFile(l.Path)
+	lines := strings.SplitAfter(string(data), "\n")
+	assert.NoError(t, os.WriteFile(l.Path, []byte(strings.Join(lines[:2], "")), 0o600))
+	assert.ErrorContains(t, Verify(l.Path, l.Key, l.Heads), "truncated")
+
+	assert.NoError(t, os.WriteFile(l.Path, []byte(lines[0]+lines[2]), 0o600))
+	assert.ErrorContains(t, Verify(l.Path, l.Key, l.Heads), "removed or reordered")
+}
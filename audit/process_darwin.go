@@ -0,0 +1,22 @@
+//go:build darwin
+
+package audit
+
+import (
+	"bytes"
+
+	"golang.org/x/sys/unix"
+)
+
+// processName returns the short name of a running process.
+func processName(pid int) string {
+	info, err := unix.SysctlKinfoProc("kern.proc.pid", pid)
+	if err != nil {
+		return ""
+	}
+	comm := info.Proc.P_comm[:]
+	if i := bytes.IndexByte(comm, 0); i >= 0 {
+		comm = comm[:i]
+	}
+	return string(comm)
+}
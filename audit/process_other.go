@@ -0,0 +1,18 @@
+//go:build !darwin
+
+package audit
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// processName returns the short name of a running process.
+func processName(pid int) string {
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
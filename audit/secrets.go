@@ -0,0 +1,99 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+
+	"github.com/e6a5/passkc/config"
+	"github.com/e6a5/passkc/kc"
+)
+
+// Secrets is where the log's HMAC key and head live.
+type Secrets interface {
+	HeadStore
+	// Key returns the HMAC key, or nil if none has been created yet.
+	Key() ([]byte, error)
+	SetKey([]byte) error
+}
+
+// KeychainSecrets keeps the audit secrets in internal keychain items, so
+// that editing the log file alone cannot hide an access.
+type KeychainSecrets struct{}
+
+func (KeychainSecrets) Key() ([]byte, error) {
+	return kc.GetInternal("audit-key")
+}
+
+func (KeychainSecrets) SetKey(key []byte) error {
+	return kc.SetInternal("audit-key", key)
+}
+
+func (KeychainSecrets) LoadHead() (*Head, error) {
+	data, err := kc.GetInternal("audit-head")
+	if err != nil || data == nil {
+		return nil, err
+	}
+	head := &Head{}
+	if err := json.Unmarshal(data, head); err != nil {
+		return nil, fmt.Errorf("stored audit log head is corrupt: %v", err)
+	}
+	return head, nil
+}
+
+func (KeychainSecrets) SaveHead(head *Head) error {
+	data, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	return kc.SetInternal("audit-head", data)
+}
+
+// ConfigPath returns the log file selected by the config.
+func ConfigPath(cfg config.AuditConfig) (string, error) {
+	if cfg.Path != "" {
+		return cfg.Path, nil
+	}
+	return DefaultPath()
+}
+
+// Record appends e to the log at path, creating the HMAC key on first use.
+func Record(path string, secrets Secrets, e Entry) error {
+	key, err := secrets.Key()
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		if err := secrets.SetKey(key); err != nil {
+			return err
+		}
+	}
+
+	logger := &Logger{Path: path, Key: key, Heads: secrets}
+	return logger.Append(e)
+}
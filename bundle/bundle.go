@@ -0,0 +1,176 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package bundle
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/e6a5/passkc/kc"
+)
+
+// version is bumped when the bundle payload changes incompatibly.
+const version = 1
+
+const armorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+
+// Bundle is a single credential packaged for someone else.
+type Bundle struct {
+	Version    int           `json:"version"`
+	Credential kc.Credential `json:"-"`
+	Created    time.Time     `json:"created"`
+	// Expires is when the receiver stops accepting the bundle. It is not
+	// enforced cryptographically: rotate the password once it is used.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// bundleJSON is the encrypted form of a Bundle, with the password revealed.
+type bundleJSON struct {
+	Version    int                    `json:"version"`
+	Credential *kc.RevealedCredential `json:"credential"`
+	Created    time.Time              `json:"created"`
+	Expires    *time.Time             `json:"expires,omitempty"`
+}
+
+// New bundles a credential, expiring after ttl unless it is zero.
+func New(cred *kc.Credential, ttl time.Duration, now time.Time) *Bundle {
+	b := &Bundle{Version: version, Credential: *cred, Created: now.UTC()}
+	if ttl > 0 {
+		expires := b.Created.Add(ttl)
+		b.Expires = &expires
+	}
+	return b
+}
+
+// Expired reports whether the bundle is past its expiry time.
+func (b *Bundle) Expired(now time.Time) bool {
+	return b.Expires != nil && now.After(*b.Expires)
+}
+
+// Seal encrypts the bundle to recipient and writes it to w, ASCII-armored if
+// armored is set.
+func Seal(w io.Writer, b *Bundle, recipient age.Recipient, armored bool) error {
+	plaintext, err := json.Marshal(bundleJSON{
+		Version:    b.Version,
+		Credential: b.Credential.Reveal(),
+		Created:    b.Created,
+		Expires:    b.Expires,
+	})
+	if err != nil {
+		return err
+	}
+
+	dst := w
+	var aw io.WriteCloser
+	if armored {
+		aw = armor.NewWriter(w)
+		dst = aw
+	}
+	ew, err := age.Encrypt(dst, recipient)
+	if err != nil {
+		return err
+	}
+	if _, err := ew.Write(plaintext); err != nil {
+		return err
+	}
+	if err := ew.Close(); err != nil {
+		return err
+	}
+	if aw != nil {
+		return aw.Close()
+	}
+	return nil
+}
+
+// dearmor returns the binary age file, decoding ASCII armor if present.
+func dearmor(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte(armorHeader)) {
+		return data, nil
+	}
+	decoded, err := io.ReadAll(armor.NewReader(bytes.NewReader(bytes.TrimSpace(data))))
+	if err != nil {
+		return nil, fmt.Errorf("invalid armored bundle: %v", err)
+	}
+	return decoded, nil
+}
+
+// NeedsPassphrase reports whether a sealed bundle was encrypted with a
+// passphrase rather than to a public key.
+func NeedsPassphrase(data []byte) (bool, error) {
+	data, err := dearmor(data)
+	if err != nil {
+		return false, err
+	}
+	// The age header is text up to the "---" MAC line
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "-> scrypt ") {
+			return true, nil
+		}
+		if strings.HasPrefix(line, "---") {
+			break
+		}
+	}
+	return false, nil
+}
+
+// Open decrypts a sealed bundle.
+func Open(data []byte, identity age.Identity) (*Bundle, error) {
+	data, err := dearmor(data)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(data), identity)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, fmt.Errorf("this bundle was not shared with you, or the passphrase is wrong")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt bundle: %v", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt bundle: %v", err)
+	}
+
+	var in struct {
+		bundleJSON
+		Credential kc.Credential `json:"credential"`
+	}
+	if err := json.Unmarshal(plaintext, &in); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %v", err)
+	}
+	if in.Version != version {
+		return nil, fmt.Errorf("unsupported bundle version %d", in.Version)
+	}
+	return &Bundle{Version: in.Version, Credential: in.Credential, Created: in.Created, Expires: in.Expires}, nil
+}
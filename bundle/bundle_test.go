@@ -0,0 +1,60 @@
+package bundle
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/e6a5/passkc/kc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealOpen(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	other, _ := age.GenerateX25519Identity()
+	cred := &kc.Credential{Domain: "svc.example.com", Username: "bot", Password: kc.NewSecretString("s3cret"), Fields: map[string]string{"totp": "JBSWY3DP"}}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, armored := range []bool{false, true} {
+		var buf bytes.Buffer
+		assert.NoError(t, Seal(&buf, New(cred, 24*time.Hour, now), identity.Recipient(), armored))
+
+		needs, err := NeedsPassphrase(buf.Bytes())
+		assert.NoError(t, err)
+		assert.False(t, needs)
+
+		b, err := Open(buf.Bytes(), identity)
+		assert.NoError(t, err)
+		assert.Equal(t, *cred, b.Credential)
+		assert.False(t, b.Expired(now.Add(23*time.Hour)))
+		assert.True(t, b.Expired(now.Add(25*time.Hour)))
+
+		_, err = Open(buf.Bytes(), other)
+		assert.ErrorContains(t, err, "not shared with you")
+	}
+}
+
+func TestSealPassphrase(t *testing.T) {
+	cred := &kc.Credential{Domain: "svc.example.com", Username: "bot", Password: kc.NewSecretString("s3cret")}
+	recipient, err := age.NewScryptRecipient("correct horse")
+	assert.NoError(t, err)
+	recipient.SetWorkFactor(10)
+
+	var buf bytes.Buffer
+	assert.NoError(t, Seal(&buf, New(cred, 0, time.Now()), recipient, true))
+
+	needs, err := NeedsPassphrase(buf.Bytes())
+	assert.NoError(t, err)
+	assert.True(t, needs)
+
+	identity, _ := age.NewScryptIdentity("correct horse")
+	b, err := Open(buf.Bytes(), identity)
+	assert.NoError(t, err)
+	assert.Nil(t, b.Expires)
+	assert.False(t, b.Expired(time.Now().Add(1000*time.Hour)))
+
+	wrong, _ := age.NewScryptIdentity("wrong")
+	_, err = Open(buf.Bytes(), wrong)
+	assert.Error(t, err)
+}
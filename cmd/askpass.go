@@ -0,0 +1,165 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// promptFunc asks the user for a secret on a terminal. ttyPath may be empty
+// to use the controlling terminal. echo is set for questions whose answer
+// is not secret, such as ssh host key confirmations.
+type promptFunc func(ttyPath, prompt string, echo bool) (kc.Secret, error)
+
+type askpassCmdRunner struct {
+	kcManager KeychainManager
+	prompt    promptFunc
+}
+
+func (r *askpassCmdRunner) run(cmd *cobra.Command, args []string) error {
+	prompt := strings.Join(args, " ")
+
+	// A broken mapping or a locked keychain must not keep the user from
+	// answering the prompt themselves
+	password, err := lookupPrompt(cmd, r.kcManager, prompt)
+	if err != nil {
+		cmd.PrintErrf("Warning: %v\n", err)
+	}
+
+	if password.IsEmpty() {
+		// No stored entry answers this prompt, so ask the user directly
+		echo := strings.Contains(prompt, "(yes/no")
+		if password, err = r.prompt("", prompt, echo); err != nil {
+			return err
+		}
+	}
+
+	defer password.Destroy()
+
+	out := cmd.OutOrStdout()
+	_, _ = out.Write(password.Bytes())
+	runtime.KeepAlive(password)
+	fmt.Fprintln(out)
+	return nil
+}
+
+// lookupPrompt returns the stored password for the first configured mapping that
+// matches the prompt, or an empty secret when none does.
+func lookupPrompt(cmd *cobra.Command, kcManager KeychainManager, texts ...string) (kc.Secret, error) {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return kc.Secret{}, err
+	}
+
+	domain, ok, err := cfg.MatchPrompt(texts...)
+	if err != nil || !ok {
+		return kc.Secret{}, err
+	}
+
+	if domain, err = resolveDomain(kcManager, domain); err != nil {
+		return kc.Secret{}, err
+	}
+	cred, err := kcManager.GetData(domain)
+	if err != nil {
+		return kc.Secret{}, err
+	}
+	if cred == nil {
+		return kc.Secret{}, fmt.Errorf("no credentials found for '%s'", domain)
+	}
+	return cred.Password, nil
+}
+
+// promptTTY reads an answer from the terminal, bypassing stdin and stdout
+// which belong to the program that invoked passkc.
+func promptTTY(ttyPath, prompt string, echo bool) (kc.Secret, error) {
+	if ttyPath == "" {
+		ttyPath = "/dev/tty"
+	}
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return kc.Secret{}, fmt.Errorf("no terminal available to prompt for a password: %v", err)
+	}
+	defer func() { _ = tty.Close() }()
+
+	if prompt == "" {
+		prompt = "Password:"
+	}
+	fmt.Fprintf(tty, "%s ", strings.TrimRight(prompt, " "))
+
+	if echo {
+		scanner := bufio.NewScanner(tty)
+		if !scanner.Scan() {
+			return kc.Secret{}, fmt.Errorf("failed to read answer")
+		}
+		return kc.NewSecretString(strings.TrimSpace(scanner.Text())), nil
+	}
+
+	answer, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty) // Add newline after password input
+	if err != nil {
+		return kc.Secret{}, fmt.Errorf("failed to read password: %v", err)
+	}
+	return kc.NewSecret(answer), nil
+}
+
+func newAskpassCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &askpassCmdRunner{
+		kcManager: kcManager,
+		prompt:    promptTTY,
+	}
+	return &cobra.Command{
+		Use:   "askpass [prompt]",
+		Short: "Answer SSH_ASKPASS and SUDO_ASKPASS prompts from the keychain",
+		Long: `Act as an askpass helper for ssh, sudo and git.
+
+The prompt text is matched against the askpass mappings in the config
+file. When a mapping matches, the password of its entry is printed.
+Otherwise, or when the entry cannot be read, you are asked on the
+terminal, as a normal askpass helper would.
+
+Config (~/.passkc.yaml):
+  askpass:
+    - match: "id_ed25519"               # Regular expression on the prompt
+      domain: ssh-key
+    - match: "^\\[sudo\\] password"
+      domain: sudo-local
+
+ssh and sudo run the askpass program with the prompt as its only argument,
+which leaves no room for the "askpass" subcommand, so point SSH_ASKPASS and
+SUDO_ASKPASS at a small wrapper script:
+  #!/bin/sh
+  exec passkc askpass "$@"`,
+		RunE: runner.run,
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(newAskpassCmd(&LiveKeychainManager{}))
+}
@@ -0,0 +1,101 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/e6a5/passkc/audit"
+	"github.com/e6a5/passkc/config"
+	"github.com/spf13/cobra"
+)
+
+// auditStore keeps the audit log key and head. Tests replace it with an
+// in-memory store.
+var auditStore audit.Secrets = audit.KeychainSecrets{}
+
+// auditCommand and auditConfig describe the running command. They are set
+// before any command runs, see startAudit.
+var (
+	auditCommand        string
+	auditCommandActions map[string]string
+	auditConfig         config.AuditConfig
+)
+
+// auditActions gives accesses made by some commands a more specific action
+// than the keychain operation they use.
+var auditActions = map[string]map[string]string{
+	"modify":          {"set": "modify"},
+	"netrc":           {"get": "export"},
+	"aws-credentials": {"get": "export"},
+	"kube-credential": {"get": "export"},
+	"env":             {"get": "export"},
+	"run":             {"get": "export"},
+	"edit":            {"set": "modify"},
+}
+
+// startAudit records which command is running for the audit log. The raw
+// arguments are deliberately left out because they can contain secrets,
+// such as set --field values.
+func startAudit(cmd *cobra.Command, _ []string) {
+	auditCommand = cmd.CommandPath()
+	auditConfig = config.AuditConfig{}
+	if cfg, err := loadConfig(cmd); err == nil {
+		auditConfig = cfg.Audit
+	}
+	auditCommandActions = auditActions[cmd.Name()]
+}
+
+// recordAccess appends a keychain access to the audit log. The log fails
+// open: a problem writing it is reported but does not stop the command.
+func recordAccess(action, domain, username string, accessErr error) {
+	if auditConfig.Disabled {
+		return
+	}
+	if specific, ok := auditCommandActions[action]; ok {
+		action = specific
+	}
+
+	entry := audit.Entry{
+		Action:   action,
+		Domain:   domain,
+		Username: username,
+		Command:  auditCommand,
+		Success:  accessErr == nil,
+	}
+	if accessErr != nil {
+		entry.Error = accessErr.Error()
+	}
+
+	if err := appendAudit(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: audit log not written: %v\n", err)
+	}
+}
+
+func appendAudit(entry audit.Entry) error {
+	path, err := audit.ConfigPath(auditConfig)
+	if err != nil {
+		return err
+	}
+	return audit.Record(path, auditStore, entry)
+}
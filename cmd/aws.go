@@ -0,0 +1,143 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/spf13/cobra"
+)
+
+// Field names read by aws-credentials. The access key ID and secret key fall
+// back to the username and password so a plain entry works too.
+const (
+	awsAccessKeyIDField     = "aws_access_key_id"
+	awsSecretAccessKeyField = "aws_secret_access_key"
+	awsSessionTokenField    = "aws_session_token"
+	awsExpirationField      = "aws_expiration"
+)
+
+// awsProcessCredentials is the document AWS SDKs expect from a
+// credential_process command.
+type awsProcessCredentials struct {
+	Version         int    `json:"Version"`
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken,omitempty"`
+	Expiration      string `json:"Expiration,omitempty"`
+}
+
+type awsCredentialsCmdRunner struct {
+	kcManager KeychainManager
+}
+
+func (r *awsCredentialsCmdRunner) run(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+
+	domain, err := kc.NormalizeDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	domain, err = resolveDomain(r.kcManager, domain)
+	if err != nil {
+		return err
+	}
+
+	cred, err := r.kcManager.GetData(domain)
+	if err != nil {
+		return err
+	}
+
+	out, err := newAWSProcessCredentials(cred)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(cmd.OutOrStdout()).Encode(out); err != nil {
+		return fmt.Errorf("failed to encode JSON: %v", err)
+	}
+	return nil
+}
+
+func newAWSProcessCredentials(cred *kc.Credential) (*awsProcessCredentials, error) {
+	out := &awsProcessCredentials{
+		Version:         1,
+		AccessKeyID:     cred.Username,
+		SecretAccessKey: cred.Password.Reveal(),
+	}
+	if v := cred.Fields[awsAccessKeyIDField]; v != "" {
+		out.AccessKeyID = v
+	}
+	if v := cred.Fields[awsSecretAccessKeyField]; v != "" {
+		out.SecretAccessKey = v
+	}
+	out.SessionToken = cred.Fields[awsSessionTokenField]
+
+	if v := cred.Fields[awsExpirationField]; v != "" {
+		expiration, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s for '%s': expected RFC 3339 timestamp", awsExpirationField, cred.Domain)
+		}
+		out.Expiration = expiration.UTC().Format(time.RFC3339)
+	}
+
+	if out.AccessKeyID == "" || out.SecretAccessKey == "" {
+		return nil, fmt.Errorf("'%s' has no access key ID or secret access key", cred.Domain)
+	}
+	return out, nil
+}
+
+func newAWSCredentialsCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &awsCredentialsCmdRunner{
+		kcManager: kcManager,
+	}
+	return &cobra.Command{
+		Use:   "aws-credentials <domain>",
+		Short: "Print AWS credentials for use as a credential_process",
+		Long: `Print stored AWS credentials in the JSON format AWS SDKs and the
+AWS CLI expect from a credential_process command.
+
+The access key ID and secret access key are read from the
+aws_access_key_id and aws_secret_access_key fields, falling back to the
+entry's username and password. The optional aws_session_token and
+aws_expiration (RFC 3339) fields are included when present.
+
+Examples:
+  passkc set aws-prod AKIAEXAMPLE          # Username is the access key ID, password the secret key
+  passkc aws-credentials aws-prod          # Print the credential_process JSON
+
+In ~/.aws/config:
+  [profile prod]
+  credential_process = passkc aws-credentials aws-prod`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeDomain(kcManager),
+		RunE:              runner.run,
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(newAWSCredentialsCmd(&LiveKeychainManager{}))
+}
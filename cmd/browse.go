@@ -0,0 +1,163 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/e6a5/passkc/tui"
+	"github.com/spf13/cobra"
+)
+
+// openTerminal opens the full-screen terminal for the browser. Tests swap
+// it for a scripted terminal.
+var openTerminal = func() (tui.Terminal, func() error, error) {
+	t, err := tui.OpenTTY()
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, t.Close, nil
+}
+
+// pickCredential lets the user choose a credential in the browser. It
+// returns nil if the user quit without choosing.
+func pickCredential(kcManager KeychainManager, browser *tui.Browser) (tui.Action, *kc.Credential, error) {
+	creds, err := kcManager.ListData()
+	if err != nil {
+		return tui.ActionQuit, nil, err
+	}
+	if len(creds) == 0 {
+		return tui.ActionQuit, nil, fmt.Errorf("no credentials found. Use 'passkc set <domain> <username>' to add credentials")
+	}
+
+	browser.Entries = creds
+	browser.Load = func(cred kc.Credential) (*kc.Credential, error) {
+		return kcManager.GetAccount(cred.Domain, cred.Username)
+	}
+
+	terminal, closeTerminal, err := openTerminal()
+	if err != nil {
+		return tui.ActionQuit, nil, err
+	}
+	action, cred, err := browser.Run(terminal)
+	if closeErr := closeTerminal(); err == nil {
+		err = closeErr
+	}
+	return action, cred, err
+}
+
+// copyToClipboard puts a password on the macOS pasteboard.
+func copyToClipboard(password kc.Secret) error {
+	pbcopy := exec.Command("pbcopy")
+	pbcopy.Stdin = bytes.NewReader(password.Bytes())
+	out, err := pbcopy.CombinedOutput()
+	runtime.KeepAlive(password)
+	if err != nil {
+		return fmt.Errorf("failed to copy to clipboard: %v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+type browseCmdRunner struct {
+	kcManager KeychainManager
+}
+
+func (r *browseCmdRunner) run(cmd *cobra.Command, args []string) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	action, cred, err := pickCredential(r.kcManager, &tui.Browser{
+		Title: "browse",
+		Copy:  copyToClipboard,
+		Delete: func(cred kc.Credential) error {
+			return r.kcManager.RemoveAccount(cred.Domain, cred.Username)
+		},
+		AllowEdit: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case tui.ActionSelect:
+		full, err := r.kcManager.GetAccount(cred.Domain, cred.Username)
+		if err == nil {
+			defer full.Password.Destroy()
+			err = copyToClipboard(full.Password)
+		}
+		if err != nil {
+			return err
+		}
+		if !quiet {
+			cmd.Printf("✓ Copied password for %s@%s\n", cred.Username, cred.Domain)
+		}
+	case tui.ActionEdit:
+		if !quiet {
+			cmd.Printf("Updating password for %s@%s\n", cred.Username, cred.Domain)
+		}
+		if err := r.kcManager.SetData(cred.Domain, cred.Username, kc.Secret{}); err != nil {
+			return err
+		}
+		if !quiet {
+			cmd.Printf("✓ Updated credentials for %s\n", cred.Domain)
+		}
+	}
+	return nil
+}
+
+func newBrowseCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &browseCmdRunner{
+		kcManager: kcManager,
+	}
+	return &cobra.Command{
+		Use:   "browse",
+		Short: "Browse and search credentials interactively",
+		Long: `Open a full-screen browser with fuzzy search over your saved credentials.
+
+Type to filter by domain and username. The detail pane shows the selected
+entry's username, fields and tags; the password stays hidden unless you
+reveal it, and is hidden again on the next key press.
+
+Keys:
+  ↑/↓, Ctrl-P/Ctrl-N   Move the selection
+  Enter                Copy the password and quit
+  Ctrl-Y               Copy the password
+  Ctrl-R               Reveal the password
+  Ctrl-E               Change the password
+  Ctrl-D               Remove the selected account (asks first)
+  Ctrl-U               Clear the search
+  Esc, Ctrl-C          Quit
+
+'passkc get' and 'passkc remove' open the same browser when run without a
+domain in a terminal.`,
+		Args: cobra.NoArgs,
+		RunE: runner.run,
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(newBrowseCmd(&LiveKeychainManager{}))
+}
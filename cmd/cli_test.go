@@ -3,18 +3,38 @@ package cmd
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"filippo.io/age"
+	"github.com/e6a5/passkc/audit"
+	"github.com/e6a5/passkc/config"
 	"github.com/e6a5/passkc/kc"
+	"github.com/e6a5/passkc/project"
+	"github.com/e6a5/passkc/shamir"
+	"github.com/e6a5/passkc/teamkey"
+	"github.com/e6a5/passkc/tui"
+	"github.com/e6a5/passkc/vault"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 )
 
 // mockKeychain is a mock implementation of KeychainManager for testing
 type mockKeychain struct {
-	creds    []kc.Credential
-	setCalls []setCall
-	err      error
+	creds           []kc.Credential
+	setCalls        []setCall
+	credentialCalls []kc.Credential
+	// removeAccountCalls records "domain username" pairs
+	removeAccountCalls []string
+	err                error
 }
 
 type setCall struct {
@@ -30,24 +50,75 @@ func (m *mockKeychain) ListData() ([]kc.Credential, error) {
 func (m *mockKeychain) GetData(domain string) (*kc.Credential, error) {
 	for _, cred := range m.creds {
 		if cred.Domain == domain {
+			// Like the keychain, hand out a password the caller may destroy
+			cred.Password = cred.Password.Clone()
 			return &cred, nil
 		}
 	}
+	if m.err == nil {
+		return nil, fmt.Errorf("%w for '%s'", kc.ErrNotFound, domain)
+	}
+	return nil, m.err
+}
+
+func (m *mockKeychain) GetAccount(domain, username string) (*kc.Credential, error) {
+	for _, cred := range m.creds {
+		if cred.Domain == domain && cred.Username == username {
+			cred.Password = cred.Password.Clone()
+			return &cred, nil
+		}
+	}
+	if m.err == nil {
+		return nil, fmt.Errorf("%w for '%s@%s'", kc.ErrNotFound, username, domain)
+	}
 	return nil, m.err
 }
 
-func (m *mockKeychain) SetData(domain, username, password string) error {
+func (m *mockKeychain) SetData(domain, username string, password kc.Secret) error {
 	if m.setCalls == nil {
 		m.setCalls = make([]setCall, 0)
 	}
-	m.setCalls = append(m.setCalls, setCall{domain, username, password})
+	m.setCalls = append(m.setCalls, setCall{domain, username, password.Reveal()})
 	return m.err
 }
 
+func (m *mockKeychain) SetCredential(cred *kc.Credential) error {
+	m.credentialCalls = append(m.credentialCalls, *cred)
+	if m.err != nil {
+		return m.err
+	}
+	// Like the keychain, keep a copy the caller cannot destroy
+	stored := *cred
+	stored.Password = cred.Password.Clone()
+	for i := range m.creds {
+		if m.creds[i].Domain == cred.Domain && m.creds[i].Username == cred.Username {
+			m.creds[i] = stored
+			return nil
+		}
+	}
+	m.creds = append(m.creds, stored)
+	return nil
+}
+
 func (m *mockKeychain) RemoveData(domain string) error {
 	return m.err
 }
 
+func (m *mockKeychain) RemoveAccount(domain, username string) error {
+	m.removeAccountCalls = append(m.removeAccountCalls, domain+" "+username)
+	if m.err != nil {
+		return m.err
+	}
+	kept := m.creds[:0]
+	for _, cred := range m.creds {
+		if cred.Domain != domain || cred.Username != username {
+			kept = append(kept, cred)
+		}
+	}
+	m.creds = kept
+	return nil
+}
+
 func execute(t *testing.T, kcManager KeychainManager, args ...string) (string, error) {
 	t.Helper()
 
@@ -61,6 +132,27 @@ func execute(t *testing.T, kcManager KeychainManager, args ...string) (string, e
 	rootCmd.AddCommand(newSetCmd(kcManager))
 	rootCmd.AddCommand(newRemoveCmd(kcManager))
 	rootCmd.AddCommand(newModifyCmd(kcManager))
+	rootCmd.AddCommand(newAWSCredentialsCmd(kcManager))
+	rootCmd.AddCommand(newKubeCredentialCmd(kcManager))
+	rootCmd.AddCommand(newAskpassCmd(kcManager))
+	rootCmd.AddCommand(newNativeHostCmd(kcManager))
+	rootCmd.AddCommand(newNetrcCmd(kcManager))
+	rootCmd.AddCommand(newBrowseCmd(kcManager))
+	rootCmd.AddCommand(newNormalizeCmd(kcManager))
+	rootCmd.AddCommand(newLogCmd())
+	rootCmd.AddCommand(newTeamCmd(kcManager))
+	rootCmd.AddCommand(newShareCmd(kcManager))
+	rootCmd.AddCommand(newReceiveCmd(kcManager))
+	rootCmd.AddCommand(newRecoveryCmd())
+	rootCmd.AddCommand(newRekeyCmd())
+	rootCmd.AddCommand(newProfileCmd(kcManager))
+	rootCmd.AddCommand(newEnvCmd(kcManager))
+	rootCmd.AddCommand(newProjectCmd(kcManager))
+	rootCmd.AddCommand(newStatusCmd(kcManager))
+	rootCmd.AddCommand(newRunCmd(kcManager))
+	rootCmd.AddCommand(newCopyCmd(kcManager, false))
+	rootCmd.AddCommand(newCopyCmd(kcManager, true))
+	rootCmd.AddCommand(newEditCmd(kcManager))
 
 	rootCmd.SetArgs(args)
 	rootCmd.SetOut(buf)
@@ -116,6 +208,17 @@ func TestShowCommandWithData(t *testing.T) {
 	assert.Contains(t, output, "google.com")
 	assert.NotContains(t, output, "github.com")
 
+	// Test tag filtering
+	taggedKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "google.com", Username: "testuser", Tags: []string{"work"}},
+			{Domain: "github.com", Username: "anotheruser"},
+		},
+	}
+	output, err = execute(t, taggedKC, "show", "--tag", "work", "-q")
+	assert.NoError(t, err)
+	assert.Equal(t, "google.com\n", output)
+
 	// Test sorting - updated to match new output format
 	output, err = execute(t, mockKC, "show", "--sort", "username")
 	assert.NoError(t, err)
@@ -124,10 +227,55 @@ func TestShowCommandWithData(t *testing.T) {
 	assert.Contains(t, output, "testuser")
 }
 
+func TestOutputFormats(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "google.com", Username: "testuser", Password: kc.NewSecretString("testpass"), Tags: []string{"work"}},
+			{Domain: "github.com", Username: "anotheruser"},
+		},
+	}
+
+	output, err := execute(t, mockKC, "show", "-o", "table")
+	assert.NoError(t, err)
+	assert.Equal(t, "DOMAIN      USERNAME     TAGS\ngithub.com  anotheruser\ngoogle.com  testuser     work\n", output)
+
+	output, err = execute(t, mockKC, "show", "-o", "csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "Domain,Username\ngithub.com,anotheruser\ngoogle.com,testuser\n", output)
+
+	output, err = execute(t, mockKC, "show", "-o", "table", "--columns", "username")
+	assert.NoError(t, err)
+	assert.Equal(t, "USERNAME\nanotheruser\ntestuser\n", output)
+
+	output, err = execute(t, mockKC, "show", "-o", "ndjson")
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"domain\":\"github.com\",\"username\":\"anotheruser\"}\n{\"domain\":\"google.com\",\"username\":\"testuser\",\"password\":\"[REDACTED]\",\"tags\":[\"work\"],\"redacted\":[\"password\"]}\n", output)
+
+	output, err = execute(t, mockKC, "show", "-o", "template={{.Domain}} {{.Username}}")
+	assert.NoError(t, err)
+	assert.Equal(t, "github.com anotheruser\ngoogle.com testuser\n", output)
+
+	output, err = execute(t, mockKC, "get", "google.com", "-o", "yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "domain: google.com\nusername: testuser\npassword: testpass\ntags:\n  - work\n", output)
+
+	output, err = execute(t, mockKC, "get", "google.com", "-o", "jsonpath={.password}")
+	assert.NoError(t, err)
+	assert.Equal(t, "testpass\n", output)
+
+	// Unknown formats and columns are errors, not text output
+	_, err = execute(t, mockKC, "show", "-o", "xml")
+	assert.ErrorContains(t, err, "unknown output format 'xml'")
+	_, exit := classifyError(err)
+	assert.Equal(t, exitUsage, exit)
+	_, err = execute(t, mockKC, "get", "google.com", "-o", "table", "--columns", "secret")
+	assert.ErrorContains(t, err, "unknown column 'secret'")
+}
+
 func TestGetCommand(t *testing.T) {
 	mockKC := &mockKeychain{
 		creds: []kc.Credential{
-			{Domain: "google.com", Username: "testuser", Password: "testpass"},
+			{Domain: "google.com", Username: "testuser", Password: kc.NewSecretString("testpass")},
 		},
 		err: nil,
 	}
@@ -157,6 +305,156 @@ func TestGetCommand(t *testing.T) {
 	output, err = execute(t, mockKC, "get", "google.com", "-q")
 	assert.NoError(t, err)
 	assert.Equal(t, "testpass", output)
+
+	// Test partial domain resolution
+	output, err = execute(t, mockKC, "get", "google", "-q")
+	assert.NoError(t, err)
+	assert.Equal(t, "testpass", output)
+}
+
+func TestErrorExitCodes(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{{Domain: "google.com", Username: "testuser"}},
+	}
+
+	_, err := execute(t, mockKC, "get", "nothing.example")
+	assert.ErrorIs(t, err, kc.ErrNotFound)
+	_, exit := classifyError(err)
+	assert.Equal(t, exitNotFound, exit)
+
+	mockKC.err = fmt.Errorf("failed to access keychain: %w", kc.ErrLocked)
+	_, err = execute(t, mockKC, "show")
+	code, exit := classifyError(err)
+	assert.Equal(t, "locked", code)
+	assert.Equal(t, exitLocked, exit)
+
+	_, exit = classifyError(&usageError{msg: "no domain given"})
+	assert.Equal(t, exitUsage, exit)
+	_, exit = classifyError(fmt.Errorf("something else"))
+	assert.Equal(t, exitError, exit)
+
+	// With --output json the error is a JSON object on stderr
+	var stderr bytes.Buffer
+	cmd := &cobra.Command{Use: "passkc"}
+	initializeFlags(cmd)
+	cmd.SetErr(&stderr)
+	assert.NoError(t, cmd.ParseFlags([]string{"-o", "json"}))
+	assert.Equal(t, exitCancelled, reportError(cmd, kc.ErrCancelled))
+	var out errorOutput
+	assert.NoError(t, json.Unmarshal(stderr.Bytes(), &out))
+	assert.Equal(t, errorOutput{Error: "canceled", Code: "cancelled", ExitCode: exitCancelled}, out)
+}
+
+// scriptedTerminal feeds keys to the credential browser in tests.
+type scriptedTerminal struct {
+	keys []tui.Key
+}
+
+func (s *scriptedTerminal) Write(p []byte) (int, error) { return len(p), nil }
+func (s *scriptedTerminal) Size() (int, int)            { return 80, 24 }
+func (s *scriptedTerminal) ReadKey() (tui.Key, error) {
+	if len(s.keys) == 0 {
+		return tui.Key{}, io.EOF
+	}
+	key := s.keys[0]
+	s.keys = s.keys[1:]
+	return key, nil
+}
+
+func useScriptedTerminal(t *testing.T, keys ...tui.Key) {
+	t.Helper()
+	original := openTerminal
+	openTerminal = func() (tui.Terminal, func() error, error) {
+		return &scriptedTerminal{keys: keys}, func() error { return nil }, nil
+	}
+	t.Cleanup(func() { openTerminal = original })
+}
+
+func TestGetCommandBatch(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "github.com", Username: "octocat", Password: kc.NewSecretString("gh-pass")},
+			{Domain: "gitlab.com", Username: "tanuki", Password: kc.NewSecretString("gl-pass")},
+		},
+	}
+
+	output, err := execute(t, mockKC, "get", "github.com", "gitlab.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "github.com\toctocat\ngitlab.com\ttanuki\n", output)
+
+	output, err = execute(t, mockKC, "get", "github.com", "gitlab.com", "-q")
+	assert.NoError(t, err)
+	assert.Equal(t, "github.com\tgh-pass\ngitlab.com\tgl-pass\n", output)
+
+	output, err = execute(t, mockKC, "get", "github.com", "gitlab.com", "-o", "json")
+	assert.NoError(t, err)
+	var creds []map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(output), &creds))
+	assert.Len(t, creds, 2)
+	assert.Equal(t, "gl-pass", creds[1]["password"])
+
+	// A missing domain is reported and the others are still printed
+	output, err = execute(t, mockKC, "get", "github.com", "missing.example", "gitlab.com")
+	assert.ErrorContains(t, err, "1 of 3 lookups failed")
+	assert.ErrorIs(t, err, kc.ErrNotFound)
+	assert.Contains(t, output, "Error: no credentials found for 'missing.example'")
+	assert.Contains(t, output, "gitlab.com\ttanuki\n")
+
+	output, err = execute(t, mockKC, "get", "missing.example", "github.com", "--fail-fast")
+	assert.Error(t, err)
+	assert.NotContains(t, output, "octocat")
+
+	// Each failure is printed once, and JSON output stays a list
+	output, err = execute(t, mockKC, "get", "missing.example", "gone.example", "-o", "json")
+	assert.ErrorIs(t, err, kc.ErrNotFound)
+	assert.Equal(t, 2, strings.Count(output, `"code":"not_found"`))
+	assert.Contains(t, output, "[]\n")
+	var stderr bytes.Buffer
+	cmd := &cobra.Command{Use: "passkc"}
+	cmd.SetErr(&stderr)
+	assert.Equal(t, exitNotFound, reportError(cmd, err))
+	assert.Empty(t, stderr.String())
+}
+
+func TestReadGetRequests(t *testing.T) {
+	requests, err := readGetRequests(strings.NewReader("github.com\n\n# comment\n{\"domain\":\"gitlab.com\",\"username\":\"tanuki\"}\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []getRequest{{Domain: "github.com"}, {Domain: "gitlab.com", Username: "tanuki"}}, requests)
+
+	_, err = readGetRequests(strings.NewReader("a.com\n{\"username\":\"x\"}\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestGetCommandPicker(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "google.com", Username: "testuser", Password: kc.NewSecretString("testpass")},
+			{Domain: "github.com", Username: "octocat", Password: kc.NewSecretString("hunter2")},
+		},
+	}
+	useScriptedTerminal(t,
+		tui.Key{Code: tui.KeyRune, Rune: 'h'},
+		tui.Key{Code: tui.KeyRune, Rune: 'u'},
+		tui.Key{Code: tui.KeyRune, Rune: 'b'},
+		tui.Key{Code: tui.KeyEnter})
+
+	output, err := execute(t, mockKC, "get", "-q")
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", output)
+
+	// A browser that fails is reported, not replaced by the usage message
+	openTerminal = func() (tui.Terminal, func() error, error) {
+		return nil, nil, fmt.Errorf("cannot set up terminal: bad ioctl")
+	}
+	_, err = execute(t, mockKC, "get")
+	assert.ErrorContains(t, err, "bad ioctl")
+
+	// Without a terminal there is nothing to pick with
+	openTerminal = func() (tui.Terminal, func() error, error) {
+		return nil, nil, fmt.Errorf("%w: no tty", tui.ErrNoTerminal)
+	}
+	_, err = execute(t, mockKC, "get")
+	assert.ErrorContains(t, err, "no domain given")
 }
 
 func TestSetCommand(t *testing.T) {
@@ -181,6 +479,459 @@ func TestSetCommand(t *testing.T) {
 	assert.Len(t, mockKC.setCalls, 1)
 }
 
+func TestSetCommandWithFields(t *testing.T) {
+	mockKC := &mockKeychain{}
+
+	_, err := execute(t, mockKC, "set", "aws-prod", "AKIAEXAMPLE", "--field", "aws_session_token=tok=en", "-q")
+	assert.NoError(t, err)
+	assert.Empty(t, mockKC.setCalls)
+	assert.Len(t, mockKC.credentialCalls, 1)
+	assert.Equal(t, "aws-prod", mockKC.credentialCalls[0].Domain)
+	assert.Equal(t, map[string]string{"aws_session_token": "tok=en"}, mockKC.credentialCalls[0].Fields)
+
+	// Tagging keeps the stored fields, notes and expiry
+	expires := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockKC.creds[0].Notes = "rotated by ops"
+	mockKC.creds[0].Expires = expires
+	mockKC.credentialCalls = nil
+	_, err = execute(t, mockKC, "set", "aws-prod", "AKIAEXAMPLE", "--tag", "work", "--field", "region=eu-west-1", "-q")
+	assert.NoError(t, err)
+	assert.Len(t, mockKC.credentialCalls, 1)
+	saved := mockKC.credentialCalls[0]
+	assert.Equal(t, map[string]string{"aws_session_token": "tok=en", "region": "eu-west-1"}, saved.Fields)
+	assert.Equal(t, []string{"work"}, saved.Tags)
+	assert.Equal(t, "rotated by ops", saved.Notes)
+	assert.Equal(t, expires, saved.Expires)
+}
+
+func TestSetCommandJSONImport(t *testing.T) {
+	source := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "github.com", Username: "octocat", Password: kc.NewSecretString("pass with spaces"), Tags: []string{"work"}},
+			{Domain: "db.internal", Username: "app", Password: kc.NewSecretString("db"), Fields: map[string]string{"port": "5432"}},
+		},
+	}
+	exported, err := execute(t, source, "get", "github.com", "db.internal", "-o", "json")
+	assert.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "creds.json")
+	assert.NoError(t, os.WriteFile(file, []byte(exported), 0600))
+
+	// get -o json output reads back unchanged
+	target := &mockKeychain{}
+	output, err := execute(t, target, "set", "-f", file)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Imported 2 credentials successfully")
+	assert.Len(t, target.credentialCalls, 2)
+	assert.Equal(t, "pass with spaces", target.credentialCalls[0].Password.Reveal())
+	assert.Equal(t, []string{"work"}, target.credentialCalls[0].Tags)
+	assert.Equal(t, map[string]string{"port": "5432"}, target.credentialCalls[1].Fields)
+
+	// A redacted password, as in show -o ndjson, keeps the stored one
+	assert.NoError(t, os.WriteFile(file, []byte(`{"domain":"github.com","username":"octocat","password":"[REDACTED]","redacted":["password"],"tags":["oss"]}`+"\n"), 0600))
+	source.credentialCalls = nil
+	_, err = execute(t, source, "set", "-f", file, "-q")
+	assert.NoError(t, err)
+	assert.Equal(t, "pass with spaces", source.credentialCalls[0].Password.Reveal())
+	assert.Equal(t, []string{"oss"}, source.credentialCalls[0].Tags)
+
+	// Without the marker, "[REDACTED]" is a password like any other, and
+	// missing tags and expiry keep the stored ones
+	expires := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	source.creds[0].Tags, source.creds[0].Expires = []string{"work"}, expires
+	assert.NoError(t, os.WriteFile(file, []byte(`{"domain":"github.com","username":"octocat","password":"[REDACTED]"}`+"\n"), 0600))
+	source.credentialCalls = nil
+	_, err = execute(t, source, "set", "-f", file, "-q")
+	assert.NoError(t, err)
+	assert.Equal(t, "[REDACTED]", source.credentialCalls[0].Password.Reveal())
+	assert.Equal(t, []string{"work"}, source.credentialCalls[0].Tags)
+	assert.Equal(t, expires, source.credentialCalls[0].Expires)
+
+	// Invalid records are all reported and nothing is saved
+	records := `{"domain":"a.com","username":"a","password":"x"}
+{"version":2,"domain":"b.com","username":"b"}
+{"domain":"c.com","username":"c","url":"x"}
+{"domain":"","username":"d"}
+`
+	assert.NoError(t, os.WriteFile(file, []byte(records), 0600))
+	target.credentialCalls = nil
+	output, err = execute(t, target, "set", "-f", file)
+	assert.ErrorContains(t, err, "3 invalid records")
+	assert.Contains(t, output, "line 2: unsupported schema version 2")
+	assert.Contains(t, output, "line 3: json: unknown field \"url\"")
+	assert.Contains(t, output, "line 4: missing \"domain\"")
+	assert.Empty(t, target.credentialCalls)
+}
+
+func TestParseRecords(t *testing.T) {
+	data := []byte("[\n  {\"domain\": \"a.com\", \"username\": \"a\"},\n\n  {\"domain\": \"B.com\", \"username\": \"b\",\n   \"password\": \"p\"}\n]\n")
+	records, errs := parseRecords(data)
+	assert.Empty(t, errs)
+	assert.Len(t, records, 2)
+	assert.Equal(t, 2, records[0].line)
+	assert.Equal(t, 4, records[1].line)
+	assert.Equal(t, "b.com", records[1].cred.Domain)
+	assert.True(t, records[0].cred.Password.IsEmpty())
+
+	_, errs = parseRecords([]byte("{\"domain\":\"a.com\",\"username\":\"a\"}\n{\"domain\": oops}\n"))
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "line 2")
+}
+
+func TestAWSCredentialsCommand(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "aws-static", Username: "AKIASTATIC", Password: kc.NewSecretString("static-secret")},
+			{Domain: "aws-session", Username: "ignored", Password: kc.NewSecretString("ignored"), Fields: map[string]string{
+				"aws_access_key_id":     "ASIASESSION",
+				"aws_secret_access_key": "session-secret",
+				"aws_session_token":     "token",
+				"aws_expiration":        "2030-01-02T03:04:05+07:00",
+			}},
+		},
+	}
+
+	output, err := execute(t, mockKC, "aws-credentials", "aws-static")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"Version":1,"AccessKeyId":"AKIASTATIC","SecretAccessKey":"static-secret"}`, output)
+
+	output, err = execute(t, mockKC, "aws-credentials", "aws-session")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"Version":1,"AccessKeyId":"ASIASESSION","SecretAccessKey":"session-secret",
+		"SessionToken":"token","Expiration":"2030-01-01T20:04:05Z"}`, output)
+}
+
+func TestKubeCredentialCommand(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "k8s-token", Username: "admin", Password: kc.NewSecretString("bearer"), Fields: map[string]string{
+				"kube_expiration": "2030-01-01T00:00:00Z",
+			}},
+			{Domain: "k8s-cert", Username: "admin", Password: kc.NewSecretString("unused"), Fields: map[string]string{
+				"kube_client_certificate_data": "CERT",
+				"kube_client_key_data":         "KEY",
+			}},
+		},
+	}
+
+	output, err := execute(t, mockKC, "kube-credential", "k8s-token")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential",
+		"status":{"token":"bearer","expirationTimestamp":"2030-01-01T00:00:00Z"}}`, output)
+
+	output, err = execute(t, mockKC, "kube-credential", "k8s-cert")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential",
+		"status":{"clientCertificateData":"CERT","clientKeyData":"KEY"}}`, output)
+}
+
+// writeConfig writes a config file for a test and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "passkc.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestAskpassCommand(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "ssh-key", Username: "me", Password: kc.NewSecretString("key-passphrase")},
+		},
+	}
+	configPath := writeConfig(t, "askpass:\n  - match: id_ed25519\n    domain: ssh-key\n")
+
+	output, err := execute(t, mockKC, "askpass", "--config", configPath,
+		"Enter passphrase for key '/home/me/.ssh/id_ed25519':")
+	assert.NoError(t, err)
+	assert.Equal(t, "key-passphrase\n", output)
+
+	// A mapping whose entry is missing falls back to asking, like pinentry
+	runner := &askpassCmdRunner{
+		kcManager: mockKC,
+		prompt: func(ttyPath, prompt string, echo bool) (kc.Secret, error) {
+			return kc.NewSecretString("typed"), nil
+		},
+	}
+	cmd := &cobra.Command{}
+	initializeFlags(cmd)
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+	assert.NoError(t, cmd.ParseFlags([]string{"--config", writeConfig(t, "askpass:\n  - match: sudo\n    domain: sudo-local\n")}))
+	assert.NoError(t, runner.run(cmd, []string{"[sudo] password for me:"}))
+	assert.Contains(t, buf.String(), "Warning: no credentials found for 'sudo-local'")
+	assert.True(t, strings.HasSuffix(buf.String(), "typed\n"))
+}
+
+func TestPinentryProtocol(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "gpg-signing", Username: "me", Password: kc.NewSecretString("pass%phrase")},
+		},
+	}
+	var prompted []string
+	runner := &pinentryCmdRunner{
+		kcManager: mockKC,
+		prompt: func(ttyPath, prompt string, echo bool) (kc.Secret, error) {
+			prompted = append(prompted, prompt)
+			return kc.NewSecretString("typed"), nil
+		},
+	}
+	cmd := &cobra.Command{}
+	initializeFlags(cmd)
+	assert.NoError(t, cmd.ParseFlags([]string{"--config", writeConfig(t, "askpass:\n  - match: ABCDEF\n    domain: gpg-signing\n")}))
+
+	in := strings.Join([]string{
+		"OPTION ttyname=/dev/null",
+		"SETDESC Please enter the passphrase%0Afor key ABCDEF",
+		"SETTITLE ignored",
+		"GETPIN",
+		"SETERROR Bad Passphrase",
+		"GETPIN",
+		"CONFIRM",
+		"BYE",
+	}, "\n")
+	out := new(bytes.Buffer)
+	assert.NoError(t, runner.serve(cmd, strings.NewReader(in), out))
+	assert.Equal(t, strings.Join([]string{
+		"OK Pleased to meet you",
+		"OK",
+		"OK",
+		"OK",
+		"D pass%25phrase",
+		"OK",
+		"OK",
+		"D typed",
+		"OK",
+		"ERR 536871187 Unknown IPC command",
+		"OK closing connection",
+	}, "\n")+"\n", out.String())
+	assert.Equal(t, []string{"Please enter the passphrase\nfor key ABCDEF\nPassphrase:"}, prompted)
+}
+
+func TestNativeHostProtocol(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "github.com", Username: "octocat", Password: kc.NewSecretString("hunter2")},
+			{Domain: "google.com", Username: "someone", Password: kc.NewSecretString("secret")},
+			{Domain: "github.com", Username: "hubot", Password: kc.NewSecretString("beep")},
+		},
+	}
+	runner := &nativeHostCmdRunner{kcManager: mockKC}
+
+	in := new(bytes.Buffer)
+	for _, req := range []interface{}{
+		nativeRequest{ID: "1", Type: "lookup", URL: "https://login.github.com/session?x=1"},
+		nativeRequest{ID: "2", Type: "list", Origin: "https://github.com"},
+		// As sent by the extension: nativeRequest would redact the password
+		map[string]string{"id": "3", "type": "save", "url": "https://example.com:8443/", "username": "me", "password": "pw"},
+		nativeRequest{ID: "4", Type: "bogus"},
+	} {
+		assert.NoError(t, writeNativeMessage(in, req))
+	}
+
+	out := new(bytes.Buffer)
+	assert.NoError(t, runner.serve(in, out))
+
+	var responses []nativeResponse
+	for out.Len() > 0 {
+		var resp nativeResponse
+		assert.NoError(t, readNativeMessage(out, &resp))
+		responses = append(responses, resp)
+	}
+	assert.Len(t, responses, 4)
+	// Every account of the domain is offered, not just the first
+	assert.Equal(t, []*kc.RevealedCredential{
+		{Domain: "github.com", Username: "octocat", Password: "hunter2"},
+		{Domain: "github.com", Username: "hubot", Password: "beep"},
+	}, responses[0].Credentials)
+	assert.Equal(t, []string{"octocat", "hubot"}, responses[1].Usernames)
+	assert.True(t, responses[2].OK)
+	assert.Equal(t, []setCall{{"example.com", "me", "pw"}}, mockKC.setCalls)
+	assert.False(t, responses[3].OK)
+	assert.Equal(t, "4", responses[3].ID)
+}
+
+func TestNativeHostInstall(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	_, err := execute(t, &mockKeychain{}, "native-host", "install", "--browser", "chrome,firefox", "--extension-id", "abc", "-q")
+	assert.NoError(t, err)
+
+	for browser, key := range map[string]string{"chrome": "allowed_origins", "firefox": "allowed_extensions"} {
+		data, err := os.ReadFile(filepath.Join(home, nativeHostDirs[runtime.GOOS][browser], nativeHostName+".json"))
+		assert.NoError(t, err)
+		var manifest map[string]interface{}
+		assert.NoError(t, json.Unmarshal(data, &manifest))
+		assert.Equal(t, nativeHostName, manifest["name"])
+		assert.Contains(t, manifest, key)
+	}
+}
+
+func TestNetrcCommand(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "artifactory.example.com", Username: "ci", Password: kc.NewSecretString("pass word"), Tags: []string{"build"}},
+			{Domain: "pypi.example.com", Username: "ci", Password: kc.NewSecretString("plain"), Tags: []string{"build"}},
+			{Domain: "github.com", Username: "octocat", Password: kc.NewSecretString("hunter2")},
+			{Domain: "github.com", Username: "ci", Password: kc.NewSecretString("ci-token"), Tags: []string{"build"}},
+		},
+	}
+
+	output, err := execute(t, mockKC, "netrc", "--tag", "build")
+	assert.NoError(t, err)
+	assert.Equal(t, "machine artifactory.example.com\n  login ci\n  password \"pass word\"\n\n"+
+		"machine pypi.example.com\n  login ci\n  password plain\n\n"+
+		"machine github.com\n  login ci\n  password ci-token\n\n", output)
+
+	output, err = execute(t, mockKC, "netrc", "--pattern", "github")
+	assert.NoError(t, err)
+	assert.Equal(t, "machine github.com\n  login octocat\n  password hunter2\n\n", output)
+}
+
+func TestEnvCommand(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "db.internal", Username: "app", Password: kc.NewSecretString("it's secret"), Fields: map[string]string{"port": "5432"}, Tags: []string{"myapp"}},
+			{Domain: "api.example.com", Username: "bot", Password: kc.NewSecretString("token"), Tags: []string{"other"}},
+		},
+	}
+
+	output, err := execute(t, mockKC, "env", "--tag", "myapp")
+	assert.NoError(t, err)
+	assert.Equal(t, "DB_INTERNAL_PASSWORD='it'\\''s secret'\nDB_INTERNAL_PORT='5432'\nDB_INTERNAL_USERNAME='app'\n", output)
+
+	output, err = execute(t, mockKC, "env", "--map", "DB_USER=db.internal:username", "--map", "API_TOKEN=api.example.com", "--syntax", "export")
+	assert.NoError(t, err)
+	assert.Equal(t, "export API_TOKEN='token'\nexport DB_USER='app'\n", output)
+
+	output, err = execute(t, mockKC, "env", "--map", "DB_PASSWORD=db.internal", "--syntax", "fish")
+	assert.NoError(t, err)
+	assert.Equal(t, "set -gx DB_PASSWORD 'it\\'s secret'\n", output)
+
+	// A written file is private and says how to regenerate it
+	path := filepath.Join(t.TempDir(), ".env")
+	output, err = execute(t, mockKC, "env", "--tag", "myapp", "--map", "DB_PORT=db.internal:port", "--write", path)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "✓ Wrote 4 variables to "+path)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "# Generated by passkc."))
+	assert.Contains(t, string(data), "#   passkc env --tag 'myapp' --map 'DB_PORT=db.internal:port' --write '"+path+"'\n")
+	assert.Contains(t, string(data), "\nDB_PORT='5432'\n")
+
+	_, err = execute(t, mockKC, "env")
+	assert.ErrorContains(t, err, "Pass --tag or --map")
+	_, err = execute(t, mockKC, "env", "--map", "db-pass=db.internal")
+	assert.ErrorContains(t, err, "invalid variable name")
+	_, err = execute(t, mockKC, "env", "--map", "X=db.internal:nope")
+	assert.ErrorContains(t, err, "no field 'nope'")
+	_, err = execute(t, mockKC, "env", "--tag", "myapp", "--syntax", "csh")
+	assert.ErrorContains(t, err, "unknown syntax 'csh'")
+}
+
+func TestParseEnvMapping(t *testing.T) {
+	m, err := parseEnvMapping("DB=db.internal")
+	assert.NoError(t, err)
+	assert.Equal(t, envMapping{Name: "DB", Domain: "db.internal", Part: "password"}, m)
+
+	m, err = parseEnvMapping("URL=https://db.internal:8443/x:username")
+	assert.NoError(t, err)
+	assert.Equal(t, envMapping{Name: "URL", Domain: "https://db.internal:8443/x", Part: "username"}, m)
+
+	m, err = parseEnvMapping("URL=https://db.internal")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://db.internal", m.Domain)
+	assert.Equal(t, "password", m.Part)
+
+	_, err = parseEnvMapping("DB")
+	assert.Error(t, err)
+}
+
+func TestSetCommandNormalizesDomain(t *testing.T) {
+	mockKC := &mockKeychain{}
+
+	_, err := execute(t, mockKC, "set", "https://GitHub.com:443/login", "octocat", "-q")
+	assert.NoError(t, err)
+	assert.Equal(t, []setCall{{"github.com", "octocat", ""}}, mockKC.setCalls)
+}
+
+func TestNormalizeCommand(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "github.com", Username: "octocat", Password: kc.NewSecretString("a")},
+			{Domain: "GitHub.com:443", Username: "octocat", Password: kc.NewSecretString("b")},
+			{Domain: "https://example.com/login", Username: "me", Password: kc.NewSecretString("c")},
+		},
+	}
+
+	output, err := execute(t, mockKC, "normalize", "--dry-run")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "https://example.com/login → example.com (me)")
+	assert.Contains(t, output, "1 entries would be renamed")
+	assert.Contains(t, output, "GitHub.com:443': octocat@github.com already exists")
+	assert.Empty(t, mockKC.credentialCalls)
+}
+
+func TestCompletion(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "github.com", Username: "octocat", Tags: []string{"work"}},
+			{Domain: "github.com", Username: "hubot"},
+			{Domain: "gitlab.com", Username: "tanuki", Tags: []string{"oss"}},
+		},
+	}
+
+	output, err := execute(t, mockKC, cobra.ShellCompRequestCmd, "get", "git")
+	assert.NoError(t, err)
+	assert.Equal(t, "github.com\ngitlab.com\n:4\n", firstLines(output, 3))
+
+	output, err = execute(t, mockKC, cobra.ShellCompRequestCmd, "get", "github.com", "git")
+	assert.NoError(t, err)
+	assert.Equal(t, "gitlab.com\n:4\n", firstLines(output, 2))
+
+	output, err = execute(t, mockKC, cobra.ShellCompRequestCmd, "set", "github.com", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "hubot\noctocat\n:4\n", firstLines(output, 3))
+
+	output, err = execute(t, mockKC, cobra.ShellCompRequestCmd, "show", "--tag", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "oss\nwork\n:4\n", firstLines(output, 3))
+
+	output, err = execute(t, mockKC, cobra.ShellCompRequestCmd, "show", "-o", "y")
+	assert.NoError(t, err)
+	assert.Equal(t, "yaml\n:4\n", firstLines(output, 2))
+
+	// Later completions come from the cache
+	mockKC.creds = nil
+	output, err = execute(t, mockKC, cobra.ShellCompRequestCmd, "remove", "gitl")
+	assert.NoError(t, err)
+	assert.Equal(t, "gitlab.com\n:4\n", firstLines(output, 2))
+
+	// --profile applies to completion, which has its own cache per profile
+	fakeProfiles(t, "work")
+	mockKC.creds = []kc.Credential{{Domain: "jira.work.com", Username: "me"}}
+	output, err = execute(t, mockKC, cobra.ShellCompRequestCmd, "get", "--profile", "work", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "jira.work.com\n:4\n", firstLines(output, 2))
+	assert.Equal(t, "work", kc.CurrentProfile())
+}
+
+// firstLines returns the first n lines of s, each with its newline.
+func firstLines(s string, n int) string {
+	lines := strings.SplitAfter(s, "\n")
+	if len(lines) > n {
+		lines = lines[:n]
+	}
+	return strings.Join(lines, "")
+}
+
 func TestRemoveCommand(t *testing.T) {
 	mockKC := &mockKeychain{
 		creds: []kc.Credential{
@@ -198,6 +949,208 @@ func TestRemoveCommand(t *testing.T) {
 	output, err = execute(t, mockKC, "remove", "google.com", "-q", "--force")
 	assert.NoError(t, err)
 	assert.Empty(t, output)
+
+	// A partial domain is only suggested, even with --force
+	output, err = execute(t, mockKC, "remove", "google", "-q", "--force")
+	assert.ErrorIs(t, err, kc.ErrNotFound)
+	assert.ErrorContains(t, err, "Did you mean: google.com?")
+	assert.NotContains(t, output, "Removed")
+	_, err = execute(t, mockKC, "modify", "google", "someone")
+	assert.ErrorIs(t, err, kc.ErrNotFound)
+	assert.Empty(t, mockKC.credentialCalls)
+}
+
+func TestCopyAndMoveCommands(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "old.example.com", Username: "alice", Password: kc.NewSecretString("a-pass"), Fields: map[string]string{"otp": "x"}, Tags: []string{"work"}},
+			{Domain: "old.example.com", Username: "bob", Password: kc.NewSecretString("b-pass")},
+			{Domain: "taken.example.com", Username: "bob", Password: kc.NewSecretString("keep-me")},
+		},
+	}
+
+	output, err := execute(t, mockKC, "cp", "old.example.com", "copy.example.com", "--username", "alice")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "✓ Copied alice@old.example.com to copy.example.com")
+	cred, err := mockKC.GetAccount("copy.example.com", "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "a-pass", cred.Password.Reveal())
+	assert.Equal(t, map[string]string{"otp": "x"}, cred.Fields)
+	assert.Equal(t, []string{"work"}, cred.Tags)
+	_, err = mockKC.GetAccount("old.example.com", "alice")
+	assert.NoError(t, err)
+
+	// bob already exists at the destination, so nothing is moved
+	_, err = execute(t, mockKC, "mv", "old.example.com", "taken.example.com")
+	assert.ErrorIs(t, err, kc.ErrDuplicate)
+	assert.Empty(t, mockKC.removeAccountCalls)
+	cred, _ = mockKC.GetAccount("taken.example.com", "bob")
+	assert.Equal(t, "keep-me", cred.Password.Reveal())
+
+	output, err = execute(t, mockKC, "mv", "old.example.com", "new.example.com")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "✓ Moved 2 accounts from old.example.com to new.example.com")
+	assert.Equal(t, []string{"old.example.com alice", "old.example.com bob"}, mockKC.removeAccountCalls)
+	cred, err = mockKC.GetAccount("new.example.com", "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, "b-pass", cred.Password.Reveal())
+
+	output, err = execute(t, mockKC, "mv", "new.example.com", "taken.example.com", "-u", "bob", "--force", "-q")
+	assert.NoError(t, err)
+	assert.Empty(t, output)
+	cred, _ = mockKC.GetAccount("taken.example.com", "bob")
+	assert.Equal(t, "b-pass", cred.Password.Reveal())
+
+	// cp resolves a partial source, mv does not
+	_, err = execute(t, mockKC, "cp", "new.example", "partial.example.com", "-q")
+	assert.NoError(t, err)
+	_, err = execute(t, mockKC, "mv", "new.example", "partial.example.org", "-q")
+	assert.ErrorIs(t, err, kc.ErrNotFound)
+
+	_, err = execute(t, mockKC, "mv", "new.example.com", "NEW.example.com")
+	assert.ErrorContains(t, err, "source and destination")
+	_, err = execute(t, mockKC, "cp", "new.example.com", "x.example.com", "-u", "carol")
+	assert.ErrorIs(t, err, kc.ErrNotFound)
+}
+
+func TestMoveRollsBackFailedCopies(t *testing.T) {
+	mockKC := &failingCopyKeychain{mockKeychain: mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "old.example.com", Username: "alice", Password: kc.NewSecretString("a")},
+			{Domain: "old.example.com", Username: "bob", Password: kc.NewSecretString("b")},
+		},
+	}}
+
+	_, err := execute(t, mockKC, "mv", "old.example.com", "new.example.com")
+	assert.ErrorContains(t, err, "does not match")
+	// The copies are removed again and the originals stay
+	assert.Equal(t, []string{"new.example.com alice", "new.example.com bob"}, mockKC.removeAccountCalls)
+	assert.Len(t, mockKC.creds, 2)
+
+	// Accounts overwritten with --force are restored
+	mockKC.creds = append(mockKC.creds, kc.Credential{Domain: "taken.example.com", Username: "bob", Password: kc.NewSecretString("keep-me"), Tags: []string{"old"}})
+	mockKC.removeAccountCalls = nil
+	_, err = execute(t, mockKC, "mv", "old.example.com", "taken.example.com", "--force")
+	assert.ErrorContains(t, err, "does not match")
+	assert.Equal(t, []string{"taken.example.com alice"}, mockKC.removeAccountCalls)
+	cred, err := mockKC.GetAccount("taken.example.com", "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, "keep-me", cred.Password.Reveal())
+	assert.Equal(t, []string{"old"}, cred.Tags)
+}
+
+// failingCopyKeychain corrupts bob's password from old.example.com when it
+// is copied.
+type failingCopyKeychain struct {
+	mockKeychain
+}
+
+func (m *failingCopyKeychain) SetCredential(cred *kc.Credential) error {
+	if cred.Username == "bob" && cred.Password.Reveal() == "b" {
+		corrupt := *cred
+		corrupt.Password = kc.NewSecretString("garbled")
+		return m.mockKeychain.SetCredential(&corrupt)
+	}
+	return m.mockKeychain.SetCredential(cred)
+}
+
+func TestEditorArgs(t *testing.T) {
+	assert.Equal(t, []string{"code", "--wait", "/tmp/x.yaml"}, editorArgs("code --wait", "/tmp/x.yaml"))
+	assert.Equal(t, []string{"/usr/bin/vim", "-n", "-c", "set nobackup nowritebackup noundofile viminfo=", "/tmp/x.yaml"},
+		editorArgs("/usr/bin/vim", "/tmp/x.yaml"))
+}
+
+// fakeEditor replaces the editor with one that rewrites the document
+// with edit, and records where the document was.
+func fakeEditor(t *testing.T, edit func(doc string) string) *string {
+	t.Helper()
+	var path string
+	saved := runEditor
+	t.Cleanup(func() { runEditor = saved })
+	runEditor = func(p string) error {
+		path = p
+		info, err := os.Stat(p)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+		info, err = os.Stat(filepath.Dir(p))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+		// Like vim's swap file, left for passkc to clean up
+		assert.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(p), ".credential.yaml.swp"), []byte("password"), 0o600))
+		data, err := os.ReadFile(p)
+		assert.NoError(t, err)
+		return os.WriteFile(p, []byte(edit(string(data))), 0o600)
+	}
+	return &path
+}
+
+func TestEditCommand(t *testing.T) {
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "github.com", Username: "octocat", Password: kc.NewSecretString("old-pass"), Fields: map[string]string{"otp": "x"}, Tags: []string{"work"}},
+			{Domain: "taken.example.com", Username: "octocat", Password: kc.NewSecretString("keep-me")},
+		},
+	}
+
+	// Leaving the document alone changes nothing
+	path := fakeEditor(t, func(doc string) string {
+		assert.Contains(t, doc, "password: old-pass")
+		assert.Contains(t, doc, "otp: x")
+		return doc
+	})
+	output, err := execute(t, mockKC, "edit", "github.com")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "No changes to octocat@github.com")
+	assert.Empty(t, mockKC.credentialCalls)
+	assert.NoFileExists(t, *path)
+	assert.NoDirExists(t, filepath.Dir(*path))
+
+	path = fakeEditor(t, func(doc string) string {
+		doc = strings.Replace(doc, "password: old-pass", "password: new-pass", 1)
+		doc = strings.Replace(doc, "expires: null", "expires: 2027-01-31", 1)
+		return strings.Replace(doc, `notes: ""`, "notes: |\n  recovery codes are in the safe", 1)
+	})
+	output, err = execute(t, mockKC, "edit", "github.com", "octocat")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "✓ Updated octocat@github.com: password, expires, notes")
+	assert.NoFileExists(t, *path)
+	cred, _ := mockKC.GetAccount("github.com", "octocat")
+	assert.Equal(t, "new-pass", cred.Password.Reveal())
+	assert.Equal(t, "recovery codes are in the safe\n", cred.Notes)
+	assert.Equal(t, "2027-01-31", cred.Expires.Format(time.DateOnly))
+	assert.Equal(t, map[string]string{"otp": "x"}, cred.Fields)
+
+	// Renaming refuses to replace an existing entry
+	fakeEditor(t, func(doc string) string {
+		return strings.Replace(doc, "domain: github.com", "domain: taken.example.com", 1)
+	})
+	_, err = execute(t, mockKC, "edit", "github.com")
+	assert.ErrorIs(t, err, kc.ErrDuplicate)
+	assert.Empty(t, mockKC.removeAccountCalls)
+
+	fakeEditor(t, func(doc string) string {
+		return strings.Replace(doc, "username: octocat", "username: hubot", 1)
+	})
+	output, err = execute(t, mockKC, "edit", "github.com")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "✓ Updated hubot@github.com: username")
+	assert.Equal(t, []string{"github.com octocat"}, mockKC.removeAccountCalls)
+	cred, err = mockKC.GetAccount("github.com", "hubot")
+	assert.NoError(t, err)
+	assert.Equal(t, "new-pass", cred.Password.Reveal())
+
+	// Invalid documents are rejected without saving anything
+	mockKC.credentialCalls = nil
+	for _, edit := range []func(string) string{
+		func(doc string) string { return strings.Replace(doc, "password: new-pass", `password: ""`, 1) },
+		func(doc string) string { return strings.Replace(doc, "expires: 2027-01-31", "expires: soon", 1) },
+		func(doc string) string { return doc + "url: https://github.com\n" },
+	} {
+		fakeEditor(t, edit)
+		_, err = execute(t, mockKC, "edit", "github.com")
+		assert.Error(t, err)
+	}
+	assert.Empty(t, mockKC.credentialCalls)
 }
 
 func TestModifyCommand(t *testing.T) {
@@ -228,3 +1181,685 @@ func isJSON(t *testing.T, s string) {
 	var js interface{}
 	assert.NoError(t, json.Unmarshal([]byte(s), &js), "output should be valid JSON")
 }
+
+type memoryAuditStore struct {
+	key  []byte
+	head *audit.Head
+}
+
+func (m *memoryAuditStore) Key() ([]byte, error)           { return m.key, nil }
+func (m *memoryAuditStore) SetKey(key []byte) error        { m.key = key; return nil }
+func (m *memoryAuditStore) LoadHead() (*audit.Head, error) { return m.head, nil }
+func (m *memoryAuditStore) SaveHead(h *audit.Head) error   { m.head = h; return nil }
+
+func TestLogCommand(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	configPath := writeConfig(t, "audit:\n  path: "+logPath+"\n")
+
+	savedStore, savedConfig := auditStore, auditConfig
+	t.Cleanup(func() {
+		auditStore, auditConfig = savedStore, savedConfig
+		auditCommand, auditCommandActions = "", nil
+	})
+	auditStore = &memoryAuditStore{}
+	auditConfig = config.AuditConfig{Path: logPath}
+
+	auditCommand = "passkc get"
+	recordAccess("get", "github.com", "octocat", nil)
+	auditCommand, auditCommandActions = "passkc modify", auditActions["modify"]
+	recordAccess("get", "example.com", "", nil)
+	recordAccess("set", "example.com", "me", assert.AnError)
+
+	// Text output
+	output, err := execute(t, &mockKeychain{}, "log", "--config", configPath)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "octocat@github.com  by 'passkc get'")
+	assert.Contains(t, lines[2], "modify")
+	assert.Contains(t, lines[2], "failed: "+assert.AnError.Error())
+
+	// Filters and JSON output
+	output, err = execute(t, &mockKeychain{}, "log", "--config", configPath, "--domain", "example.com", "--action", "get", "--since", "1h", "-o", "json")
+	assert.NoError(t, err)
+	var entries []audit.Entry
+	assert.NoError(t, json.Unmarshal([]byte(output), &entries))
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "passkc modify", entries[0].Command)
+		assert.Equal(t, int64(2), entries[0].Seq)
+		assert.True(t, entries[0].Success)
+	}
+
+	output, err = execute(t, &mockKeychain{}, "log", "--config", configPath, "--command", "get", "--since", "2000-01-01")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(output, "\n"))
+
+	// Verify
+	output, err = execute(t, &mockKeychain{}, "log", "verify", "--config", configPath)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Audit log intact")
+
+	// Disabled logging leaves the log alone
+	auditConfig.Disabled = true
+	recordAccess("get", "github.com", "octocat", nil)
+	entries, err = audit.Read(logPath)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
+
+// useTeamIdentity makes the team commands run as the given identity, with
+// the team key keychain items kept in memory.
+func useTeamIdentity(t *testing.T, identity *age.X25519Identity) map[string][]byte {
+	t.Helper()
+	items := map[string][]byte{teamKeyItem: []byte(identity.String())}
+	savedGet, savedSet, savedRemove := getTeamKeyItem, setTeamKeyItem, removeTeamKeyItem
+	t.Cleanup(func() { getTeamKeyItem, setTeamKeyItem, removeTeamKeyItem = savedGet, savedSet, savedRemove })
+	getTeamKeyItem = func(name string) ([]byte, error) { return items[name], nil }
+	setTeamKeyItem = func(name string, data []byte) error {
+		items[name] = append([]byte(nil), data...)
+		return nil
+	}
+	removeTeamKeyItem = func(name string) error {
+		delete(items, name)
+		return nil
+	}
+	return items
+}
+
+func TestTeamCommand(t *testing.T) {
+	alice, _ := age.GenerateX25519Identity()
+	bob, _ := age.GenerateX25519Identity()
+	dir := filepath.Join(t.TempDir(), "vault")
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "db.prod.example.com", Username: "admin", Password: kc.NewSecretString("db-secret"), Fields: map[string]string{"port": "5432"}},
+		},
+	}
+
+	useTeamIdentity(t, alice)
+	output, err := execute(t, mockKC, "team", "recipient")
+	assert.NoError(t, err)
+	assert.Equal(t, alice.Recipient().String()+"\n", output)
+
+	output, err = execute(t, mockKC, "team", "init", dir, "--name", "alice", "--group", "oncall")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Created team vault")
+
+	_, err = execute(t, mockKC, "team", "--vault", dir, "add-member", "bob", bob.Recipient().String(), "--group", "dev")
+	assert.NoError(t, err)
+
+	output, err = execute(t, mockKC, "team", "--vault", dir, "add", "db.prod", "--group", "oncall")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Shared admin@db.prod.example.com with alice")
+
+	// Bob is not on call, so he cannot read the entry
+	useTeamIdentity(t, bob)
+	output, err = execute(t, mockKC, "team", "--vault", dir, "list")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "admin@db.prod.example.com [oncall]  (no access)")
+
+	// Sharing the entry again keeps it restricted
+	useTeamIdentity(t, alice)
+	_, err = execute(t, mockKC, "team", "--vault", dir, "add", "db.prod.example.com")
+	assert.NoError(t, err)
+	output, err = execute(t, mockKC, "team", "--vault", dir, "list")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "admin@db.prod.example.com [oncall]")
+
+	// Until he joins the group
+	_, err = execute(t, mockKC, "team", "--vault", dir, "add-member", "bob", bob.Recipient().String(), "--group", "dev,oncall")
+	assert.NoError(t, err)
+
+	useTeamIdentity(t, bob)
+	bobKC := &mockKeychain{}
+	output, err = execute(t, bobKC, "team", "--vault", dir, "pull", "db.prod.example.com")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Saved admin@db.prod.example.com")
+	assert.Equal(t, mockKC.creds, bobKC.credentialCalls)
+
+	// Pulling again does not silently replace bob's copy
+	bobKC.credentialCalls = nil
+	withStdin(t, "n\n")
+	output, err = execute(t, bobKC, "team", "--vault", dir, "pull", "db.prod.example.com")
+	assert.ErrorIs(t, err, kc.ErrCancelled)
+	assert.Contains(t, output, "admin@db.prod.example.com is already stored. Replace it? [y/N]")
+	assert.Empty(t, bobKC.credentialCalls)
+	_, err = execute(t, bobKC, "team", "--vault", dir, "pull", "db.prod.example.com", "--overwrite")
+	assert.NoError(t, err)
+	assert.Len(t, bobKC.credentialCalls, 1)
+
+	// Removing bob re-encrypts the entry without him
+	useTeamIdentity(t, alice)
+	output, err = execute(t, mockKC, "team", "--vault", dir, "remove-member", "bob")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "rotate those passwords")
+
+	v, err := vault.Open(dir)
+	assert.NoError(t, err)
+	assert.Len(t, v.Members, 1)
+	_, err = v.Get(&v.Entries[0], bob)
+	assert.Error(t, err)
+
+	output, err = execute(t, mockKC, "team", "--vault", dir, "list", "-o", "json")
+	assert.NoError(t, err)
+	isJSON(t, output)
+}
+
+func TestShareReceive(t *testing.T) {
+	receiver, _ := age.GenerateX25519Identity()
+	cred := kc.Credential{
+		Domain: "svc.example.com", Username: "bot", Password: kc.NewSecretString("s3cret"),
+		Fields: map[string]string{"totp": "JBSWY3DP"},
+		Notes:  "recovery code 1234", Expires: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	path := filepath.Join(t.TempDir(), "bundle.age")
+
+	output, err := execute(t, &mockKeychain{creds: []kc.Credential{cred}},
+		"share", "svc", "--to", receiver.Recipient().String(), "-o", path, "--expires", "1h")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Wrote bot@svc.example.com to "+path+" (expires")
+
+	// The receiver sees a preview without secrets, then the credential is saved
+	useTeamIdentity(t, receiver)
+	receiverKC := &mockKeychain{}
+	output, err = execute(t, receiverKC, "receive", path, "--force")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Fields: totp\n")
+	assert.Contains(t, output, "Expires: ")
+	assert.NotContains(t, output, "s3cret")
+	assert.NotContains(t, output, "JBSWY3DP")
+	assert.NotContains(t, output, "recovery code")
+	assert.Len(t, receiverKC.credentialCalls, 1)
+	assert.Equal(t, cred.Reveal(), receiverKC.credentialCalls[0].Reveal())
+
+	// A stored account is only replaced when asked for
+	receiverKC.credentialCalls = nil
+	_, err = execute(t, receiverKC, "receive", path, "--force")
+	assert.ErrorIs(t, err, kc.ErrDuplicate)
+	assert.ErrorContains(t, err, "Use --overwrite")
+	assert.Empty(t, receiverKC.credentialCalls)
+	withStdin(t, "n\n")
+	output, err = execute(t, receiverKC, "receive", path)
+	assert.ErrorIs(t, err, kc.ErrCancelled)
+	assert.Contains(t, output, "bot@svc.example.com is already stored. Replace it? [y/N]")
+	assert.Empty(t, receiverKC.credentialCalls)
+	_, err = execute(t, receiverKC, "receive", path, "--force", "--overwrite")
+	assert.NoError(t, err)
+	assert.Len(t, receiverKC.credentialCalls, 1)
+
+	// Passphrase bundles, armored on stdout
+	savedRead := readPassphrase
+	t.Cleanup(func() { readPassphrase = savedRead })
+	readPassphrase = func(string) (string, error) { return "correct horse", nil }
+
+	plain := kc.Credential{Domain: "svc.example.com", Username: "bot", Password: kc.NewSecretString("s3cret")}
+	output, err = execute(t, &mockKeychain{creds: []kc.Credential{plain}}, "share", "svc.example.com", "--to", "passphrase")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(output, "-----BEGIN AGE ENCRYPTED FILE-----"))
+
+	assert.NoError(t, os.WriteFile(path, []byte(output), 0o600))
+	receiverKC = &mockKeychain{}
+	_, err = execute(t, receiverKC, "receive", path, "--force")
+	assert.NoError(t, err)
+	assert.Equal(t, []kc.Credential{plain}, receiverKC.credentialCalls)
+}
+
+func TestRecoveryCommand(t *testing.T) {
+	alice, _ := age.GenerateX25519Identity()
+	bob, _ := age.GenerateX25519Identity()
+	dir := filepath.Join(t.TempDir(), "ops")
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{{Domain: "db.prod.example.com", Username: "admin", Password: kc.NewSecretString("db-secret")}},
+	}
+
+	useTeamIdentity(t, alice)
+	_, err := execute(t, mockKC, "team", "init", dir, "--name", "alice", "--group", "admin")
+	assert.NoError(t, err)
+	_, err = execute(t, mockKC, "team", "--vault", dir, "add", "db.prod.example.com", "--group", "admin")
+	assert.NoError(t, err)
+
+	cardsDir := t.TempDir()
+	output, err := execute(t, mockKC, "recovery", "--vault", dir, "split", "--out-dir", cardsDir)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Wrote 5 recovery share cards")
+	assert.FileExists(t, filepath.Join(cardsDir, "share-5.png"))
+	assert.FileExists(t, filepath.Join(cardsDir, "share-5.txt"))
+
+	// Splitting again replaces the recovery key
+	output, err = execute(t, mockKC, "recovery", "--vault", dir, "split", "--shares", "5", "--threshold", "3", "--no-qr")
+	assert.NoError(t, err)
+	cards := strings.Split(output, "\f")
+	assert.Len(t, cards, 5)
+	assert.Contains(t, cards[1], "passkc recovery share 2 of 5\nVault: ops\n")
+
+	// A card that cannot be written leaves the vault on its current key
+	before, err := vault.Open(dir)
+	assert.NoError(t, err)
+	notADir := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(notADir, nil, 0o600))
+	_, err = execute(t, mockKC, "recovery", "--vault", dir, "split", "--out-dir", filepath.Join(notADir, "cards"))
+	assert.Error(t, err)
+	printCmd := &cobra.Command{Use: "passkc"}
+	initializeFlags(printCmd)
+	printCmd.AddCommand(newRecoveryCmd())
+	printCmd.SetOut(brokenPipe{})
+	printCmd.SetErr(io.Discard)
+	printCmd.SetArgs([]string{"recovery", "--vault", dir, "split", "--no-qr"})
+	assert.Error(t, printCmd.Execute())
+	after, err := vault.Open(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, before.Recovery, after.Recovery)
+
+	// Alice leaves; bob joins the admin group but cannot read its entry
+	useTeamIdentity(t, bob)
+	_, err = execute(t, mockKC, "team", "--vault", dir, "add-member", "bob", bob.Recipient().String(), "--group", "admin")
+	assert.NoError(t, err)
+	_, err = execute(t, mockKC, "team", "--vault", dir, "remove-member", "alice")
+	assert.NoError(t, err)
+
+	// Cards are checked against each other and the vault before combining
+	writeCard := func(name, text string) string {
+		path := filepath.Join(cardsDir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(text), 0o600))
+		return path
+	}
+	cardCode := func(card string) string {
+		for _, line := range strings.Split(card, "\n") {
+			if strings.HasPrefix(line, sharePrefix) {
+				return line
+			}
+		}
+		return ""
+	}
+	oldCard, err := os.ReadFile(filepath.Join(cardsDir, "share-3.txt"))
+	assert.NoError(t, err)
+	code, err := decodeShare(cardCode(cards[2]))
+	assert.NoError(t, err)
+	code.threshold = 2
+	for _, tc := range []struct {
+		cards []string
+		err   string
+	}{
+		{[]string{cards[0], cards[1]}, "2 shares given, 3 needed"},
+		{[]string{cards[0], cards[1], encodeShare(code)}, "share 3 needs 2 shares but the others need 3"},
+		{[]string{cards[0], cards[1], string(oldCard)}, "share 3 is from another split or vault"},
+	} {
+		paths := make([]string, 0, len(tc.cards))
+		for i, card := range tc.cards {
+			paths = append(paths, writeCard(fmt.Sprintf("bad-%d.txt", i), card))
+		}
+		_, err = execute(t, mockKC, append([]string{"recovery", "--vault", dir, "combine"}, paths...)...)
+		assert.ErrorContains(t, err, tc.err)
+	}
+
+	// Three cards unlock the vault for bob
+	paths := make([]string, 0, 3)
+	for _, i := range []int{0, 2, 4} {
+		path := filepath.Join(cardsDir, fmt.Sprintf("card-%d.txt", i))
+		assert.NoError(t, os.WriteFile(path, []byte(cards[i]), 0o600))
+		paths = append(paths, path)
+	}
+	output, err = execute(t, mockKC, append([]string{"recovery", "--vault", dir, "combine"}, paths...)...)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "re-encrypted 1 entries")
+
+	bobKC := &mockKeychain{}
+	_, err = execute(t, bobKC, "team", "--vault", dir, "pull", "db.prod.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "db-secret", bobKC.credentialCalls[0].Password.Reveal())
+}
+
+// brokenPipe is an output whose reader has gone away.
+type brokenPipe struct{}
+
+func (brokenPipe) Write([]byte) (int, error) { return 0, syscall.EPIPE }
+
+func TestShareCodes(t *testing.T) {
+	shares, err := shamir.Split([]byte("AGE-SECRET-KEY-1EXAMPLE"), 3, 2)
+	assert.NoError(t, err)
+
+	want := shareCode{threshold: 2, split: splitID("age1example"), share: shares[1]}
+	code := encodeShare(want)
+	assert.True(t, strings.HasPrefix(code, sharePrefix))
+	got, err := decodeShare(strings.ToLower(code))
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	// A typo is caught by the checksum
+	typo := []byte(code)
+	if typo[10] == 'A' {
+		typo[10] = 'B'
+	} else {
+		typo[10] = 'A'
+	}
+	_, err = decodeShare(string(typo))
+	assert.ErrorContains(t, err, "typo")
+}
+
+func TestRekeyCommand(t *testing.T) {
+	alice, _ := age.GenerateX25519Identity()
+	dir := filepath.Join(t.TempDir(), "vault")
+	otherDir := filepath.Join(t.TempDir(), "other")
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{{Domain: "db.prod.example.com", Username: "admin", Password: kc.NewSecretString("db-secret")}},
+	}
+
+	items := useTeamIdentity(t, alice)
+	for _, d := range []string{dir, otherDir} {
+		_, err := execute(t, mockKC, "team", "init", d, "--name", "alice")
+		assert.NoError(t, err)
+		_, err = execute(t, mockKC, "team", "--vault", d, "add", "db.prod.example.com")
+		assert.NoError(t, err)
+	}
+
+	output, err := execute(t, mockKC, "rekey", "--rotate", "--vault", dir, "--keep-backup")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Re-keyed")
+	assert.NotContains(t, output, alice.Recipient().String())
+	assert.DirExists(t, filepath.Join(dir, "entries.bak"))
+
+	// The new key reads the re-keyed vault, and the replaced one, which
+	// is kept, still reads the other vault
+	for _, d := range []string{dir, otherDir} {
+		pulled := &mockKeychain{}
+		_, err = execute(t, pulled, "team", "--vault", d, "pull", "db.prod.example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, "db-secret", pulled.credentialCalls[0].Password.Reveal())
+	}
+	v, err := vault.Open(dir)
+	assert.NoError(t, err)
+	_, err = v.Get(&v.Entries[0], alice)
+	assert.Error(t, err)
+
+	// Seal the keys with a passphrase and a new keyfile
+	answers := []string{"correct horse", "correct horse"}
+	savedRead := readPassphrase
+	t.Cleanup(func() { readPassphrase = savedRead })
+	readPassphrase = func(string) (string, error) {
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	}
+	keyfile := filepath.Join(t.TempDir(), "passkc.key")
+	output, err = execute(t, mockKC, "rekey", "--keyfile", keyfile, "--work-factor", "15")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "sealed with your passphrase and "+keyfile+" (work factor 15)")
+	assert.FileExists(t, keyfile)
+	assert.NotContains(t, string(items[teamKeyItem]), "AGE-SECRET-KEY")
+	assert.NotContains(t, items, teamKeyBackupItem)
+
+	// Unlocking needs the passphrase and the keyfile
+	answers = []string{"wrong"}
+	_, err = execute(t, mockKC, "team", "--vault", dir, "pull", "db.prod.example.com")
+	assert.ErrorIs(t, err, teamkey.ErrWrongPassphrase)
+	answers = []string{"correct horse"}
+	_, err = execute(t, &mockKeychain{}, "team", "--vault", otherDir, "pull", "db.prod.example.com")
+	assert.NoError(t, err)
+
+	// Dropping the passphrase keeps a backup on request
+	sealed := items[teamKeyItem]
+	answers = []string{"correct horse", ""}
+	output, err = execute(t, mockKC, "rekey", "--no-keyfile", "--keep-backup")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "stored without a passphrase")
+	assert.Equal(t, sealed, items[teamKeyBackupItem])
+	assert.Contains(t, string(items[teamKeyItem]), "AGE-SECRET-KEY")
+}
+
+// withStdin makes input the standard input of the commands run in the
+// test.
+func withStdin(t *testing.T, input string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdin")
+	assert.NoError(t, os.WriteFile(path, []byte(input), 0o600))
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	saved := os.Stdin
+	os.Stdin = f
+	t.Cleanup(func() {
+		os.Stdin = saved
+		_ = f.Close()
+	})
+}
+
+func TestProjectSetup(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(func() { _ = kc.SetProfile(kc.DefaultProfile) })
+	repo := t.TempDir()
+	path := filepath.Join(repo, ".passkc.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`entries:
+  - domain: db.internal
+    env:
+      DB_USER: username
+      DB_PASSWORD: password
+      DB_PORT: port
+      DB_PORT_COPY: port
+  - domain: present.example
+    env:
+      OK: password
+`), 0600))
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(repo))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	p, err := project.Load(path)
+	assert.NoError(t, err)
+	savedLoad := loadAllowedProjects
+	t.Cleanup(func() { loadAllowedProjects = savedLoad })
+	loadAllowedProjects = func() (project.Allowlist, error) { return project.Allowlist{p.Path: p.Hash}, nil }
+
+	mockKC := &mockKeychain{creds: []kc.Credential{{Domain: "present.example", Username: "me", Password: kc.NewSecretString("x")}}}
+	withStdin(t, "app\n5432\n")
+	output, err := execute(t, mockKC, "project", "setup")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Username for db.internal: ")
+	assert.Equal(t, 1, strings.Count(output, "field port of db.internal"))
+	assert.Contains(t, output, "✓ Saved app@db.internal (profile default)")
+	assert.Equal(t, []kc.Credential{{Domain: "db.internal", Username: "app", Fields: map[string]string{"port": "5432"}}}, mockKC.credentialCalls)
+
+	output, err = execute(t, mockKC, "project", "setup")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Nothing to do")
+}
+
+// fakeProfiles replaces the keychain profile registry for a test.
+func fakeProfiles(t *testing.T, names ...string) *[]string {
+	t.Helper()
+	registry := append([]string{kc.DefaultProfile}, names...)
+	oldList, oldCreate, oldDelete := listProfiles, createProfile, deleteProfile
+	listProfiles = func() ([]string, error) {
+		return append([]string(nil), registry...), nil
+	}
+	createProfile = func(name string) error {
+		registry = append(registry, name)
+		return nil
+	}
+	deleteProfile = func(name string) error {
+		kept := registry[:0]
+		for _, existing := range registry {
+			if existing != name {
+				kept = append(kept, existing)
+			}
+		}
+		registry = kept
+		return nil
+	}
+	t.Cleanup(func() {
+		listProfiles, createProfile, deleteProfile = oldList, oldCreate, oldDelete
+		_ = kc.SetProfile(kc.DefaultProfile)
+	})
+	return &registry
+}
+
+func TestProfileCommand(t *testing.T) {
+	registry := fakeProfiles(t)
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte("# my settings\naudit:\n  disabled: true\n"), 0600))
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{{Domain: "vpn.client.com", Username: "me"}},
+	}
+
+	output, err := execute(t, mockKC, "profile", "create", "client-a")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "✓ Created profile 'client-a'")
+	assert.Equal(t, []string{"default", "client-a"}, *registry)
+
+	_, err = execute(t, mockKC, "profile", "create", "Client A")
+	assert.ErrorContains(t, err, "invalid profile name")
+
+	output, err = execute(t, mockKC, "profile", "list")
+	assert.NoError(t, err)
+	assert.Equal(t, "* default (1 entries)\n  client-a (1 entries)\n", output)
+
+	// switch keeps the rest of the config file
+	_, err = execute(t, mockKC, "profile", "switch", "client-a", "-c", configPath)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(configPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "# my settings")
+	cfg, err := config.Load(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "client-a", cfg.Profile)
+	assert.True(t, cfg.Audit.Disabled)
+
+	_, err = execute(t, mockKC, "profile", "switch", "nope", "-c", configPath)
+	assert.ErrorIs(t, err, kc.ErrNotFound)
+
+	// delete removes every entry and resets the config
+	output, err = execute(t, mockKC, "profile", "delete", "client-a", "-f", "-c", configPath)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "✓ Deleted profile 'client-a' and 1 credentials")
+	assert.Equal(t, []string{"vpn.client.com me"}, mockKC.removeAccountCalls)
+	assert.Equal(t, []string{"default"}, *registry)
+	cfg, err = config.Load(configPath)
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Profile)
+	assert.Equal(t, kc.DefaultProfile, kc.CurrentProfile())
+
+	_, err = execute(t, mockKC, "profile", "delete", "default")
+	assert.ErrorContains(t, err, "cannot be deleted")
+}
+
+func TestSelectProfile(t *testing.T) {
+	fakeProfiles(t, "work")
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte("profile: work\n"), 0600))
+
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{Use: "passkc"}
+		initializeFlags(cmd)
+		assert.NoError(t, cmd.ParseFlags(args))
+		return cmd
+	}
+
+	assert.NoError(t, selectProfile(newCmd()))
+	assert.Equal(t, kc.DefaultProfile, kc.CurrentProfile())
+
+	assert.NoError(t, selectProfile(newCmd("-c", configPath)))
+	assert.Equal(t, "work", kc.CurrentProfile())
+
+	// The environment wins over the config file, and the flag over both
+	t.Setenv("PASSKC_PROFILE", "default")
+	assert.NoError(t, selectProfile(newCmd("-c", configPath)))
+	assert.Equal(t, kc.DefaultProfile, kc.CurrentProfile())
+	assert.NoError(t, selectProfile(newCmd("-c", configPath, "--profile", "work")))
+	assert.Equal(t, "work", kc.CurrentProfile())
+
+	err := selectProfile(newCmd("--profile", "wrok"))
+	assert.ErrorContains(t, err, "unknown profile 'wrok'")
+	_, exit := classifyError(err)
+	assert.Equal(t, exitUsage, exit)
+}
+
+func TestProjectCommands(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(func() { _ = kc.SetProfile(kc.DefaultProfile) })
+	repo := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(repo, ".passkc.yaml"), []byte(`profile: work
+entries:
+  - domain: db.internal
+    env:
+      DB_PASSWORD: password
+      DB_PORT: port
+  - domain: missing.example
+    username: me
+    env:
+      API_KEY: password
+`), 0600))
+	sub := filepath.Join(repo, "services", "api")
+	assert.NoError(t, os.MkdirAll(sub, 0700))
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(sub))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	mockKC := &mockKeychain{
+		creds: []kc.Credential{
+			{Domain: "db.internal", Username: "app", Password: kc.NewSecretString("db-secret"), Fields: map[string]string{"port": "5432"}},
+		},
+	}
+	allowed := project.Allowlist{}
+	savedLoad, savedSave := loadAllowedProjects, saveAllowedProjects
+	t.Cleanup(func() { loadAllowedProjects, saveAllowedProjects = savedLoad, savedSave })
+	loadAllowedProjects = func() (project.Allowlist, error) { return maps.Clone(allowed), nil }
+	saveAllowedProjects = func(a project.Allowlist) error {
+		allowed = a
+		return nil
+	}
+
+	// Nothing is used until the project file is allowed
+	_, err = execute(t, mockKC, "env")
+	assert.ErrorContains(t, err, "is not allowed yet")
+	output, err := execute(t, mockKC, "project", "allow")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "  db.internal (profile work): DB_PASSWORD, DB_PORT\n")
+
+	output, err = execute(t, mockKC, "status")
+	assert.ErrorIs(t, err, kc.ErrNotFound)
+	assert.Contains(t, output, "✓ db.internal (profile work): DB_PASSWORD, DB_PORT\n")
+	assert.Contains(t, output, "✗ me@missing.example (profile work): API_KEY\n")
+	assert.Contains(t, output, "  passkc --profile work set missing.example me\n")
+	assert.Equal(t, kc.DefaultProfile, kc.CurrentProfile())
+
+	// Project entries are looked up exactly: a similar domain is not used
+	mockKC.creds = append(mockKC.creds, kc.Credential{Domain: "old.missing.example", Username: "me", Password: kc.NewSecretString("other")})
+	_, err = execute(t, mockKC, "env")
+	assert.ErrorIs(t, err, kc.ErrNotFound)
+
+	mockKC.creds = append(mockKC.creds, kc.Credential{Domain: "missing.example", Username: "me", Password: kc.NewSecretString("key")})
+	output, err = execute(t, mockKC, "status", "-o", "json")
+	assert.NoError(t, err)
+	var statuses []map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(output), &statuses))
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, true, statuses[1]["present"])
+
+	// env and run pick up the project when no --tag or --map is given
+	output, err = execute(t, mockKC, "env")
+	assert.NoError(t, err)
+	assert.Equal(t, "API_KEY='key'\nDB_PASSWORD='db-secret'\nDB_PORT='5432'\n", output)
+
+	output, err = execute(t, mockKC, "env", "--map", "ONLY=db.internal:port")
+	assert.NoError(t, err)
+	assert.Equal(t, "ONLY='5432'\n", output)
+
+	if runtime.GOOS != "windows" {
+		output, err = execute(t, mockKC, "run", "--", "sh", "-c", "echo $DB_PASSWORD:$API_KEY; exit 3")
+		assert.True(t, strings.HasPrefix(output, "db-secret:key\n"))
+		code, exit := classifyError(err)
+		assert.Equal(t, "exit_status", code)
+		assert.Equal(t, 3, exit)
+	}
+
+	// Changing the file revokes it
+	path := filepath.Join(repo, ".passkc.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("profile: personal\nentries: []\n"), 0600))
+	_, err = execute(t, mockKC, "env")
+	assert.ErrorContains(t, err, "changed since")
+	_, err = execute(t, mockKC, "project", "allow")
+	assert.NoError(t, err)
+	_, err = execute(t, mockKC, "project", "deny", path)
+	assert.NoError(t, err)
+	assert.Empty(t, allowed)
+}
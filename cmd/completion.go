@@ -0,0 +1,195 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/spf13/cobra"
+)
+
+// completionCacheTTL bounds how stale completions can be. Commands that
+// change the keychain drop the cache right away.
+const completionCacheTTL = 5 * time.Minute
+
+// completionCache keeps the domains, usernames and tags of all entries so
+// pressing Tab does not query a large keychain every time. It never holds
+// passwords or fields.
+type completionCache struct {
+	Created time.Time       `json:"created"`
+	Entries []kc.Credential `json:"entries"`
+}
+
+func completionCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	name := "completion.json"
+	if profile := kc.CurrentProfile(); profile != kc.DefaultProfile {
+		// Each profile has its own entries
+		name = "completion-" + profile + ".json"
+	}
+	return filepath.Join(dir, "passkc", name), nil
+}
+
+// completionEntries returns the entries to complete from, using the cache
+// when it is fresh.
+func completionEntries(cmd *cobra.Command, kcManager KeychainManager) []kc.Credential {
+	// Completion requests skip PersistentPreRunE, so --profile and
+	// PASSKC_PROFILE are applied here. A bad profile completes nothing
+	// special: the command itself reports it.
+	_ = selectProfile(cmd)
+
+	path, pathErr := completionCachePath()
+	if pathErr == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			var cache completionCache
+			if json.Unmarshal(data, &cache) == nil && time.Since(cache.Created) < completionCacheTTL {
+				return cache.Entries
+			}
+		}
+	}
+
+	creds, err := kcManager.ListData()
+	if err != nil {
+		return nil
+	}
+	if pathErr == nil {
+		entries := make([]kc.Credential, 0, len(creds))
+		for _, cred := range creds {
+			entries = append(entries, kc.Credential{Domain: cred.Domain, Username: cred.Username, Tags: cred.Tags})
+		}
+		if data, err := json.Marshal(completionCache{Created: time.Now(), Entries: entries}); err == nil {
+			if os.MkdirAll(filepath.Dir(path), 0o700) == nil {
+				_ = os.WriteFile(path, data, 0o600)
+			}
+		}
+	}
+	return creds
+}
+
+// invalidateCompletionCache drops cached completions after the keychain changed.
+func invalidateCompletionCache() {
+	if path, err := completionCachePath(); err == nil {
+		_ = os.Remove(path)
+	}
+}
+
+// completeWith returns the unique values with the given prefix, sorted.
+func completeWith(values []string, toComplete string) []string {
+	seen := make(map[string]bool)
+	matches := make([]string, 0)
+	for _, v := range values {
+		if !seen[v] && strings.HasPrefix(strings.ToLower(v), strings.ToLower(toComplete)) {
+			seen[v] = true
+			matches = append(matches, v)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// completeDomain completes the first argument with stored domains.
+func completeDomain(kcManager KeychainManager) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		domains := make([]string, 0)
+		for _, cred := range completionEntries(cmd, kcManager) {
+			domains = append(domains, cred.Domain)
+		}
+		return completeWith(domains, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeDomains completes every argument with a stored domain, skipping
+// the ones already given.
+func completeDomains(kcManager KeychainManager) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		given := make(map[string]bool, len(args))
+		for _, arg := range args {
+			given[arg] = true
+		}
+		domains := make([]string, 0)
+		for _, cred := range completionEntries(cmd, kcManager) {
+			if !given[cred.Domain] {
+				domains = append(domains, cred.Domain)
+			}
+		}
+		return completeWith(domains, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeDomainUsername completes a domain, then the usernames stored for it.
+func completeDomainUsername(kcManager KeychainManager) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	completeFirst := completeDomain(kcManager)
+	completeSecond := completeUsernameOf(kcManager)
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 1 {
+			return completeFirst(cmd, args, toComplete)
+		}
+		return completeSecond(cmd, args, toComplete)
+	}
+}
+
+// completeUsernameOf completes a flag with the usernames stored for the
+// domain given as the first argument.
+func completeUsernameOf(kcManager KeychainManager) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) == 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		usernames := make([]string, 0)
+		for _, cred := range completionEntries(cmd, kcManager) {
+			if cred.Domain == args[0] {
+				usernames = append(usernames, cred.Username)
+			}
+		}
+		return completeWith(usernames, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeTag completes --tag with the tags in use.
+func completeTag(kcManager KeychainManager) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		tags := make([]string, 0)
+		for _, cred := range completionEntries(cmd, kcManager) {
+			tags = append(tags, cred.Tags...)
+		}
+		return completeWith(tags, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeFixed completes a flag from a fixed list of values.
+func completeFixed(values ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeWith(values, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
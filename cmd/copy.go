@@ -0,0 +1,241 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/spf13/cobra"
+)
+
+// copyCmdRunner runs both cp and mv, which differ only in whether the
+// source is removed at the end.
+type copyCmdRunner struct {
+	kcManager KeychainManager
+	move      bool
+}
+
+func (r *copyCmdRunner) run(cmd *cobra.Command, args []string) error {
+	username, _ := cmd.Flags().GetString("username")
+	force, _ := cmd.Flags().GetBool("force")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	src, err := kc.NormalizeDomain(args[0])
+	if err != nil {
+		return err
+	}
+	// mv removes the source, so it must be named exactly
+	if r.move {
+		src, err = resolveExactDomain(r.kcManager, src)
+	} else {
+		src, err = resolveDomain(r.kcManager, src)
+	}
+	if err != nil {
+		return err
+	}
+	// The destination is usually new, so it is not resolved
+	dst, err := kc.NormalizeDomain(args[1])
+	if err != nil {
+		return err
+	}
+	if dst == src {
+		return &usageError{msg: fmt.Sprintf("source and destination are both '%s'", src)}
+	}
+
+	entries, err := r.kcManager.ListData()
+	if err != nil {
+		return err
+	}
+	var accounts []string
+	existing := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Domain == src && (username == "" || entry.Username == username) {
+			accounts = append(accounts, entry.Username)
+		}
+		if entry.Domain == dst {
+			existing[entry.Username] = true
+		}
+	}
+	if len(accounts) == 0 {
+		if username != "" {
+			return fmt.Errorf("%w for '%s@%s'", kc.ErrNotFound, username, src)
+		}
+		return fmt.Errorf("%w for '%s'", kc.ErrNotFound, src)
+	}
+	if !force {
+		for _, account := range accounts {
+			if existing[account] {
+				return fmt.Errorf("%w for '%s@%s'. Use --force to overwrite them", kc.ErrDuplicate, account, dst)
+			}
+		}
+	}
+
+	// Keep the destination accounts about to be overwritten, so that a
+	// failed copy can put them back
+	previous := make(map[string]*kc.Credential)
+	defer func() {
+		for _, cred := range previous {
+			cred.Password.Destroy()
+		}
+	}()
+	for _, account := range accounts {
+		if existing[account] {
+			cred, err := r.kcManager.GetAccount(dst, account)
+			if err != nil {
+				return err
+			}
+			previous[account] = cred
+		}
+	}
+
+	// Write and verify every copy before touching the source, and undo
+	// the copies if one of them fails
+	var written []string
+	for _, account := range accounts {
+		wrote, err := r.copyAccount(src, dst, account)
+		if wrote {
+			written = append(written, account)
+		}
+		if err != nil {
+			r.rollback(cmd, dst, written, previous)
+			return err
+		}
+	}
+
+	if r.move {
+		for _, account := range accounts {
+			if err := r.kcManager.RemoveAccount(src, account); err != nil {
+				return fmt.Errorf("copied to '%s' but could not remove the original: %w", dst, err)
+			}
+		}
+	}
+
+	if !quiet {
+		verb := "Copied"
+		if r.move {
+			verb = "Moved"
+		}
+		if len(accounts) == 1 {
+			cmd.Printf("✓ %s %s@%s to %s\n", verb, accounts[0], src, dst)
+		} else {
+			cmd.Printf("✓ %s %d accounts from %s to %s\n", verb, len(accounts), src, dst)
+		}
+	}
+	return nil
+}
+
+// copyAccount writes one account under the new domain with its password,
+// fields, tags, notes and expiry, and reads it back to check it arrived
+// intact. It reports whether anything was written, even when the check
+// failed.
+func (r *copyCmdRunner) copyAccount(src, dst, username string) (bool, error) {
+	cred, err := r.kcManager.GetAccount(src, username)
+	if err != nil {
+		return false, err
+	}
+	// moved shares cred's password buffer, which stays valid until both
+	// are done with: nothing here destroys either
+	moved := *cred
+	moved.Domain = dst
+	if err := r.kcManager.SetCredential(&moved); err != nil {
+		return false, err
+	}
+
+	stored, err := r.kcManager.GetAccount(dst, username)
+	if err != nil {
+		return true, fmt.Errorf("cannot verify the copy of %s@%s: %w", username, dst, err)
+	}
+	if !stored.Password.Equal(cred.Password) || !maps.Equal(stored.Fields, cred.Fields) || !slices.Equal(stored.Tags, cred.Tags) ||
+		stored.Notes != cred.Notes || !stored.Expires.Equal(cred.Expires) {
+		return true, fmt.Errorf("the copy of %s@%s does not match the original", username, dst)
+	}
+	return true, nil
+}
+
+// rollback removes the copies that were written, and restores the entries
+// that --force overwrote.
+func (r *copyCmdRunner) rollback(cmd *cobra.Command, dst string, written []string, previous map[string]*kc.Credential) {
+	for _, account := range written {
+		if cred, ok := previous[account]; ok {
+			if err := r.kcManager.SetCredential(cred); err != nil {
+				cmd.PrintErrf("Warning: could not restore %s@%s: %v\n", account, dst, err)
+			}
+			continue
+		}
+		if err := r.kcManager.RemoveAccount(dst, account); err != nil {
+			cmd.PrintErrf("Warning: could not remove the partial copy %s@%s: %v\n", account, dst, err)
+		}
+	}
+}
+
+func newCopyCmd(kcManager KeychainManager, move bool) *cobra.Command {
+	runner := &copyCmdRunner{
+		kcManager: kcManager,
+		move:      move,
+	}
+	cmd := &cobra.Command{
+		Use:   "cp <src-domain> <dst-domain>",
+		Short: "Copy credentials to another domain",
+		Long: `Copy the credentials of a domain, with their password, fields and tags,
+to another domain.
+
+Every account of the domain is copied, or only the one given with
+--username. Existing accounts at the destination are not overwritten
+unless --force is given. Each copy is read back and compared with the
+original; if one fails, the copies already made are removed again and
+any accounts they overwrote are restored.
+
+Examples:
+  passkc cp github.com github.enterprise.com               # Copy every account
+  passkc cp github.com gh.example.com --username octocat   # Copy one account`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeDomain(kcManager),
+		RunE:              runner.run,
+	}
+	if move {
+		cmd.Use = "mv <old-domain> <new-domain>"
+		cmd.Short = "Rename credentials to another domain"
+		cmd.Long = `Move the credentials of a domain, with their password, fields and tags,
+to another domain.
+
+The new entries are written and verified first, and only then are the
+old ones removed, so nothing is lost if a step fails. Every account of
+the domain is moved, or only the one given with --username. Existing
+accounts at the destination are not overwritten unless --force is given.
+
+Examples:
+  passkc mv old-vpn.example.com vpn.example.com            # Move every account
+  passkc mv github.com github.enterprise.com --username bot  # Move one account`
+	}
+	cmd.Flags().StringP("username", "u", "", "Only copy this account")
+	cmd.Flags().BoolP("force", "f", false, "Overwrite existing accounts at the destination")
+	_ = cmd.RegisterFlagCompletionFunc("username", completeUsernameOf(kcManager))
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(newCopyCmd(&LiveKeychainManager{}, false))
+	rootCmd.AddCommand(newCopyCmd(&LiveKeychainManager{}, true))
+}
@@ -0,0 +1,393 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// editDocument is the YAML form of a credential that is handed to the
+// editor. Every key is written, even when empty, so that it can be filled
+// in.
+type editDocument struct {
+	Domain   string            `yaml:"domain"`
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	Fields   map[string]string `yaml:"fields"`
+	Tags     []string          `yaml:"tags"`
+	Expires  *time.Time        `yaml:"expires"`
+	Notes    string            `yaml:"notes"`
+}
+
+const editHeader = `# Editing %s@%s. Save and quit to apply the changes.
+# Leave the file unchanged to cancel.
+# expires takes a date (2027-01-31) or an RFC 3339 time; use null to clear it.
+`
+
+// runEditor opens path in the user's editor and waits for it to exit.
+// Tests replace it.
+var runEditor = func(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := editorArgs(editor, path)
+	c := exec.Command(args[0], args[1:]...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("editor '%s' failed: %v", editor, err)
+	}
+	return nil
+}
+
+// editorArgs returns the command line that opens path in editor. Editors
+// may carry arguments, such as "code --wait". Vim is told not to write
+// swap, backup or undo files, which would otherwise hold the plaintext.
+func editorArgs(editor, path string) []string {
+	parts := strings.Fields(editor)
+	switch filepath.Base(parts[0]) {
+	case "vi", "vim", "nvim", "gvim", "mvim":
+		parts = append(parts, "-n", "-c", "set nobackup nowritebackup noundofile viminfo=")
+	}
+	return append(parts, path)
+}
+
+type editCmdRunner struct {
+	kcManager KeychainManager
+}
+
+func (r *editCmdRunner) run(cmd *cobra.Command, args []string) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	domain, err := kc.NormalizeDomain(args[0])
+	if err != nil {
+		return err
+	}
+	domain, err = resolveExactDomain(r.kcManager, domain)
+	if err != nil {
+		return err
+	}
+	var cred *kc.Credential
+	if len(args) > 1 {
+		cred, err = r.kcManager.GetAccount(domain, args[1])
+	} else {
+		cred, err = r.kcManager.GetData(domain)
+	}
+	if err != nil {
+		return err
+	}
+
+	original, err := yaml.Marshal(newEditDocument(cred))
+	if err != nil {
+		return err
+	}
+	file, err := createEditFile()
+	if err != nil {
+		return err
+	}
+	path := file.Name()
+	stop := shredOnSignal(filepath.Dir(path))
+	defer stop()
+	defer shredDir(filepath.Dir(path))
+	_, err = fmt.Fprintf(file, editHeader, cred.Username, cred.Domain)
+	if err == nil {
+		_, err = file.Write(original)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write '%s': %v", path, err)
+	}
+
+	var updated *kc.Credential
+	for {
+		if err := runEditor(path); err != nil {
+			return err
+		}
+		updated, err = readEditFile(path)
+		if err == nil {
+			break
+		}
+		// Give the user a chance to fix their mistake instead of losing
+		// the edits
+		if quiet || !term.IsTerminal(int(os.Stdin.Fd())) {
+			return &usageError{msg: err.Error()}
+		}
+		cmd.PrintErrf("Error: %v\n", err)
+		cmd.Printf("Edit again? [Y/n]: ")
+		scanner := bufio.NewScanner(os.Stdin)
+		if scanner.Scan() {
+			response := strings.ToLower(strings.TrimSpace(scanner.Text()))
+			if response != "" && response != "y" && response != "yes" {
+				return kc.ErrCancelled
+			}
+		}
+	}
+
+	changed := changedKeys(cred, updated)
+	if len(changed) == 0 {
+		if !quiet {
+			cmd.Printf("No changes to %s@%s\n", cred.Username, cred.Domain)
+		}
+		return nil
+	}
+	if err := r.apply(cred, updated); err != nil {
+		return err
+	}
+	if !quiet {
+		cmd.Printf("✓ Updated %s@%s: %s\n", updated.Username, updated.Domain, strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// apply stores the edited credential. A new domain or username is
+// written as a new entry first, and the old one is only removed once
+// that succeeded.
+func (r *editCmdRunner) apply(cred, updated *kc.Credential) error {
+	renamed := updated.Domain != cred.Domain || updated.Username != cred.Username
+	if renamed {
+		_, err := r.kcManager.GetAccount(updated.Domain, updated.Username)
+		if err == nil {
+			return fmt.Errorf("%w for '%s@%s'", kc.ErrDuplicate, updated.Username, updated.Domain)
+		}
+		if !errors.Is(err, kc.ErrNotFound) {
+			return err
+		}
+	}
+	if err := r.kcManager.SetCredential(updated); err != nil {
+		return err
+	}
+	if renamed {
+		if err := r.kcManager.RemoveAccount(cred.Domain, cred.Username); err != nil {
+			return fmt.Errorf("saved as '%s@%s' but could not remove the original: %w", updated.Username, updated.Domain, err)
+		}
+	}
+	return nil
+}
+
+func newEditDocument(cred *kc.Credential) editDocument {
+	doc := editDocument{
+		Domain:   cred.Domain,
+		Username: cred.Username,
+		Password: cred.Password.Reveal(),
+		Fields:   cred.Fields,
+		Tags:     cred.Tags,
+		Notes:    cred.Notes,
+	}
+	if !cred.Expires.IsZero() {
+		doc.Expires = &cred.Expires
+	}
+	return doc
+}
+
+// readEditFile parses and validates the edited document with the same
+// rules as a JSON import, except that the password is required.
+func readEditFile(path string) (*kc.Credential, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var doc editDocument
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid document: %v", err)
+	}
+	if doc.Password == "" {
+		return nil, fmt.Errorf("password cannot be empty")
+	}
+	rec := credentialRecord{
+		Domain:   doc.Domain,
+		Username: doc.Username,
+		Password: doc.Password,
+		Fields:   doc.Fields,
+		Tags:     doc.Tags,
+		Notes:    doc.Notes,
+		Expires:  doc.Expires,
+	}
+	cred, err := rec.credential()
+	if err != nil {
+		return nil, err
+	}
+	// The password is taken literally here, even if it reads [REDACTED]
+	cred.Password = kc.NewSecretString(doc.Password)
+	cred.Notes = doc.Notes
+	return cred, nil
+}
+
+// changedKeys lists the document keys whose value differs between the
+// stored and the edited credential.
+func changedKeys(before, after *kc.Credential) []string {
+	var changed []string
+	if before.Domain != after.Domain {
+		changed = append(changed, "domain")
+	}
+	if before.Username != after.Username {
+		changed = append(changed, "username")
+	}
+	if !before.Password.Equal(after.Password) {
+		changed = append(changed, "password")
+	}
+	// An empty map or list is the same as none at all
+	if !maps.Equal(before.Fields, after.Fields) {
+		changed = append(changed, "fields")
+	}
+	if !slices.Equal(before.Tags, after.Tags) {
+		changed = append(changed, "tags")
+	}
+	if !before.Expires.Equal(after.Expires) {
+		changed = append(changed, "expires")
+	}
+	if before.Notes != after.Notes {
+		changed = append(changed, "notes")
+	}
+	return changed
+}
+
+// createEditFile creates the file for the decrypted document in a private
+// directory of its own, so that whatever the editor writes next to it,
+// such as swap and backup files, is cleaned up with it by shredDir. The
+// directory is in /dev/shm where there is one (Linux), which keeps the
+// plaintext off the disk, and in the temporary directory elsewhere.
+func createEditFile() (*os.File, error) {
+	dir, err := os.MkdirTemp("/dev/shm", "passkc-edit-")
+	if err != nil {
+		dir, err = os.MkdirTemp("", "passkc-edit-")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create temporary directory: %v", err)
+	}
+	// MkdirTemp already uses 0700; be explicit since this holds secrets
+	if err := os.Chmod(dir, 0o700); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("cannot create temporary directory: %v", err)
+	}
+	file, err := os.OpenFile(filepath.Join(dir, "credential.yaml"), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("cannot create temporary file: %v", err)
+	}
+	return file, nil
+}
+
+// shredOnSignal shreds dir if passkc is interrupted, terminated or hung up
+// before the deferred shredDir can run. The editor still gets the signals
+// of the terminal. Call stop once the directory is gone.
+func shredOnSignal(dir string) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		select {
+		case sig := <-signals:
+			shredDir(dir)
+			os.Exit(128 + int(sig.(syscall.Signal)))
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// shredDir shreds every file in dir and removes it.
+func shredDir(dir string) {
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			shredFile(path)
+		}
+		return nil
+	})
+	_ = os.RemoveAll(dir)
+}
+
+// shredFile overwrites the file with zeros before removing it. This is
+// best effort: editors that save by renaming leave the old contents in
+// a freed block that cannot be reached from here.
+func shredFile(path string) {
+	if info, err := os.Stat(path); err == nil {
+		if file, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+			_, _ = file.Write(make([]byte, info.Size()))
+			_ = file.Sync()
+			_ = file.Close()
+		}
+	}
+	_ = os.Remove(path)
+}
+
+func newEditCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &editCmdRunner{
+		kcManager: kcManager,
+	}
+	return &cobra.Command{
+		Use:   "edit <domain> [username]",
+		Short: "Edit a credential in your editor",
+		Long: `Open a credential in $VISUAL or $EDITOR (vi by default) as a YAML
+document with its domain, username, password, fields, tags, expiry and
+notes. When the editor exits, the document is checked and the changes
+are saved; changing the domain or username renames the entry.
+
+The document is written to a file (mode 0600) in a private temporary
+directory (mode 0700). Afterwards every file in that directory, including
+any swap or backup files the editor left, is overwritten and removed.
+The directory is in /dev/shm where there is one, which keeps the
+plaintext in memory; elsewhere, macOS included, it is in $TMPDIR on disk,
+where overwriting is only best effort. Vim is started without swap,
+backup and undo files.
+If the edited document is invalid, you are offered to edit it again.
+
+Examples:
+  passkc edit github.com                # Edit the credential for github.com
+  passkc edit github.com octocat        # Edit one of several accounts
+  EDITOR="code --wait" passkc edit aws  # Use another editor`,
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: completeDomainUsername(kcManager),
+		RunE:              runner.run,
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(newEditCmd(&LiveKeychainManager{}))
+}
@@ -0,0 +1,371 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/e6a5/passkc/format"
+	"github.com/e6a5/passkc/kc"
+	"github.com/e6a5/passkc/project"
+	"github.com/spf13/cobra"
+)
+
+// envSyntaxes are the values of env --syntax.
+var envSyntaxes = []string{"dotenv", "export", "fish"}
+
+// envMapping sets one variable from a part of a stored credential.
+type envMapping struct {
+	Name   string
+	Domain string
+	// Part is "username", "password" or the name of a field.
+	Part string
+
+	// The rest come from project files. Username picks an account,
+	// Profile a profile other than the selected one, and Vault is the team
+	// vault to read from instead of the keychain. Exact turns off partial
+	// domain matching, so that a project only gets the domains it names.
+	Username string
+	Profile  string
+	Vault    string
+	Exact    bool
+}
+
+// parseEnvMapping parses NAME=domain[:part]. The part defaults to the
+// password.
+func parseEnvMapping(arg string) (envMapping, error) {
+	name, ref, ok := strings.Cut(arg, "=")
+	if !ok || name == "" || ref == "" {
+		return envMapping{}, fmt.Errorf("invalid mapping '%s'. Expected: NAME=domain[:password|username|<field>]", arg)
+	}
+	if format.EnvName(name) != name {
+		return envMapping{}, fmt.Errorf("invalid variable name '%s'", name)
+	}
+	m := envMapping{Name: name, Domain: ref, Part: "password"}
+	if i := strings.LastIndex(ref, ":"); i > 0 && !strings.Contains(ref[i+1:], "/") {
+		m.Domain, m.Part = ref[:i], ref[i+1:]
+	}
+	if m.Part == "" {
+		return envMapping{}, fmt.Errorf("invalid mapping '%s': empty part after ':'", arg)
+	}
+	return m, nil
+}
+
+type envCmdRunner struct {
+	kcManager KeychainManager
+}
+
+func (r *envCmdRunner) run(cmd *cobra.Command, args []string) error {
+	tags, _ := cmd.Flags().GetStringSlice("tag")
+	mapArgs, _ := cmd.Flags().GetStringArray("map")
+	syntax, _ := cmd.Flags().GetString("syntax")
+	writePath, _ := cmd.Flags().GetString("write")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	if !slices.Contains(envSyntaxes, syntax) {
+		return &usageError{msg: fmt.Sprintf("unknown syntax '%s'. Use one of: %s", syntax, strings.Join(envSyntaxes, ", "))}
+	}
+	vars, err := r.variables(cmd)
+	if err != nil {
+		return err
+	}
+	content := renderEnv(vars, syntax)
+
+	if writePath == "" {
+		_, err := cmd.OutOrStdout().Write(content)
+		return err
+	}
+	header := fmt.Sprintf("# Generated by passkc. Do not edit or commit; regenerate with:\n#   %s\n", envCommandLine(tags, mapArgs, syntax, writePath))
+	if err := writeSecretFile(writePath, append([]byte(header), content...)); err != nil {
+		return err
+	}
+	if !quiet {
+		cmd.Printf("✓ Wrote %d variables to %s\n", len(vars), writePath)
+	}
+	return nil
+}
+
+// variables resolves the variables selected by --tag and --map or, when
+// neither is given, by the project file.
+func (r *envCmdRunner) variables(cmd *cobra.Command) (map[string]string, error) {
+	tags, _ := cmd.Flags().GetStringSlice("tag")
+	mapArgs, _ := cmd.Flags().GetStringArray("map")
+
+	mappings := make([]envMapping, 0, len(mapArgs))
+	for _, arg := range mapArgs {
+		m, err := parseEnvMapping(arg)
+		if err != nil {
+			return nil, &usageError{msg: err.Error()}
+		}
+		mappings = append(mappings, m)
+	}
+	if len(tags) == 0 && len(mappings) == 0 {
+		p, err := findProject(cmd)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, &usageError{msg: "nothing to export. Pass --tag or --map, or add a " + project.FileName + " to the project"}
+		}
+		if mappings, err = projectMappings(cmd, p); err != nil {
+			return nil, err
+		}
+	}
+	return r.collect(tags, mappings)
+}
+
+// collect resolves the variables. Tagged credentials give
+// <DOMAIN>_USERNAME, <DOMAIN>_PASSWORD and one <DOMAIN>_<FIELD> per field;
+// mappings are applied last and win over them.
+func (r *envCmdRunner) collect(tags []string, mappings []envMapping) (map[string]string, error) {
+	vars := make(map[string]string)
+	if len(tags) > 0 {
+		entries, err := r.kcManager.ListData()
+		if err != nil {
+			return nil, err
+		}
+		entries = kc.FilterCredentials(entries, "", tags)
+		if len(entries) == 0 && len(mappings) == 0 {
+			return nil, fmt.Errorf("%w with tags %s", kc.ErrNotFound, strings.Join(tags, ", "))
+		}
+
+		from := make(map[string]string)
+		for _, entry := range entries {
+			cred, err := r.kcManager.GetAccount(entry.Domain, entry.Username)
+			if err != nil {
+				return nil, err
+			}
+			prefix := format.EnvName(cred.Domain) + "_"
+			values := map[string]string{"USERNAME": cred.Username, "PASSWORD": cred.Password.Reveal()}
+			cred.Password.Destroy()
+			for name, value := range cred.Fields {
+				values[format.EnvName(name)] = value
+			}
+			for suffix, value := range values {
+				name := prefix + suffix
+				if other, ok := from[name]; ok {
+					return nil, fmt.Errorf("both %s and %s@%s set %s. Use --map to choose", other, cred.Username, cred.Domain, name)
+				}
+				from[name] = cred.Username + "@" + cred.Domain
+				vars[name] = value
+			}
+		}
+	}
+
+	// Several variables often come from one credential; read it once
+	creds := make(map[envMapping]*kc.Credential)
+	defer func() {
+		for _, cred := range creds {
+			cred.Password.Destroy()
+		}
+	}()
+	for _, m := range mappings {
+		key := m
+		key.Name, key.Part = "", ""
+		cred, ok := creds[key]
+		if !ok {
+			var err error
+			if cred, err = r.lookup(m); err != nil {
+				return nil, err
+			}
+			creds[key] = cred
+		}
+		value, err := credentialPart(cred, m.Part)
+		if err != nil {
+			return nil, err
+		}
+		vars[m.Name] = value
+	}
+	return vars, nil
+}
+
+// lookup returns the credential a mapping refers to.
+func (r *envCmdRunner) lookup(m envMapping) (*kc.Credential, error) {
+	if m.Vault != "" {
+		return lookupTeamEntry(m.Vault, m.Domain, m.Username)
+	}
+	if m.Profile != "" {
+		var cred *kc.Credential
+		err := inProfile(m.Profile, func() (err error) {
+			m.Profile = ""
+			cred, err = r.lookup(m)
+			return err
+		})
+		return cred, err
+	}
+
+	domain, err := kc.NormalizeDomain(m.Domain)
+	if err != nil {
+		return nil, err
+	}
+	if !m.Exact {
+		if domain, err = resolveDomain(r.kcManager, domain); err != nil {
+			return nil, err
+		}
+	}
+	if m.Username != "" {
+		return r.kcManager.GetAccount(domain, m.Username)
+	}
+	return r.kcManager.GetData(domain)
+}
+
+// credentialPart returns the password, the username or a field.
+func credentialPart(cred *kc.Credential, part string) (string, error) {
+	switch part {
+	case "password":
+		return cred.Password.Reveal(), nil
+	case "username":
+		return cred.Username, nil
+	}
+	value, ok := cred.Fields[part]
+	if !ok {
+		return "", fmt.Errorf("%s has no field '%s'", cred.Domain, part)
+	}
+	return value, nil
+}
+
+// renderEnv writes the variables sorted by name in the given syntax.
+func renderEnv(vars map[string]string, syntax string) []byte {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		switch syntax {
+		case "export":
+			fmt.Fprintf(&buf, "export %s=%s\n", name, format.ShellQuote(vars[name]))
+		case "fish":
+			fmt.Fprintf(&buf, "set -gx %s %s\n", name, fishQuote(vars[name]))
+		default:
+			fmt.Fprintf(&buf, "%s=%s\n", name, format.ShellQuote(vars[name]))
+		}
+	}
+	return buf.Bytes()
+}
+
+// fishQuote quotes s for fish, where only \ and ' are special inside
+// single quotes.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// envCommandLine rebuilds the command for the header of a written file.
+// It only holds names and domains, never values.
+func envCommandLine(tags, mapArgs []string, syntax, writePath string) string {
+	parts := []string{"passkc env"}
+	for _, tag := range tags {
+		parts = append(parts, "--tag "+format.ShellQuote(tag))
+	}
+	for _, arg := range mapArgs {
+		parts = append(parts, "--map "+format.ShellQuote(arg))
+	}
+	if syntax != "dotenv" {
+		parts = append(parts, "--syntax "+syntax)
+	}
+	parts = append(parts, "--write "+format.ShellQuote(writePath))
+	return strings.Join(parts, " ")
+}
+
+// writeSecretFile replaces path with data, readable only by the owner. The
+// data is written to a temporary file next to it first, so a reader never
+// sees a partial file.
+func writeSecretFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot write '%s': %v", path, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	// CreateTemp already uses 0600; be explicit since this holds secrets
+	if err := tmp.Chmod(0o600); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("cannot write '%s': %v", path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("cannot write '%s': %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write '%s': %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("cannot write '%s': %v", path, err)
+	}
+	return nil
+}
+
+func newEnvCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &envCmdRunner{
+		kcManager: kcManager,
+	}
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "Print credentials as environment variables or write a .env file",
+		Long: `Print credentials as environment variables, or write them to a .env file.
+
+--tag exports every credential with the tag as <DOMAIN>_USERNAME,
+<DOMAIN>_PASSWORD and <DOMAIN>_<FIELD>. --map NAME=domain[:part] sets one
+variable from the password (the default), the username or a field of a
+credential, and wins over variables from --tag. Without either, the
+variables come from the project file (.passkc.yaml) of the current
+directory or its parents; see 'passkc status'.
+
+Files written with --write are readable only by you and start with a
+comment giving the command that regenerates them.
+
+Examples:
+  passkc env --tag myapp                                 # DB_INTERNAL_PASSWORD='...'
+  passkc env --map DB_PASSWORD=db.internal --map DB_USER=db.internal:username
+  passkc env --map AWS_SESSION_TOKEN=aws-prod:aws_session_token --syntax export
+  eval "$(passkc env --tag myapp --syntax export)"        # Load into the shell
+  passkc env --tag myapp --syntax fish | source          # fish
+  passkc env --tag myapp --write .env                    # Regenerate a .env file
+  passkc env --write .env                                # Variables from .passkc.yaml`,
+		Args: cobra.NoArgs,
+		RunE: runner.run,
+	}
+	addEnvFlags(cmd, kcManager)
+	cmd.Flags().String("syntax", "dotenv", "Output syntax ("+strings.Join(envSyntaxes, "|")+")")
+	cmd.Flags().String("write", "", "Write to this file (mode 0600) instead of stdout")
+	_ = cmd.RegisterFlagCompletionFunc("syntax", completeFixed(envSyntaxes...))
+	return cmd
+}
+
+// addEnvFlags adds the flags that select variables for env and run.
+func addEnvFlags(cmd *cobra.Command, kcManager KeychainManager) {
+	cmd.Flags().StringSlice("tag", nil, "Export credentials with this tag (repeatable)")
+	cmd.Flags().StringArray("map", nil, "Set NAME from domain[:password|username|<field>] (repeatable)")
+	_ = cmd.RegisterFlagCompletionFunc("tag", completeTag(kcManager))
+}
+
+func init() {
+	rootCmd.AddCommand(newEnvCmd(&LiveKeychainManager{}))
+}
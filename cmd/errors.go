@@ -0,0 +1,134 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes are part of passkc's scripting interface. Keep them stable and
+// in sync with the table in the README.
+const (
+	exitError       = 1
+	exitUsage       = 2
+	exitNotFound    = 3
+	exitDuplicate   = 4
+	exitLocked      = 5
+	exitCancelled   = 6
+	exitUnavailable = 7
+)
+
+// errorKinds maps the kc sentinel errors to their exit code and the code
+// used in JSON error output.
+var errorKinds = []struct {
+	err  error
+	code string
+	exit int
+}{
+	{kc.ErrNotFound, "not_found", exitNotFound},
+	{kc.ErrDuplicate, "duplicate", exitDuplicate},
+	{kc.ErrLocked, "locked", exitLocked},
+	{kc.ErrCancelled, "cancelled", exitCancelled},
+	{kc.ErrBackendUnavailable, "backend_unavailable", exitUnavailable},
+}
+
+// usageError is returned when a command is invoked with missing or invalid
+// arguments.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// exitStatusError passes on the exit status of a command passkc ran, such
+// as the one given to 'passkc run'. The command has reported its own
+// errors, so nothing more is printed.
+type exitStatusError struct {
+	code int
+}
+
+func (e *exitStatusError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// reportedError wraps an error the command has already printed, such as
+// the first of several failed lookups, so that only its exit code is
+// still used.
+type reportedError struct {
+	err error
+}
+
+func (e *reportedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reportedError) Unwrap() error {
+	return e.err
+}
+
+// classifyError returns the JSON error code and exit code for err.
+func classifyError(err error) (string, int) {
+	var usage *usageError
+	if errors.As(err, &usage) {
+		return "usage", exitUsage
+	}
+	var status *exitStatusError
+	if errors.As(err, &status) {
+		return "exit_status", status.code
+	}
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind.err) {
+			return kind.code, kind.exit
+		}
+	}
+	return "error", exitError
+}
+
+type errorOutput struct {
+	Error    string `json:"error"`
+	Code     string `json:"code"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// reportError prints err to stderr, as a JSON object with --output json or
+// ndjson, and returns the exit code for it.
+func reportError(cmd *cobra.Command, err error) int {
+	code, exit := classifyError(err)
+	var status *exitStatusError
+	var reported *reportedError
+	if errors.As(err, &status) || errors.As(err, &reported) {
+		return exit
+	}
+	if format, _ := cmd.Flags().GetString("output"); format == "json" || format == "ndjson" {
+		_ = json.NewEncoder(cmd.ErrOrStderr()).Encode(errorOutput{Error: err.Error(), Code: code, ExitCode: exit})
+	} else {
+		cmd.PrintErrf("Error: %v\n", err)
+	}
+	return exit
+}
@@ -23,12 +23,19 @@ package cmd
 
 import (
 	"bufio"
-	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/e6a5/passkc/format"
 	"github.com/e6a5/passkc/kc"
+	"github.com/e6a5/passkc/tui"
 	"github.com/spf13/cobra"
 )
 
@@ -36,23 +43,48 @@ type getCmdRunner struct {
 	kcManager KeychainManager
 }
 
-func (r *getCmdRunner) run(cmd *cobra.Command, args []string) {
-	var domain string
-
-	if len(args) > 0 {
-		domain = args[0]
-	} else {
-		// Read from stdin if no domain provided
-		if r.hasStdinInput() {
-			scanner := bufio.NewScanner(os.Stdin)
-			if scanner.Scan() {
-				domain = strings.TrimSpace(scanner.Text())
-			}
+// getRequest is one credential to look up. Username is optional and picks
+// one account when a domain has several.
+type getRequest struct {
+	Domain   string `json:"domain"`
+	Username string `json:"username,omitempty"`
+}
+
+func (r *getCmdRunner) run(cmd *cobra.Command, args []string) error {
+	outputFormat, err := checkOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	requests := make([]getRequest, 0, len(args))
+	for _, arg := range args {
+		requests = append(requests, getRequest{Domain: arg})
+	}
+	if len(requests) == 0 && r.hasStdinInput() {
+		// Read domains from stdin if none were given
+		requests, err = readGetRequests(cmd.InOrStdin())
+		if err != nil {
+			return err
 		}
 	}
 
-	if domain == "" {
-		cmd.PrintErrf("Usage: passkc get <domain>\n\n")
+	if len(requests) == 0 && !r.hasStdinInput() {
+		// Let the user pick an entry when run from a terminal
+		action, cred, err := pickCredential(r.kcManager, &tui.Browser{Title: "get"})
+		switch {
+		case errors.Is(err, tui.ErrNoTerminal):
+			// Nothing to pick with: show the usage below
+		case err != nil:
+			return err
+		case action != tui.ActionSelect:
+			return kc.ErrCancelled
+		default:
+			requests = append(requests, getRequest{Domain: cred.Domain, Username: cred.Username})
+		}
+	}
+
+	if len(requests) == 0 {
+		cmd.PrintErrf("Usage: passkc get <domain>...\n\n")
 		cmd.PrintErrf("Examples:\n")
 		cmd.PrintErrf("  passkc get github.com                    # Show domain and username only\n")
 		cmd.PrintErrf("  passkc get github.com -p                 # Show password only\n")
@@ -60,52 +92,157 @@ func (r *getCmdRunner) run(cmd *cobra.Command, args []string) {
 		cmd.PrintErrf("  passkc get github.com -q | pbcopy        # Copy password to clipboard\n")
 		cmd.PrintErrf("  echo \"github.com\" | passkc get          # Read domain from pipe\n")
 		cmd.PrintErrf("\nFor more help: passkc get --help\n")
-		os.Exit(1)
+		return &usageError{msg: "no domain given"}
+	}
+
+	if len(requests) > 1 {
+		return r.runBatch(cmd, requests, outputFormat)
+	}
+
+	cred, err := r.lookup(requests[0])
+	if err != nil {
+		return err
+	}
+	defer cred.Password.Destroy()
+
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	passwordOnly, _ := cmd.Flags().GetBool("password-only")
+
+	if outputFormat != "text" {
+		// Structured output includes the password
+		return writeRecords(cmd, []any{cred.Reveal()}, format.Options{
+			Columns:    []string{"domain", "username", "password"},
+			AllColumns: credentialColumns,
+		})
+	}
+
+	if passwordOnly || quiet {
+		// Just output the password
+		_, _ = cmd.OutOrStdout().Write(cred.Password.Bytes())
+		runtime.KeepAlive(cred.Password)
+		return nil
 	}
 
-	// Validate domain
-	if err := kc.ValidateDomain(domain); err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+	// SECURITY FIX: By default, only show domain and username
+	// Never show password in plain text unless explicitly requested
+	cmd.Printf("Domain: %s\n", cred.Domain)
+	cmd.Printf("Username: %s\n", cred.Username)
+	if len(cred.Fields) > 0 {
+		// Field values may be secret too, so only list the names
+		names := make([]string, 0, len(cred.Fields))
+		for name := range cred.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		cmd.Printf("Fields: %s\n", strings.Join(names, ", "))
+	}
+	if !cred.Expires.IsZero() {
+		cmd.Printf("Expires: %s\n", cred.Expires.Format(time.DateOnly))
 	}
+	cmd.Printf("\nTo get the password:\n")
+	cmd.Printf("  passkc get %s -p                 # Show password\n", cred.Domain)
+	cmd.Printf("  passkc get %s -q | pbcopy        # Copy to clipboard\n", cred.Domain)
+	return nil
+}
 
-	outputFormat, _ := cmd.Flags().GetString("output")
+// runBatch looks up several credentials. Failures are reported on stderr
+// as they happen and the rest are still looked up, unless --fail-fast is
+// set; the returned error carries the exit code of the first failure and
+// is not printed again.
+func (r *getCmdRunner) runBatch(cmd *cobra.Command, requests []getRequest, outputFormat string) error {
+	failFast, _ := cmd.Flags().GetBool("fail-fast")
 	quiet, _ := cmd.Flags().GetBool("quiet")
 	passwordOnly, _ := cmd.Flags().GetBool("password-only")
 
-	cred, err := r.kcManager.GetData(domain)
+	// Structured output is a list even when every lookup failed
+	records := make([]any, 0, len(requests))
+	var firstErr error
+	failed := 0
+	for _, req := range requests {
+		cred, err := r.lookup(req)
+		if err != nil {
+			reportError(cmd, err)
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			if failFast {
+				break
+			}
+			continue
+		}
+		switch {
+		case outputFormat != "text":
+			records = append(records, cred.Reveal())
+		case passwordOnly || quiet:
+			// One "domain<TAB>password" line per credential
+			cmd.Printf("%s\t%s\n", cred.Domain, cred.Password.Reveal())
+		default:
+			cmd.Printf("%s\t%s\n", cred.Domain, cred.Username)
+		}
+		cred.Password.Destroy()
+	}
+
+	if outputFormat != "text" {
+		err := writeRecords(cmd, records, format.Options{
+			List:       true,
+			Columns:    []string{"domain", "username", "password"},
+			AllColumns: credentialColumns,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if firstErr != nil {
+		return &reportedError{err: fmt.Errorf("%d of %d lookups failed: %w", failed, len(requests), firstErr)}
+	}
+	return nil
+}
+
+// lookup normalizes and resolves the requested domain and fetches its
+// credential.
+func (r *getCmdRunner) lookup(req getRequest) (*kc.Credential, error) {
+	domain, err := kc.NormalizeDomain(req.Domain)
+	if err != nil {
+		return nil, err
+	}
+	domain, err = resolveDomain(r.kcManager, domain)
 	if err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+		return nil, err
+	}
+	if req.Username != "" {
+		return r.kcManager.GetAccount(domain, req.Username)
 	}
+	return r.kcManager.GetData(domain)
+}
 
-	switch outputFormat {
-	case "json":
-		if err := json.NewEncoder(cmd.OutOrStdout()).Encode(cred); err != nil {
-			cmd.PrintErrf("Error encoding JSON: %v\n", err)
-			os.Exit(1)
+// readGetRequests reads one domain per line, or one NDJSON object per
+// line with "domain" and an optional "username". Blank lines and lines
+// starting with # are skipped.
+func readGetRequests(in io.Reader) ([]getRequest, error) {
+	var requests []getRequest
+	scanner := bufio.NewScanner(in)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
 		}
-	case "csv":
-		w := csv.NewWriter(cmd.OutOrStdout())
-		if err := w.Write([]string{cred.Domain, cred.Username, cred.Password}); err != nil {
-			cmd.PrintErrf("Error writing CSV: %v\n", err)
-			os.Exit(1)
+		if !strings.HasPrefix(text, "{") {
+			requests = append(requests, getRequest{Domain: text})
+			continue
 		}
-		w.Flush()
-	default:
-		if passwordOnly || quiet {
-			// Just output the password
-			cmd.Print(cred.Password)
-		} else {
-			// SECURITY FIX: By default, only show domain and username
-			// Never show password in plain text unless explicitly requested
-			cmd.Printf("Domain: %s\n", cred.Domain)
-			cmd.Printf("Username: %s\n", cred.Username)
-			cmd.Printf("\nTo get the password:\n")
-			cmd.Printf("  passkc get %s -p                 # Show password\n", domain)
-			cmd.Printf("  passkc get %s -q | pbcopy        # Copy to clipboard\n", domain)
+		var req getRequest
+		if err := json.Unmarshal([]byte(text), &req); err != nil {
+			return nil, &usageError{msg: fmt.Sprintf("line %d: %v", line, err)}
 		}
+		if req.Domain == "" {
+			return nil, &usageError{msg: fmt.Sprintf("line %d: missing \"domain\"", line)}
+		}
+		requests = append(requests, req)
 	}
+	return requests, scanner.Err()
 }
 
 func (r *getCmdRunner) hasStdinInput() bool {
@@ -118,24 +255,36 @@ func newGetCmd(kcManager KeychainManager) *cobra.Command {
 		kcManager: kcManager,
 	}
 	cmd := &cobra.Command{
-		Use:   "get <domain>",
+		Use:   "get <domain>...",
 		Short: "Retrieve credentials for a website or service",
 		Long: `Retrieve your saved username and password for a domain.
 
 SECURITY: By default, only shows domain and username (password is hidden).
 Use the -p flag to show the password, or -q to output only the password.
 
+Several domains, as arguments or one per line on stdin (plain or NDJSON
+with "domain" and "username"), are looked up together. Text output is then
+one tab-separated line per credential, and -o json prints an array. A
+failed lookup is reported on stderr and the others continue, unless
+--fail-fast is given.
+
 Examples:
   passkc get github.com                    # Show domain and username only (secure)
   passkc get github.com -p                 # Show password only  
   passkc get github.com -q                 # Quiet mode (password only)
   passkc get github.com -o json            # Output as JSON (includes password)
+  passkc get github.com -o template='{{.Username}}:{{.Password}}'
   passkc get github.com -q | pbcopy        # Copy password to clipboard (recommended)
-  echo "github.com" | passkc get           # Read domain from pipe`,
-		Args: cobra.MaximumNArgs(1),
-		Run:  runner.run,
+  echo "github.com" | passkc get           # Read domain from pipe
+  passkc get github.com gitlab.com -o json # Several credentials as a JSON array
+  cat domains.txt | passkc get -q          # One "domain<TAB>password" line each
+  passkc get                               # Pick a domain interactively`,
+		ValidArgsFunction: completeDomains(kcManager),
+		RunE:              runner.run,
 	}
 	cmd.Flags().BoolP("password-only", "p", false, "Output only the password")
+	cmd.Flags().Bool("fail-fast", false, "Stop at the first domain that cannot be found")
+	addColumnsFlag(cmd, credentialColumns)
 	return cmd
 }
 
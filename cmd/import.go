@@ -0,0 +1,194 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/e6a5/passkc/kc"
+)
+
+// credentialSchemaVersion is the version of the JSON credential record
+// that set reads. A record without "version" is taken to be this one.
+const credentialSchemaVersion = 1
+
+// credentialRecord is one credential in JSON input: the shape of
+// kc.RevealedCredential, so that get and show JSON output can be read
+// back, plus the schema version.
+type credentialRecord struct {
+	Version  int               `json:"version,omitempty"`
+	Domain   string            `json:"domain"`
+	Username string            `json:"username"`
+	Password string            `json:"password,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Notes    string            `json:"notes,omitempty"`
+	Expires  *time.Time        `json:"expires,omitempty"`
+	Redacted []string          `json:"redacted,omitempty"`
+}
+
+// importRecord is a validated record and the line it started on.
+type importRecord struct {
+	line int
+	cred kc.Credential
+}
+
+// recordError is a problem with the record starting on line.
+type recordError struct {
+	line int
+	err  error
+}
+
+func (e *recordError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+func (e *recordError) Unwrap() error {
+	return e.err
+}
+
+// isStructuredInput reports whether data is JSON rather than the
+// "domain username [password]" line format.
+func isStructuredInput(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && (data[0] == '[' || data[0] == '{')
+}
+
+// parseRecords reads a JSON array of credential records, or a stream of
+// records such as NDJSON, and validates each one. Every invalid record is
+// reported; a syntax error stops parsing, since the records after it
+// cannot be found reliably.
+func parseRecords(data []byte) ([]importRecord, []error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	array := bytes.HasPrefix(bytes.TrimSpace(data), []byte("["))
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return nil, []error{&recordError{line: 1, err: err}}
+		}
+	}
+
+	var records []importRecord
+	var errs []error
+	for {
+		if array && !dec.More() {
+			break
+		}
+		line := lineAt(data, recordStart(data, dec.InputOffset()))
+		var rec credentialRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return records, append(errs, &recordError{line: line, err: err})
+			}
+			errs = append(errs, &recordError{line: line, err: err})
+			continue
+		}
+		cred, err := rec.credential()
+		if err != nil {
+			errs = append(errs, &recordError{line: line, err: err})
+			continue
+		}
+		records = append(records, importRecord{line: line, cred: *cred})
+	}
+	return records, errs
+}
+
+// credential validates the record and returns it as a credential. A
+// password or notes that are missing, or listed in "redacted", are left
+// empty.
+func (rec *credentialRecord) credential() (*kc.Credential, error) {
+	if rec.Version != 0 && rec.Version != credentialSchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %d (this passkc reads version %d)", rec.Version, credentialSchemaVersion)
+	}
+	if rec.Domain == "" {
+		return nil, fmt.Errorf("missing \"domain\"")
+	}
+	domain, err := kc.NormalizeDomain(rec.Domain)
+	if err != nil {
+		return nil, err
+	}
+	if err := kc.ValidateUsername(rec.Username); err != nil {
+		return nil, err
+	}
+	for name := range rec.Fields {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("field names cannot be empty")
+		}
+	}
+	for _, tag := range rec.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return nil, fmt.Errorf("tags cannot be empty")
+		}
+	}
+	for _, part := range rec.Redacted {
+		if part != "password" && part != "notes" {
+			return nil, fmt.Errorf("unknown redacted part '%s'. Use password or notes", part)
+		}
+	}
+
+	cred := &kc.Credential{
+		Domain:   domain,
+		Username: rec.Username,
+		Fields:   rec.Fields,
+		Tags:     rec.Tags,
+	}
+	if rec.Password != "" && !slices.Contains(rec.Redacted, "password") {
+		cred.Password = kc.NewSecretString(rec.Password)
+	}
+	if !slices.Contains(rec.Redacted, "notes") {
+		cred.Notes = rec.Notes
+	}
+	if rec.Expires != nil {
+		cred.Expires = *rec.Expires
+	}
+	return cred, nil
+}
+
+// recordStart skips the whitespace and commas between records, so that
+// a record's line is the one its opening brace is on.
+func recordStart(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) && strings.ContainsRune(" \t\r\n,", rune(data[offset])) {
+		offset++
+	}
+	return offset
+}
+
+// lineAt returns the 1-based line number of the byte at offset.
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
@@ -1,14 +1,22 @@
 package cmd
 
-import "github.com/e6a5/passkc/kc"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/e6a5/passkc/kc"
+)
 
 // KeychainManager defines the interface for interacting with the keychain.
 // This allows for mocking in tests.
 type KeychainManager interface {
 	ListData() ([]kc.Credential, error)
 	GetData(domain string) (*kc.Credential, error)
-	SetData(domain, username, password string) error
+	GetAccount(domain, username string) (*kc.Credential, error)
+	SetData(domain, username string, password kc.Secret) error
+	SetCredential(cred *kc.Credential) error
 	RemoveData(domain string) error
+	RemoveAccount(domain, username string) error
 }
 
 // LiveKeychainManager is the implementation that uses the real keychain.
@@ -19,13 +27,73 @@ func (lkm *LiveKeychainManager) ListData() ([]kc.Credential, error) {
 }
 
 func (lkm *LiveKeychainManager) GetData(domain string) (*kc.Credential, error) {
-	return kc.GetData(domain)
+	cred, err := kc.GetData(domain)
+	username := ""
+	if cred != nil {
+		username = cred.Username
+	}
+	recordAccess("get", domain, username, err)
+	return cred, err
+}
+
+func (lkm *LiveKeychainManager) GetAccount(domain, username string) (*kc.Credential, error) {
+	cred, err := kc.GetAccount(domain, username)
+	recordAccess("get", domain, username, err)
+	return cred, err
 }
 
-func (lkm *LiveKeychainManager) SetData(domain, username, password string) error {
-	return kc.SetData(domain, username, password)
+func (lkm *LiveKeychainManager) SetData(domain, username string, password kc.Secret) error {
+	defer invalidateCompletionCache()
+	err := kc.SetData(domain, username, password)
+	recordAccess("set", domain, username, err)
+	return err
+}
+
+func (lkm *LiveKeychainManager) SetCredential(cred *kc.Credential) error {
+	defer invalidateCompletionCache()
+	err := kc.SetCredential(cred)
+	recordAccess("set", cred.Domain, cred.Username, err)
+	return err
 }
 
 func (lkm *LiveKeychainManager) RemoveData(domain string) error {
-	return kc.RemoveData(domain)
+	defer invalidateCompletionCache()
+	err := kc.RemoveData(domain)
+	recordAccess("remove", domain, "", err)
+	return err
+}
+
+func (lkm *LiveKeychainManager) RemoveAccount(domain, username string) error {
+	defer invalidateCompletionCache()
+	err := kc.RemoveAccount(domain, username)
+	recordAccess("remove", domain, username, err)
+	return err
+}
+
+// resolveDomain maps a partial or mistyped domain to a stored one, as
+// described in kc.ResolveDomain.
+func resolveDomain(kcManager KeychainManager, domain string) (string, error) {
+	creds, err := kcManager.ListData()
+	if err != nil {
+		return "", err
+	}
+	domains := make([]string, 0, len(creds))
+	for _, cred := range creds {
+		domains = append(domains, cred.Domain)
+	}
+	return kc.ResolveDomain(domain, domains)
+}
+
+// resolveExactDomain is resolveDomain for commands that remove or rewrite
+// entries: a partial match is only suggested, never acted on, so -q and
+// --force cannot delete a domain the user did not name.
+func resolveExactDomain(kcManager KeychainManager, domain string) (string, error) {
+	resolved, err := resolveDomain(kcManager, domain)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(resolved, domain) {
+		return "", fmt.Errorf("%w for '%s'. Did you mean: %s? Give the full domain to change it", kc.ErrNotFound, domain, resolved)
+	}
+	return resolved, nil
 }
@@ -0,0 +1,161 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/spf13/cobra"
+)
+
+// Field names read by kube-credential. The token falls back to the
+// password when no client certificate is stored.
+const (
+	kubeTokenField             = "kube_token"
+	kubeClientCertificateField = "kube_client_certificate_data"
+	kubeClientKeyField         = "kube_client_key_data"
+	kubeExpirationField        = "kube_expiration"
+)
+
+const kubeExecCredentialAPIVersion = "client.authentication.k8s.io/v1"
+
+// kubeExecCredential is the document kubectl expects from an exec
+// credential plugin.
+type kubeExecCredential struct {
+	APIVersion string                   `json:"apiVersion"`
+	Kind       string                   `json:"kind"`
+	Status     kubeExecCredentialStatus `json:"status"`
+}
+
+type kubeExecCredentialStatus struct {
+	Token                 string `json:"token,omitempty"`
+	ClientCertificateData string `json:"clientCertificateData,omitempty"`
+	ClientKeyData         string `json:"clientKeyData,omitempty"`
+	ExpirationTimestamp   string `json:"expirationTimestamp,omitempty"`
+}
+
+type kubeCredentialCmdRunner struct {
+	kcManager KeychainManager
+}
+
+func (r *kubeCredentialCmdRunner) run(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+
+	domain, err := kc.NormalizeDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	domain, err = resolveDomain(r.kcManager, domain)
+	if err != nil {
+		return err
+	}
+
+	cred, err := r.kcManager.GetData(domain)
+	if err != nil {
+		return err
+	}
+
+	out, err := newKubeExecCredential(cred)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(cmd.OutOrStdout()).Encode(out); err != nil {
+		return fmt.Errorf("failed to encode JSON: %v", err)
+	}
+	return nil
+}
+
+func newKubeExecCredential(cred *kc.Credential) (*kubeExecCredential, error) {
+	status := kubeExecCredentialStatus{
+		Token:                 cred.Fields[kubeTokenField],
+		ClientCertificateData: cred.Fields[kubeClientCertificateField],
+		ClientKeyData:         cred.Fields[kubeClientKeyField],
+	}
+
+	if (status.ClientCertificateData == "") != (status.ClientKeyData == "") {
+		return nil, fmt.Errorf("'%s' needs both %s and %s for client certificate auth",
+			cred.Domain, kubeClientCertificateField, kubeClientKeyField)
+	}
+	if status.Token == "" && status.ClientCertificateData == "" {
+		status.Token = cred.Password.Reveal()
+	}
+	if status.Token == "" && status.ClientCertificateData == "" {
+		return nil, fmt.Errorf("'%s' has no token or client certificate", cred.Domain)
+	}
+
+	if v := cred.Fields[kubeExpirationField]; v != "" {
+		expiration, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s for '%s': expected RFC 3339 timestamp", kubeExpirationField, cred.Domain)
+		}
+		status.ExpirationTimestamp = expiration.UTC().Format(time.RFC3339)
+	}
+
+	return &kubeExecCredential{
+		APIVersion: kubeExecCredentialAPIVersion,
+		Kind:       "ExecCredential",
+		Status:     status,
+	}, nil
+}
+
+func newKubeCredentialCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &kubeCredentialCmdRunner{
+		kcManager: kcManager,
+	}
+	return &cobra.Command{
+		Use:   "kube-credential <domain>",
+		Short: "Print a Kubernetes ExecCredential for kubectl",
+		Long: `Print stored cluster credentials as a client.authentication.k8s.io/v1
+ExecCredential, for use as a kubectl exec credential plugin.
+
+A bearer token is read from the kube_token field, falling back to the
+entry's password. For client certificate auth, store the PEM data in the
+kube_client_certificate_data and kube_client_key_data fields. Short-lived
+tokens can set kube_expiration (RFC 3339) so kubectl asks again in time.
+
+Examples:
+  passkc set k8s-prod admin                # Password is the bearer token
+  passkc kube-credential k8s-prod          # Print the ExecCredential JSON
+
+In your kubeconfig:
+  users:
+  - name: prod-admin
+    user:
+      exec:
+        apiVersion: client.authentication.k8s.io/v1
+        command: passkc
+        args: ["kube-credential", "k8s-prod"]
+        interactiveMode: Never`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeDomain(kcManager),
+		RunE:              runner.run,
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(newKubeCredentialCmd(&LiveKeychainManager{}))
+}
@@ -0,0 +1,206 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/e6a5/passkc/audit"
+	"github.com/e6a5/passkc/format"
+	"github.com/spf13/cobra"
+)
+
+type logFilter struct {
+	domain  string
+	action  string
+	command string
+	since   time.Time
+}
+
+func (f logFilter) match(e audit.Entry) bool {
+	if f.domain != "" && !strings.EqualFold(e.Domain, f.domain) {
+		return false
+	}
+	if f.action != "" && e.Action != f.action {
+		return false
+	}
+	if f.command != "" && !strings.Contains(e.Command, f.command) {
+		return false
+	}
+	return f.since.IsZero() || !e.Time.Before(f.since)
+}
+
+// parseSince accepts a duration back from now ("24h") or a date or time
+// ("2024-01-31", RFC 3339).
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since '%s': use a duration like 24h or a date like 2024-01-31", value)
+}
+
+// auditColumns are the columns of an audit.Entry record.
+var auditColumns = []string{"seq", "time", "action", "domain", "username", "command", "pid", "ppid", "parent", "success", "error", "mac"}
+
+func runLog(cmd *cobra.Command, args []string) error {
+	outputFormat, err := checkOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	since, _ := cmd.Flags().GetString("since")
+
+	filter := logFilter{}
+	filter.domain, _ = cmd.Flags().GetString("domain")
+	filter.action, _ = cmd.Flags().GetString("action")
+	filter.command, _ = cmd.Flags().GetString("command")
+
+	if filter.since, err = parseSince(since, time.Now()); err != nil {
+		return err
+	}
+
+	path, err := logPath(cmd)
+	if err != nil {
+		return err
+	}
+	entries, err := audit.Read(path)
+	if err != nil {
+		return err
+	}
+
+	matched := make([]audit.Entry, 0)
+	for _, e := range entries {
+		if filter.match(e) {
+			matched = append(matched, e)
+		}
+	}
+
+	if outputFormat != "text" {
+		records := make([]any, 0, len(matched))
+		for _, e := range matched {
+			records = append(records, e)
+		}
+		return writeRecords(cmd, records, format.Options{
+			List:       true,
+			Columns:    []string{"time", "action", "domain", "username", "command", "success"},
+			AllColumns: auditColumns,
+		})
+	}
+
+	for _, e := range matched {
+		target := e.Domain
+		if e.Username != "" {
+			target = e.Username + "@" + e.Domain
+		}
+		result := "ok"
+		if !e.Success {
+			result = "failed: " + e.Error
+		}
+		cmd.Printf("%s  %-7s %s  by '%s' from %s[%d]  %s\n",
+			e.Time.Local().Format(time.DateTime), e.Action, target, e.Command, e.Parent, e.PPID, result)
+	}
+	return nil
+}
+
+func runLogVerify(cmd *cobra.Command, args []string) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	path, err := logPath(cmd)
+	if err != nil {
+		return err
+	}
+	key, err := auditStore.Key()
+	if err != nil {
+		return err
+	}
+	if err := audit.Verify(path, key, auditStore); err != nil {
+		return fmt.Errorf("audit log has been tampered with: %v", err)
+	}
+
+	if !quiet {
+		cmd.Printf("✓ Audit log intact\n")
+	}
+	return nil
+}
+
+// logPath returns the audit log selected by the config file.
+func logPath(cmd *cobra.Command) (string, error) {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return "", err
+	}
+	return audit.ConfigPath(cfg.Audit)
+}
+
+func newLogCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "log",
+		Short: "Show the credential access log",
+		Long: `Show who read or changed stored credentials.
+
+Every get, set, modify, remove and export is appended to an audit log
+with the entry touched, the passkc command, the parent process and
+whether it succeeded. Entries are chained with HMACs keyed from the
+keychain, so 'passkc log verify' detects edited, removed or truncated
+entries.
+
+The log lives in your user config directory unless the config file sets
+audit.path, and can be turned off with audit.disabled.
+
+Examples:
+  passkc log                              # Everything
+  passkc log --domain github.com          # One entry
+  passkc log --action get --since 24h     # Reads in the last day
+  passkc log --command aws-credentials    # Accesses by one command
+  passkc log verify                       # Check the log for tampering`,
+		Args: cobra.NoArgs,
+		RunE: runLog,
+	}
+	cmd.Flags().String("domain", "", "Only show accesses to this domain")
+	cmd.Flags().String("action", "", "Only show this action (get|set|modify|remove|export)")
+	cmd.Flags().String("command", "", "Only show accesses by commands containing this text")
+	cmd.Flags().String("since", "", "Only show accesses since a duration ago or a date")
+	_ = cmd.RegisterFlagCompletionFunc("action", completeFixed("get", "set", "modify", "remove", "export"))
+	addColumnsFlag(cmd, auditColumns)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "verify",
+		Short: "Check the access log for tampering",
+		Args:  cobra.NoArgs,
+		RunE:  runLogVerify,
+	})
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(newLogCmd())
+}
@@ -22,8 +22,6 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"os"
-
 	"github.com/e6a5/passkc/kc"
 	"github.com/spf13/cobra"
 )
@@ -32,7 +30,7 @@ type modifyCmdRunner struct {
 	kcManager KeychainManager
 }
 
-func (r *modifyCmdRunner) run(cmd *cobra.Command, args []string) {
+func (r *modifyCmdRunner) run(cmd *cobra.Command, args []string) error {
 	if len(args) < 2 {
 		cmd.PrintErrf("Usage: passkc modify <domain> <new-username>\n\n")
 		cmd.PrintErrf("Examples:\n")
@@ -41,7 +39,7 @@ func (r *modifyCmdRunner) run(cmd *cobra.Command, args []string) {
 		cmd.PrintErrf("\nNote: This will prompt for a new password.\n")
 		cmd.PrintErrf("To keep the same password, use: passkc set <domain> <username>\n")
 		cmd.PrintErrf("\nFor more help: passkc modify --help\n")
-		os.Exit(1)
+		return &usageError{msg: "domain and new username are required"}
 	}
 
 	domain := args[0]
@@ -49,20 +47,23 @@ func (r *modifyCmdRunner) run(cmd *cobra.Command, args []string) {
 	quiet, _ := cmd.Flags().GetBool("quiet")
 
 	// Validate inputs
-	if err := kc.ValidateDomain(domain); err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+	domain, err := kc.NormalizeDomain(domain)
+	if err != nil {
+		return err
 	}
 	if err := kc.ValidateUsername(newUsername); err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+		return err
+	}
+
+	domain, err = resolveExactDomain(r.kcManager, domain)
+	if err != nil {
+		return err
 	}
 
 	// Check if credentials exist first
-	_, err := r.kcManager.GetData(domain)
+	_, err = r.kcManager.GetData(domain)
 	if err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 
 	// Show what we're changing
@@ -71,15 +72,15 @@ func (r *modifyCmdRunner) run(cmd *cobra.Command, args []string) {
 	}
 
 	// We use SetData which will prompt for a password and update if the item exists
-	err = r.kcManager.SetData(domain, newUsername, "")
+	err = r.kcManager.SetData(domain, newUsername, kc.Secret{})
 	if err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 
 	if !quiet {
 		cmd.Printf("✓ Updated credentials for %s\n", domain)
 	}
+	return nil
 }
 
 func newModifyCmd(kcManager KeychainManager) *cobra.Command {
@@ -103,8 +104,9 @@ Examples:
   
 Tip: To change only the password, use:
   passkc set github.com existing-username`,
-		Args: cobra.ExactArgs(2),
-		Run:  runner.run,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeDomainUsername(kcManager),
+		RunE:              runner.run,
 	}
 }
 
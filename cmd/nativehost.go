@@ -0,0 +1,374 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/spf13/cobra"
+)
+
+const (
+	nativeHostName = "com.passkc.native_host"
+	// Browsers never send more than this in practice; anything larger is
+	// a framing error rather than a real request.
+	maxNativeMessageSize = 1 << 20
+)
+
+// nativeRequest is a message from the browser extension.
+type nativeRequest struct {
+	ID       string    `json:"id,omitempty"`
+	Type     string    `json:"type"`
+	URL      string    `json:"url,omitempty"`
+	Origin   string    `json:"origin,omitempty"`
+	Username string    `json:"username,omitempty"`
+	Password kc.Secret `json:"password,omitempty"`
+}
+
+// nativeResponse is the reply sent back to the extension.
+type nativeResponse struct {
+	ID          string                   `json:"id,omitempty"`
+	OK          bool                     `json:"ok"`
+	Error       string                   `json:"error,omitempty"`
+	Credentials []*kc.RevealedCredential `json:"credentials,omitempty"`
+	Usernames   []string                 `json:"usernames,omitempty"`
+}
+
+type nativeHostCmdRunner struct {
+	kcManager KeychainManager
+}
+
+func (r *nativeHostCmdRunner) run(cmd *cobra.Command, args []string) error {
+	// Browsers pass the calling extension as arguments; access is already
+	// restricted by the allowed origins in the host manifest.
+	return r.serve(cmd.InOrStdin(), cmd.OutOrStdout())
+}
+
+// serve answers length-prefixed JSON requests until the browser closes stdin.
+func (r *nativeHostCmdRunner) serve(in io.Reader, out io.Writer) error {
+	for {
+		var req nativeRequest
+		err := readNativeMessage(in, &req)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp := r.handle(&req)
+		resp.ID = req.ID
+		if err := writeNativeMessage(out, resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *nativeHostCmdRunner) handle(req *nativeRequest) *nativeResponse {
+	switch req.Type {
+	case "lookup":
+		creds, err := r.lookup(req.URL, true)
+		if err != nil {
+			return &nativeResponse{Error: err.Error()}
+		}
+		revealed := make([]*kc.RevealedCredential, 0, len(creds))
+		for i := range creds {
+			revealed = append(revealed, creds[i].Reveal())
+		}
+		return &nativeResponse{OK: true, Credentials: revealed}
+	case "list":
+		origin := req.Origin
+		if origin == "" {
+			origin = req.URL
+		}
+		creds, err := r.lookup(origin, false)
+		if err != nil {
+			return &nativeResponse{Error: err.Error()}
+		}
+		usernames := make([]string, 0, len(creds))
+		for _, cred := range creds {
+			usernames = append(usernames, cred.Username)
+		}
+		return &nativeResponse{OK: true, Usernames: usernames}
+	case "save":
+		if err := r.save(req); err != nil {
+			return &nativeResponse{Error: err.Error()}
+		}
+		return &nativeResponse{OK: true}
+	default:
+		return &nativeResponse{Error: fmt.Sprintf("unknown request type '%s'", req.Type)}
+	}
+}
+
+// lookup returns the stored credentials for the site at rawURL. An entry
+// for a parent domain also matches, so github.com serves login.github.com.
+func (r *nativeHostCmdRunner) lookup(rawURL string, withPassword bool) ([]kc.Credential, error) {
+	host, err := hostFromURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := r.kcManager.ListData()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]kc.Credential, 0)
+	for _, cred := range all {
+		if host != cred.Domain && !strings.HasSuffix(host, "."+cred.Domain) {
+			continue
+		}
+		if withPassword {
+			full, err := r.kcManager.GetAccount(cred.Domain, cred.Username)
+			if err != nil {
+				return nil, err
+			}
+			cred = *full
+		}
+		matches = append(matches, cred)
+	}
+
+	// Prefer the most specific domain
+	sort.SliceStable(matches, func(i, j int) bool {
+		return len(matches[i].Domain) > len(matches[j].Domain)
+	})
+	return matches, nil
+}
+
+func (r *nativeHostCmdRunner) save(req *nativeRequest) error {
+	host, err := hostFromURL(req.URL)
+	if err != nil {
+		return err
+	}
+	if err := kc.ValidateUsername(req.Username); err != nil {
+		return err
+	}
+	if req.Password.IsEmpty() {
+		// An empty password would make SetData prompt on a terminal nobody sees
+		return fmt.Errorf("password cannot be empty")
+	}
+	return r.kcManager.SetData(host, req.Username, req.Password)
+}
+
+// hostFromURL extracts the canonical host name from a page URL or origin.
+func hostFromURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid URL '%s'", rawURL)
+	}
+	return kc.NormalizeDomain(u.Hostname())
+}
+
+// readNativeMessage reads one message framed with a native-endian uint32
+// length prefix, as browsers send them.
+func readNativeMessage(in io.Reader, v interface{}) error {
+	var size uint32
+	if err := binary.Read(in, binary.NativeEndian, &size); err != nil {
+		return err
+	}
+	if size > maxNativeMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds the %d byte limit", size, maxNativeMessageSize)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(in, data); err != nil {
+		return fmt.Errorf("failed to read message: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid message: %v", err)
+	}
+	return nil
+}
+
+func writeNativeMessage(out io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(out, binary.NativeEndian, uint32(len(data))); err != nil { // #nosec G115 -- bounded by the message size
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// nativeHostDirs maps browsers to their per-user manifest directories,
+// relative to the home directory.
+var nativeHostDirs = map[string]map[string]string{
+	"darwin": {
+		"chrome":   "Library/Application Support/Google/Chrome/NativeMessagingHosts",
+		"chromium": "Library/Application Support/Chromium/NativeMessagingHosts",
+		"brave":    "Library/Application Support/BraveSoftware/Brave-Browser/NativeMessagingHosts",
+		"edge":     "Library/Application Support/Microsoft Edge/NativeMessagingHosts",
+		"firefox":  "Library/Application Support/Mozilla/NativeMessagingHosts",
+	},
+	"linux": {
+		"chrome":   ".config/google-chrome/NativeMessagingHosts",
+		"chromium": ".config/chromium/NativeMessagingHosts",
+		"brave":    ".config/BraveSoftware/Brave-Browser/NativeMessagingHosts",
+		"edge":     ".config/microsoft-edge/NativeMessagingHosts",
+		"firefox":  ".mozilla/native-messaging-hosts",
+	},
+}
+
+type nativeHostInstallCmdRunner struct{}
+
+func (r *nativeHostInstallCmdRunner) run(cmd *cobra.Command, args []string) error {
+	browsers, _ := cmd.Flags().GetStringSlice("browser")
+	extensionID, _ := cmd.Flags().GetString("extension-id")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	if extensionID == "" {
+		return &usageError{msg: "--extension-id is required"}
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot find the passkc executable: %v", err)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("cannot find home directory: %v", err)
+	}
+
+	for _, browser := range browsers {
+		path, err := installNativeHost(home, browser, extensionID, executable)
+		if err != nil {
+			return err
+		}
+		if !quiet {
+			cmd.Printf("✓ Installed native messaging host for %s: %s\n", browser, path)
+		}
+	}
+	return nil
+}
+
+// installNativeHost writes the host manifest for one browser, along with a
+// launcher script, since browsers run the host without the native-host
+// subcommand. It returns the manifest path.
+func installNativeHost(home, browser, extensionID, executable string) (string, error) {
+	rel, ok := nativeHostDirs[runtime.GOOS][browser]
+	if !ok {
+		return "", fmt.Errorf("unsupported browser '%s' on %s", browser, runtime.GOOS)
+	}
+	dir := filepath.Join(home, rel)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("cannot create '%s': %v", dir, err)
+	}
+
+	launcher := filepath.Join(dir, nativeHostName+".sh")
+	script := fmt.Sprintf("#!/bin/sh\nexec '%s' native-host \"$@\"\n", strings.ReplaceAll(executable, "'", `'\''`))
+	if err := os.WriteFile(launcher, []byte(script), 0o700); err != nil { // #nosec G306 -- the launcher must be executable
+		return "", fmt.Errorf("cannot write '%s': %v", launcher, err)
+	}
+
+	manifest := map[string]interface{}{
+		"name":        nativeHostName,
+		"description": "passkc password manager",
+		"path":        launcher,
+		"type":        "stdio",
+	}
+	if browser == "firefox" {
+		manifest["allowed_extensions"] = []string{extensionID}
+	} else {
+		manifest["allowed_origins"] = []string{fmt.Sprintf("chrome-extension://%s/", extensionID)}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, nativeHostName+".json")
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return "", fmt.Errorf("cannot write '%s': %v", path, err)
+	}
+	return path, nil
+}
+
+func newNativeHostCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &nativeHostCmdRunner{
+		kcManager: kcManager,
+	}
+	cmd := &cobra.Command{
+		Use:   "native-host",
+		Short: "Serve a browser extension over native messaging",
+		Long: `Run as a Chrome/Firefox native messaging host so a browser extension
+can autofill from the same credentials 'passkc show' lists.
+
+Messages are JSON objects with a 4-byte length prefix on stdin/stdout.
+Supported request types:
+  {"type": "lookup", "url": "https://github.com/login"}
+      Credentials (with passwords) for the site or its parent domains
+  {"type": "list", "origin": "https://github.com"}
+      Usernames stored for the origin
+  {"type": "save", "url": "...", "username": "...", "password": "..."}
+      Store credentials for the site's host name
+
+Every reply has "ok" and, on failure, "error". An "id" in the request is
+echoed back.
+
+Register the host with your browser first:
+  passkc native-host install --extension-id <id>
+  passkc native-host install --browser firefox --extension-id passkc@example.com`,
+		Args: cobra.ArbitraryArgs,
+		RunE: runner.run,
+	}
+	cmd.AddCommand(newNativeHostInstallCmd())
+	return cmd
+}
+
+func newNativeHostInstallCmd() *cobra.Command {
+	runner := &nativeHostInstallCmdRunner{}
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Write the native messaging host manifest for your browsers",
+		Long: `Write the native messaging host manifest and launcher script so the
+browser extension with the given ID may talk to passkc.
+
+Examples:
+  passkc native-host install --extension-id abcdefghijklmnopabcdefghijklmnop
+  passkc native-host install --browser chrome,brave --extension-id abcdef...
+  passkc native-host install --browser firefox --extension-id passkc@example.com`,
+		Args: cobra.NoArgs,
+		RunE: runner.run,
+	}
+	cmd.Flags().StringSlice("browser", []string{"chrome"}, "Browsers to install for (chrome|chromium|brave|edge|firefox)")
+	cmd.Flags().String("extension-id", "", "ID of the browser extension allowed to connect")
+	_ = cmd.RegisterFlagCompletionFunc("browser", completeFixed("chrome", "chromium", "brave", "edge", "firefox"))
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(newNativeHostCmd(&LiveKeychainManager{}))
+}
@@ -0,0 +1,171 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/spf13/cobra"
+)
+
+type netrcCmdRunner struct {
+	kcManager KeychainManager
+}
+
+func (r *netrcCmdRunner) run(cmd *cobra.Command, args []string) error {
+	pattern, _ := cmd.Flags().GetString("pattern")
+	tags, _ := cmd.Flags().GetStringSlice("tag")
+	fifoPath, _ := cmd.Flags().GetString("fifo")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	content, err := r.render(pattern, tags)
+	if err != nil {
+		return err
+	}
+
+	if fifoPath == "" {
+		_, err := cmd.OutOrStdout().Write(content)
+		return err
+	}
+
+	if !quiet {
+		cmd.PrintErrf("Serving netrc on %s (press Ctrl+C to stop)\n", fifoPath)
+	}
+	return serveFIFO(fifoPath, content)
+}
+
+// render builds the netrc document for the selected credentials. Only one
+// machine entry per domain is written, as netrc has no way to choose between
+// accounts.
+func (r *netrcCmdRunner) render(pattern string, tags []string) ([]byte, error) {
+	creds, err := r.kcManager.ListData()
+	if err != nil {
+		return nil, err
+	}
+	creds = kc.FilterCredentials(creds, pattern, tags)
+	if len(creds) == 0 {
+		return nil, fmt.Errorf("%w matching the given pattern or tags", kc.ErrNotFound)
+	}
+
+	var buf bytes.Buffer
+	seen := make(map[string]bool)
+	for _, entry := range creds {
+		// netrc clients use the first machine entry, so one account per
+		// domain: the first that matched, not the keychain's first
+		if seen[entry.Domain] {
+			continue
+		}
+		seen[entry.Domain] = true
+
+		cred, err := r.kcManager.GetAccount(entry.Domain, entry.Username)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "machine %s\n  login %s\n  password %s\n\n",
+			netrcQuote(cred.Domain), netrcQuote(cred.Username), netrcQuote(cred.Password.Reveal()))
+		cred.Password.Destroy()
+	}
+	return buf.Bytes(), nil
+}
+
+// netrcQuote wraps tokens containing whitespace or quotes in double quotes,
+// which curl and Python's netrc module understand.
+func netrcQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\r\n\"\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// serveFIFO creates a named pipe at path and writes content to every reader
+// that opens it, until interrupted. The secrets never touch the disk.
+func serveFIFO(path string, content []byte) error {
+	if err := syscall.Mkfifo(path, 0o600); err != nil {
+		return fmt.Errorf("cannot create named pipe '%s': %v", path, err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		_ = os.Remove(path)
+		os.Exit(0)
+	}()
+
+	defer func() { _ = os.Remove(path) }()
+	for {
+		// Opening blocks until a reader shows up
+		fifo, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("cannot open named pipe '%s': %v", path, err)
+		}
+		_, err = fifo.Write(content)
+		closeErr := fifo.Close()
+		if err != nil && !errors.Is(err, syscall.EPIPE) {
+			return err
+		}
+		if closeErr != nil {
+			return closeErr
+		}
+	}
+}
+
+func newNetrcCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &netrcCmdRunner{
+		kcManager: kcManager,
+	}
+	cmd := &cobra.Command{
+		Use:   "netrc",
+		Short: "Render credentials as a .netrc file",
+		Long: `Print a .netrc document for tools that only understand netrc, such as
+curl, ftp and pip. Select credentials with --pattern (matched against the
+domain and username, as in 'passkc show') and/or --tag.
+
+With --fifo, passkc creates a named pipe and serves the netrc to every
+program that reads it, so no plaintext copy is ever written to disk. The
+pipe is removed when passkc is stopped.
+
+Examples:
+  passkc netrc --tag build > ~/.netrc      # Write a netrc (mind the permissions)
+  passkc netrc --pattern artifactory       # Preview the entries for one host
+  passkc netrc --tag build --fifo ~/.netrc # Serve ~/.netrc from a named pipe
+  curl --netrc-file ~/.netrc https://artifactory.example.com/`,
+		Args: cobra.NoArgs,
+		RunE: runner.run,
+	}
+	cmd.Flags().String("pattern", "", "Only include credentials whose domain or username contains this text")
+	cmd.Flags().StringSlice("tag", nil, "Only include credentials with this tag (repeatable)")
+	cmd.Flags().String("fifo", "", "Serve the netrc through a named pipe at this path")
+	_ = cmd.RegisterFlagCompletionFunc("tag", completeTag(kcManager))
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(newNetrcCmd(&LiveKeychainManager{}))
+}
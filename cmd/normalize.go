@@ -0,0 +1,150 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/spf13/cobra"
+)
+
+type normalizeCmdRunner struct {
+	kcManager KeychainManager
+}
+
+func (r *normalizeCmdRunner) run(cmd *cobra.Command, args []string) error {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	creds, err := r.kcManager.ListData()
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool, len(creds))
+	for _, cred := range creds {
+		existing[cred.Domain+"\x00"+cred.Username] = true
+	}
+
+	renamed, skipped, failed := 0, 0, 0
+	for _, cred := range creds {
+		canonical, err := kc.NormalizeDomain(cred.Domain)
+		if err != nil {
+			cmd.PrintErrf("Warning: skipping '%s': %v\n", cred.Domain, err)
+			failed++
+			continue
+		}
+		if canonical == cred.Domain {
+			continue
+		}
+		if existing[canonical+"\x00"+cred.Username] {
+			cmd.PrintErrf("Warning: skipping '%s': %s@%s already exists\n", cred.Domain, cred.Username, canonical)
+			skipped++
+			continue
+		}
+
+		if !quiet {
+			cmd.Printf("%s → %s (%s)\n", cred.Domain, canonical, cred.Username)
+		}
+		if dryRun {
+			renamed++
+			continue
+		}
+
+		if err := r.rename(cred, canonical); err != nil {
+			cmd.PrintErrf("Error: %v\n", err)
+			failed++
+			continue
+		}
+		existing[canonical+"\x00"+cred.Username] = true
+		renamed++
+	}
+
+	if !quiet {
+		switch {
+		case dryRun:
+			cmd.Printf("\n%d entries would be renamed\n", renamed)
+		case renamed == 0 && skipped == 0 && failed == 0:
+			cmd.Printf("All domains are already canonical\n")
+		default:
+			cmd.Printf("\n✓ Renamed %d entries\n", renamed)
+		}
+		if skipped > 0 {
+			cmd.Printf("Skipped %d entries that clash with existing ones; use 'passkc remove' on the duplicates\n", skipped)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d entries could not be renamed", failed)
+	}
+	return nil
+}
+
+// rename moves one account to its canonical domain. The new entry is
+// written and read back before the old one is removed.
+func (r *normalizeCmdRunner) rename(cred kc.Credential, canonical string) error {
+	full, err := r.kcManager.GetAccount(cred.Domain, cred.Username)
+	if err != nil {
+		return err
+	}
+
+	moved := *full
+	moved.Domain = canonical
+	if err := r.kcManager.SetCredential(&moved); err != nil {
+		return err
+	}
+	check, err := r.kcManager.GetAccount(canonical, cred.Username)
+	if err != nil || check == nil || !check.Password.Equal(full.Password) {
+		return fmt.Errorf("could not verify %s@%s, keeping '%s'", cred.Username, canonical, cred.Domain)
+	}
+
+	return r.kcManager.RemoveAccount(cred.Domain, cred.Username)
+}
+
+func newNormalizeCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &normalizeCmdRunner{
+		kcManager: kcManager,
+	}
+	cmd := &cobra.Command{
+		Use:   "normalize",
+		Short: "Rename stored domains to their canonical form",
+		Long: `Rename entries stored under URLs or non-canonical names, such as
+"https://GitHub.com/login" or "github.com:443", to the canonical domain
+passkc uses today ("github.com").
+
+New credentials are normalized when they are saved; this command fixes
+entries saved by older versions. Entries whose canonical name is already
+taken by the same username are left alone.
+
+Examples:
+  passkc normalize --dry-run               # Show what would be renamed
+  passkc normalize                         # Rename entries`,
+		Args: cobra.NoArgs,
+		RunE: runner.run,
+	}
+	cmd.Flags().Bool("dry-run", false, "Show what would be renamed without changing anything")
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(newNormalizeCmd(&LiveKeychainManager{}))
+}
@@ -0,0 +1,80 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"strings"
+
+	"github.com/e6a5/passkc/format"
+	"github.com/spf13/cobra"
+)
+
+// credentialColumns are the columns of a credential record, the JSON names
+// of kc.RevealedCredential.
+var credentialColumns = []string{"domain", "username", "password", "fields", "tags", "notes", "expires"}
+
+// checkOutputFormat returns the --output format, failing early for one
+// that does not exist. "text" is each command's own human-readable output;
+// every other format comes from the format package.
+func checkOutputFormat(cmd *cobra.Command) (string, error) {
+	spec, _ := cmd.Flags().GetString("output")
+	if spec == "text" {
+		return spec, nil
+	}
+	if _, err := format.New(spec); err != nil {
+		return "", &usageError{msg: err.Error()}
+	}
+	return spec, nil
+}
+
+// writeRecords writes records in the --output format. opts.Columns are
+// the defaults, replaced by --columns when it is given.
+func writeRecords(cmd *cobra.Command, records []any, opts format.Options) error {
+	spec, _ := cmd.Flags().GetString("output")
+	f, err := format.New(spec)
+	if err != nil {
+		return &usageError{msg: err.Error()}
+	}
+	if columns, _ := cmd.Flags().GetStringSlice("columns"); len(columns) > 0 {
+		opts.Columns = columns
+	}
+	return f.Format(cmd.OutOrStdout(), records, opts)
+}
+
+// addColumnsFlag adds --columns for table and csv output.
+func addColumnsFlag(cmd *cobra.Command, columns []string) {
+	cmd.Flags().StringSlice("columns", nil, "Columns for table and csv output")
+	_ = cmd.RegisterFlagCompletionFunc("columns", completeFixed(columns...))
+}
+
+// outputFormats lists the values of --output, for help and completion.
+// Formats that take an argument end in "=...".
+func outputFormats() []string {
+	names := []string{"text"}
+	for _, name := range format.Names() {
+		if strings.HasSuffix(name, "=") {
+			name += "..."
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,222 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/spf13/cobra"
+)
+
+// Assuan error codes understood by gpg-agent.
+const (
+	assuanErrCanceled       = "83886179 Operation cancelled"
+	assuanErrUnknownCommand = "536871187 Unknown IPC command"
+)
+
+type pinentryCmdRunner struct {
+	kcManager KeychainManager
+	prompt    promptFunc
+}
+
+// pinentrySession holds the state gpg-agent sets up before asking for a PIN.
+type pinentrySession struct {
+	desc    string
+	prompt  string
+	keyinfo string
+	ttyname string
+	// failed is set once gpg-agent reports a wrong passphrase, so a bad
+	// stored entry falls back to asking the user instead of looping.
+	failed bool
+}
+
+func (r *pinentryCmdRunner) run(cmd *cobra.Command, args []string) error {
+	return r.serve(cmd, cmd.InOrStdin(), cmd.OutOrStdout())
+}
+
+// serve speaks the pinentry subset of the Assuan protocol until BYE or EOF.
+func (r *pinentryCmdRunner) serve(cmd *cobra.Command, in io.Reader, out io.Writer) error {
+	w := bufio.NewWriter(out)
+	reply := func(lines ...string) error {
+		for _, line := range lines {
+			if _, err := w.WriteString(line + "\n"); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	}
+
+	if err := reply("OK Pleased to meet you"); err != nil {
+		return err
+	}
+
+	session := &pinentrySession{}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		command, arg, _ := strings.Cut(line, " ")
+		var err error
+		switch strings.ToUpper(command) {
+		case "SETDESC":
+			session.desc = assuanUnescape(arg)
+			err = reply("OK")
+		case "SETPROMPT":
+			session.prompt = assuanUnescape(arg)
+			err = reply("OK")
+		case "SETKEYINFO":
+			session.keyinfo = assuanUnescape(arg)
+			err = reply("OK")
+		case "SETERROR":
+			session.failed = true
+			err = reply("OK")
+		case "OPTION":
+			if name, value, ok := strings.Cut(arg, "="); ok && strings.TrimSpace(name) == "ttyname" {
+				session.ttyname = strings.TrimSpace(value)
+			}
+			err = reply("OK")
+		case "GETINFO":
+			err = r.getInfo(reply, arg)
+		case "GETPIN":
+			err = r.getPin(cmd, reply, session)
+		case "RESET":
+			session = &pinentrySession{}
+			err = reply("OK")
+		case "BYE":
+			return reply("OK closing connection")
+		default:
+			if strings.HasPrefix(strings.ToUpper(command), "SET") || strings.ToUpper(command) == "NOP" {
+				// Titles, button labels and timeouts mean nothing without a dialog
+				err = reply("OK")
+			} else {
+				err = reply("ERR " + assuanErrUnknownCommand)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (r *pinentryCmdRunner) getInfo(reply func(...string) error, what string) error {
+	switch what {
+	case "flavor":
+		return reply("D passkc", "OK")
+	case "pid":
+		return reply(fmt.Sprintf("D %d", os.Getpid()), "OK")
+	default:
+		return reply("OK")
+	}
+}
+
+func (r *pinentryCmdRunner) getPin(cmd *cobra.Command, reply func(...string) error, session *pinentrySession) error {
+	var pin kc.Secret
+	if !session.failed {
+		var err error
+		if pin, err = lookupPrompt(cmd, r.kcManager, session.desc, session.keyinfo); err != nil {
+			cmd.PrintErrf("Warning: %v\n", err)
+		}
+	}
+
+	if pin.IsEmpty() {
+		prompt := session.prompt
+		if prompt == "" {
+			prompt = "Passphrase:"
+		}
+		if session.desc != "" {
+			prompt = session.desc + "\n" + prompt
+		}
+		var err error
+		if pin, err = r.prompt(session.ttyname, prompt, false); err != nil || pin.IsEmpty() {
+			return reply("ERR " + assuanErrCanceled)
+		}
+	}
+
+	return reply("D "+assuanEscape(pin.Reveal()), "OK")
+}
+
+// assuanEscape percent-encodes the characters Assuan does not allow in data lines.
+func assuanEscape(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// assuanUnescape decodes %XX sequences in command arguments.
+func assuanUnescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func newPinentryCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &pinentryCmdRunner{
+		kcManager: kcManager,
+		prompt:    promptTTY,
+	}
+	return &cobra.Command{
+		Use:   "pinentry",
+		Short: "Serve gpg-agent passphrase requests from the keychain",
+		Long: `Act as a pinentry program for gpg-agent.
+
+Supports the GETPIN, SETDESC and BYE commands of the pinentry protocol
+(other settings are accepted and ignored). The description gpg-agent
+shows and the key grip are matched against the askpass mappings in the
+config file. When nothing matches, or gpg-agent reports that the stored
+passphrase was wrong, you are asked on the terminal instead.
+
+Config (~/.passkc.yaml):
+  askpass:
+    - match: "0123456789ABCDEF"          # Key grip or description text
+      domain: gpg-signing
+
+Because pinentry programs take no arguments, use a tiny wrapper script and
+point gpg-agent at it in ~/.gnupg/gpg-agent.conf:
+  pinentry-program /usr/local/bin/passkc-pinentry
+
+  #!/bin/sh
+  exec passkc pinentry`,
+		Args: cobra.NoArgs,
+		RunE: runner.run,
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(newPinentryCmd(&LiveKeychainManager{}))
+}
@@ -0,0 +1,341 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/e6a5/passkc/config"
+	"github.com/e6a5/passkc/format"
+	"github.com/e6a5/passkc/kc"
+	"github.com/spf13/cobra"
+)
+
+// The profile registry lives in the keychain. Tests replace these.
+var (
+	listProfiles  = kc.Profiles
+	createProfile = kc.CreateProfile
+	deleteProfile = kc.DeleteProfile
+)
+
+// selectProfile selects the profile from --profile, PASSKC_PROFILE or the
+// config file, in that order. Profiles other than the default must exist.
+func selectProfile(cmd *cobra.Command) error {
+	name, _ := cmd.Flags().GetString("profile")
+	if name == "" {
+		name = os.Getenv("PASSKC_PROFILE")
+	}
+	if name == "" {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		name = cfg.Profile
+	}
+	if name == "" {
+		name = kc.DefaultProfile
+	}
+
+	if err := kc.ValidateProfile(name); err != nil {
+		return &usageError{msg: err.Error()}
+	}
+	if name != kc.DefaultProfile {
+		exists, err := profileExists(name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return &usageError{msg: fmt.Sprintf("unknown profile '%s'. Create it with 'passkc profile create %s'", name, name)}
+		}
+	}
+	return kc.SetProfile(name)
+}
+
+func profileExists(name string) (bool, error) {
+	profiles, err := listProfiles()
+	if err != nil {
+		return false, err
+	}
+	for _, profile := range profiles {
+		if profile == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// inProfile runs fn with another profile selected.
+func inProfile(name string, fn func() error) error {
+	current := kc.CurrentProfile()
+	if err := kc.SetProfile(name); err != nil {
+		return err
+	}
+	defer func() { _ = kc.SetProfile(current) }()
+	return fn()
+}
+
+type profileCmdRunner struct {
+	kcManager KeychainManager
+}
+
+// profileInfo is one profile in list output.
+type profileInfo struct {
+	Name    string `json:"name"`
+	Current bool   `json:"current"`
+	Entries int    `json:"entries"`
+}
+
+func (r *profileCmdRunner) list(cmd *cobra.Command, args []string) error {
+	outputFormat, err := checkOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	profiles, err := listProfiles()
+	if err != nil {
+		return err
+	}
+	infos := make([]profileInfo, 0, len(profiles))
+	for _, name := range profiles {
+		var creds []kc.Credential
+		err := inProfile(name, func() (err error) {
+			creds, err = r.kcManager.ListData()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		infos = append(infos, profileInfo{Name: name, Current: name == kc.CurrentProfile(), Entries: len(creds)})
+	}
+
+	if outputFormat != "text" {
+		records := make([]any, 0, len(infos))
+		for _, info := range infos {
+			records = append(records, info)
+		}
+		return writeRecords(cmd, records, format.Options{
+			List:       true,
+			Columns:    []string{"name", "current", "entries"},
+			AllColumns: []string{"name", "current", "entries"},
+		})
+	}
+
+	for _, info := range infos {
+		switch {
+		case quiet:
+			cmd.Println(info.Name)
+		case info.Current:
+			cmd.Printf("* %s (%d entries)\n", info.Name, info.Entries)
+		default:
+			cmd.Printf("  %s (%d entries)\n", info.Name, info.Entries)
+		}
+	}
+	return nil
+}
+
+func (r *profileCmdRunner) create(cmd *cobra.Command, args []string) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	name := args[0]
+	if err := kc.ValidateProfile(name); err != nil {
+		return &usageError{msg: err.Error()}
+	}
+	if err := createProfile(name); err != nil {
+		return err
+	}
+	if !quiet {
+		cmd.Printf("✓ Created profile '%s'\n", name)
+		cmd.Printf("\nUse it with --profile %s, PASSKC_PROFILE=%s or 'passkc profile switch %s'\n", name, name, name)
+	}
+	return nil
+}
+
+// delete removes every entry of a profile, then the profile itself.
+func (r *profileCmdRunner) delete(cmd *cobra.Command, args []string) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	force, _ := cmd.Flags().GetBool("force")
+	name := args[0]
+	if name == kc.DefaultProfile {
+		return &usageError{msg: "the default profile cannot be deleted"}
+	}
+	exists, err := profileExists(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: profile '%s'", kc.ErrNotFound, name)
+	}
+
+	removed := 0
+	err = inProfile(name, func() error {
+		creds, err := r.kcManager.ListData()
+		if err != nil {
+			return err
+		}
+		if !force && !quiet {
+			cmd.Printf("Are you sure you want to delete profile '%s' and its %d credentials? [y/N]: ", name, len(creds))
+			scanner := bufio.NewScanner(os.Stdin)
+			if scanner.Scan() {
+				response := strings.ToLower(strings.TrimSpace(scanner.Text()))
+				if response != "y" && response != "yes" {
+					return kc.ErrCancelled
+				}
+			}
+		}
+		for _, cred := range creds {
+			if err := r.kcManager.RemoveAccount(cred.Domain, cred.Username); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := deleteProfile(name); err != nil {
+		return err
+	}
+
+	// Do not leave the config pointing at a profile that is gone
+	path, _ := cmd.Flags().GetString("config")
+	if cfg, err := config.Load(path); err == nil && cfg.Profile == name {
+		if err := config.SetProfile(path, ""); err != nil {
+			return err
+		}
+	}
+
+	if !quiet {
+		cmd.Printf("✓ Deleted profile '%s' and %d credentials\n", name, removed)
+	}
+	return nil
+}
+
+// switchTo makes a profile the default in the config file.
+func (r *profileCmdRunner) switchTo(cmd *cobra.Command, args []string) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	name := args[0]
+	if err := kc.ValidateProfile(name); err != nil {
+		return &usageError{msg: err.Error()}
+	}
+	if name != kc.DefaultProfile {
+		exists, err := profileExists(name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: profile '%s'", kc.ErrNotFound, name)
+		}
+	}
+
+	path, _ := cmd.Flags().GetString("config")
+	value := name
+	if name == kc.DefaultProfile {
+		value = ""
+	}
+	if err := config.SetProfile(path, value); err != nil {
+		return err
+	}
+	if !quiet {
+		cmd.Printf("✓ Switched to profile '%s'\n", name)
+	}
+	return nil
+}
+
+// completeProfile completes the --profile flag.
+func completeProfile(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	profiles, err := listProfiles()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeWith(profiles, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeProfileArg completes the profile argument of delete and switch.
+func completeProfileArg(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeProfile(cmd, args, toComplete)
+}
+
+func newProfileCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &profileCmdRunner{
+		kcManager: kcManager,
+	}
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Keep separate sets of credentials, such as work and personal",
+		Long: `Keep separate sets of credentials in profiles.
+
+Every command works in one profile: the one given with --profile, else
+PASSKC_PROFILE, else the profile set in the config file, else "default".
+Entries of the default profile are the ones stored before profiles
+existed. Deleting a profile removes all of its credentials.
+
+Examples:
+  passkc profile create client-a               # Start an empty profile
+  passkc --profile client-a set vpn.client-a.com me
+  PASSKC_PROFILE=client-a passkc show          # Select it for one command
+  passkc profile switch client-a               # Make it the default
+  passkc profile list                          # List profiles, * is the current one
+  passkc profile delete client-a               # Wipe it at the end of the engagement`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List profiles and how many credentials they hold",
+		Args:  cobra.NoArgs,
+		RunE:  runner.list,
+	}
+	createCmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create an empty profile",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runner.create,
+	}
+	deleteCmd := &cobra.Command{
+		Use:               "delete <name>",
+		Short:             "Delete a profile and all of its credentials",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeProfileArg,
+		RunE:              runner.delete,
+	}
+	deleteCmd.Flags().BoolP("force", "f", false, "Skip confirmation prompt")
+	switchCmd := &cobra.Command{
+		Use:               "switch <name>",
+		Short:             "Set the default profile in the config file",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeProfileArg,
+		RunE:              runner.switchTo,
+	}
+
+	cmd.AddCommand(listCmd, createCmd, deleteCmd, switchCmd)
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(newProfileCmd(&LiveKeychainManager{}))
+}
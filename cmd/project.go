@@ -0,0 +1,638 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/e6a5/passkc/config"
+	"github.com/e6a5/passkc/format"
+	"github.com/e6a5/passkc/kc"
+	"github.com/e6a5/passkc/project"
+	"github.com/e6a5/passkc/vault"
+	"github.com/spf13/cobra"
+)
+
+// allowedProjectsItem is the keychain item holding the allowed project
+// files. Keeping it in the keychain stops other programs from adding to it.
+const allowedProjectsItem = "allowed-projects"
+
+// loadAllowedProjects and saveAllowedProjects read and write the project
+// files the user has allowed. Tests replace them.
+var (
+	loadAllowedProjects = func() (project.Allowlist, error) {
+		data, err := kc.GetInternal(allowedProjectsItem)
+		if err != nil {
+			return nil, err
+		}
+		allowed := project.Allowlist{}
+		if data != nil {
+			if err := json.Unmarshal(data, &allowed); err != nil {
+				return nil, fmt.Errorf("invalid list of allowed projects: %v", err)
+			}
+		}
+		return allowed, nil
+	}
+	saveAllowedProjects = func(allowed project.Allowlist) error {
+		data, err := json.Marshal(allowed)
+		if err != nil {
+			return err
+		}
+		return kc.SetInternal(allowedProjectsItem, data)
+	}
+)
+
+// locateProject returns the project file of the working directory or its
+// parents, or nil if there is none, whether or not it is allowed.
+func locateProject(cmd *cobra.Command) (*project.Project, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	// The user's config file has the same name; it is never a project
+	skip, _ := cmd.Flags().GetString("config")
+	if skip == "" {
+		skip, _ = config.DefaultPath()
+	}
+	path, err := project.Find(dir, skip)
+	if err != nil || path == "" {
+		return nil, err
+	}
+	return project.Load(path)
+}
+
+// findProject returns the project file of the working directory or its
+// parents, or nil if there is none. A project file that has not been
+// allowed with its current contents is an error.
+func findProject(cmd *cobra.Command) (*project.Project, error) {
+	p, err := locateProject(cmd)
+	if err != nil || p == nil {
+		return p, err
+	}
+	allowed, err := loadAllowedProjects()
+	if err != nil {
+		return nil, err
+	}
+	if !allowed.Allowed(p) {
+		return nil, fmt.Errorf("%s is not allowed yet, or changed since. Review it, then run 'passkc project allow'", p.Path)
+	}
+	return p, nil
+}
+
+// projectVault returns the team vault for the project's team entries.
+func projectVault(cmd *cobra.Command, p *project.Project) (string, error) {
+	if dir := p.VaultDir(); dir != "" {
+		return dir, nil
+	}
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return "", err
+	}
+	if cfg.Team.Vault == "" {
+		return "", fmt.Errorf("%s has team entries but no vault. Set vault in it or team.vault in the config file", p.Path)
+	}
+	return cfg.Team.Vault, nil
+}
+
+// projectMappings returns the variables the project declares.
+func projectMappings(cmd *cobra.Command, p *project.Project) ([]envMapping, error) {
+	var mappings []envMapping
+	for i := range p.Entries {
+		e := &p.Entries[i]
+		base := envMapping{Domain: e.Domain, Username: e.Username, Exact: true}
+		if e.Backend == project.BackendTeam {
+			dir, err := projectVault(cmd, p)
+			if err != nil {
+				return nil, err
+			}
+			base.Vault = dir
+		} else {
+			base.Profile = p.EntryProfile(e)
+		}
+		for _, name := range e.Names() {
+			m := base
+			m.Name, m.Part = name, e.Env[name]
+			mappings = append(mappings, m)
+		}
+	}
+	return mappings, nil
+}
+
+// lookupTeamEntry decrypts an entry of a team vault.
+func lookupTeamEntry(dir, domain, username string) (*kc.Credential, error) {
+	v, err := vault.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := v.Find(domain, username)
+	if !ok {
+		return nil, fmt.Errorf("%w in the vault for '%s'", kc.ErrNotFound, domain)
+	}
+	keys, err := loadTeamKeys(false)
+	if err != nil {
+		return nil, err
+	}
+	return v.Get(entry, keys)
+}
+
+type statusCmdRunner struct {
+	kcManager KeychainManager
+}
+
+// entryStatus is one project entry in status output.
+type entryStatus struct {
+	Domain   string   `json:"domain"`
+	Username string   `json:"username,omitempty"`
+	Backend  string   `json:"backend"`
+	Profile  string   `json:"profile,omitempty"`
+	Env      []string `json:"env"`
+	Present  bool     `json:"present"`
+}
+
+func (r *statusCmdRunner) run(cmd *cobra.Command, args []string) error {
+	outputFormat, err := checkOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	p, err := findProject(cmd)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("no %s in this directory or its parents", project.FileName)
+	}
+
+	statuses, err := r.check(cmd, p)
+	if err != nil {
+		return err
+	}
+	missing := 0
+	for _, st := range statuses {
+		if !st.Present {
+			missing++
+		}
+	}
+
+	if outputFormat != "text" {
+		records := make([]any, 0, len(statuses))
+		for _, st := range statuses {
+			records = append(records, st)
+		}
+		err := writeRecords(cmd, records, format.Options{
+			List:       true,
+			Columns:    []string{"domain", "backend", "profile", "present"},
+			AllColumns: []string{"domain", "username", "backend", "profile", "env", "present"},
+		})
+		if err != nil {
+			return err
+		}
+	} else if !quiet {
+		r.print(cmd, p, statuses, missing)
+	}
+
+	if missing > 0 {
+		return fmt.Errorf("%d of %d entries missing: %w", missing, len(statuses), kc.ErrNotFound)
+	}
+	return nil
+}
+
+// check looks up every entry without reading any password.
+func (r *statusCmdRunner) check(cmd *cobra.Command, p *project.Project) ([]entryStatus, error) {
+	listed := make(map[string][]kc.Credential)
+	var teamVault *vault.Vault
+
+	statuses := make([]entryStatus, 0, len(p.Entries))
+	for i := range p.Entries {
+		e := &p.Entries[i]
+		st := entryStatus{Domain: e.Domain, Username: e.Username, Backend: e.Backend, Env: e.Names()}
+
+		if e.Backend == project.BackendTeam {
+			if teamVault == nil {
+				dir, err := projectVault(cmd, p)
+				if err != nil {
+					return nil, err
+				}
+				if teamVault, err = vault.Open(dir); err != nil {
+					return nil, err
+				}
+			}
+			_, st.Present = teamVault.Find(e.Domain, e.Username)
+			statuses = append(statuses, st)
+			continue
+		}
+
+		st.Profile = p.EntryProfile(e)
+		if st.Profile == "" {
+			st.Profile = kc.CurrentProfile()
+		}
+		creds, ok := listed[st.Profile]
+		if !ok {
+			err := inProfile(st.Profile, func() (err error) {
+				creds, err = r.kcManager.ListData()
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			listed[st.Profile] = creds
+		}
+		for _, cred := range creds {
+			if cred.Domain == e.Domain && (e.Username == "" || cred.Username == e.Username) {
+				st.Present = true
+				break
+			}
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+func (r *statusCmdRunner) print(cmd *cobra.Command, p *project.Project, statuses []entryStatus, missing int) {
+	cmd.Printf("Project: %s\n\n", p.Path)
+	for _, st := range statuses {
+		mark := "✓"
+		if !st.Present {
+			mark = "✗"
+		}
+		source := st.Backend
+		if st.Backend == project.BackendKeychain {
+			source = "profile " + st.Profile
+		}
+		account := st.Domain
+		if st.Username != "" {
+			account = st.Username + "@" + st.Domain
+		}
+		cmd.Printf("%s %s (%s): %s\n", mark, account, source, strings.Join(st.Env, ", "))
+	}
+	if missing == 0 {
+		return
+	}
+
+	cmd.Printf("\nTo add the missing entries, run 'passkc project setup', or:\n")
+	for _, st := range statuses {
+		switch {
+		case st.Present:
+		case st.Backend == project.BackendTeam:
+			cmd.Printf("  ask a vault member to run 'passkc team add %s'\n", st.Domain)
+		default:
+			profileFlag := ""
+			if st.Profile != kc.DefaultProfile {
+				profileFlag = " --profile " + st.Profile
+			}
+			cmd.Printf("  %s\n", strings.TrimSpace(fmt.Sprintf("passkc%s set %s %s", profileFlag, st.Domain, st.Username)))
+		}
+	}
+}
+
+type runCmdRunner struct {
+	kcManager KeychainManager
+}
+
+// run starts the command with the selected variables added to its
+// environment and exits with its exit status.
+func (r *runCmdRunner) run(cmd *cobra.Command, args []string) error {
+	env := &envCmdRunner{kcManager: r.kcManager}
+	vars, err := env.variables(cmd)
+	if err != nil {
+		return err
+	}
+
+	child := exec.Command(args[0], args[1:]...)
+	child.Env = os.Environ()
+	for name, value := range vars {
+		child.Env = append(child.Env, name+"="+value)
+	}
+	child.Stdin = cmd.InOrStdin()
+	child.Stdout = cmd.OutOrStdout()
+	child.Stderr = cmd.ErrOrStderr()
+
+	err = child.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return &exitStatusError{code: exitErr.ExitCode()}
+	}
+	return err
+}
+
+type projectCmdRunner struct {
+	kcManager KeychainManager
+}
+
+// projectArg loads the project file given as an argument, or the one
+// found from the working directory.
+func projectArg(cmd *cobra.Command, args []string) (*project.Project, error) {
+	if len(args) > 0 {
+		return project.Load(args[0])
+	}
+	p, err := locateProject(cmd)
+	if err == nil && p == nil {
+		err = fmt.Errorf("no %s in this directory or its parents", project.FileName)
+	}
+	return p, err
+}
+
+func (r *projectCmdRunner) allow(cmd *cobra.Command, args []string) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	p, err := projectArg(cmd, args)
+	if err != nil {
+		return err
+	}
+	allowed, err := loadAllowedProjects()
+	if err != nil {
+		return err
+	}
+	allowed.Allow(p)
+	if err := saveAllowedProjects(allowed); err != nil {
+		return err
+	}
+
+	if !quiet {
+		cmd.Printf("✓ Allowed %s to read:\n", p.Path)
+		for i := range p.Entries {
+			e := &p.Entries[i]
+			source := "team vault"
+			if e.Backend == project.BackendKeychain {
+				source = "profile " + p.EntryProfile(e)
+				if p.EntryProfile(e) == "" {
+					source = "current profile"
+				}
+			}
+			account := e.Domain
+			if e.Username != "" {
+				account = e.Username + "@" + e.Domain
+			}
+			cmd.Printf("  %s (%s): %s\n", account, source, strings.Join(e.Names(), ", "))
+		}
+	}
+	return nil
+}
+
+func (r *projectCmdRunner) deny(cmd *cobra.Command, args []string) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	var path string
+	if len(args) > 0 {
+		var err error
+		if path, err = filepath.Abs(args[0]); err != nil {
+			return err
+		}
+	} else {
+		p, err := projectArg(cmd, args)
+		if err != nil {
+			return err
+		}
+		path = p.Path
+	}
+	allowed, err := loadAllowedProjects()
+	if err != nil {
+		return err
+	}
+	if _, ok := allowed[path]; !ok {
+		return fmt.Errorf("%w: %s is not allowed", kc.ErrNotFound, path)
+	}
+	delete(allowed, path)
+	if err := saveAllowedProjects(allowed); err != nil {
+		return err
+	}
+
+	if !quiet {
+		cmd.Printf("✓ Denied %s\n", path)
+	}
+	return nil
+}
+
+// setup adds the missing keychain entries of the project, prompting for
+// whatever the project file does not say: the username, the fields its
+// variables use and the password.
+func (r *projectCmdRunner) setup(cmd *cobra.Command, args []string) error {
+	p, err := findProject(cmd)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("no %s in this directory or its parents", project.FileName)
+	}
+	status := &statusCmdRunner{kcManager: r.kcManager}
+	statuses, err := status.check(cmd, p)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(cmd.InOrStdin())
+	prompt := func(text string) (string, error) {
+		cmd.Print(text)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", kc.ErrCancelled
+		}
+		return strings.TrimSpace(scanner.Text()), nil
+	}
+
+	added, waiting := 0, 0
+	for i, st := range statuses {
+		if st.Present {
+			continue
+		}
+		e := &p.Entries[i]
+		if e.Backend == project.BackendTeam {
+			cmd.Printf("✗ %s is shared through the team vault: ask a member to run 'passkc team add %s'\n", e.Domain, e.Domain)
+			waiting++
+			continue
+		}
+
+		cred := &kc.Credential{Domain: e.Domain, Username: e.Username}
+		if cred.Username == "" {
+			if cred.Username, err = prompt(fmt.Sprintf("Username for %s: ", e.Domain)); err != nil {
+				return err
+			}
+			if err := kc.ValidateUsername(cred.Username); err != nil {
+				return err
+			}
+		}
+		for _, name := range e.Names() {
+			part := e.Env[name]
+			if part == "password" || part == "username" {
+				continue
+			}
+			if _, ok := cred.Fields[part]; ok {
+				continue
+			}
+			value, err := prompt(fmt.Sprintf("%s (field %s of %s): ", name, part, e.Domain))
+			if err != nil {
+				return err
+			}
+			if cred.Fields == nil {
+				cred.Fields = make(map[string]string)
+			}
+			cred.Fields[part] = value
+		}
+		// The password is left empty so that it is prompted for
+		err := inProfile(st.Profile, func() error {
+			return r.kcManager.SetCredential(cred)
+		})
+		if err != nil {
+			return err
+		}
+		cmd.Printf("✓ Saved %s@%s (profile %s)\n", cred.Username, cred.Domain, st.Profile)
+		added++
+	}
+
+	if waiting > 0 {
+		return fmt.Errorf("%d of %d entries still missing: %w", waiting, len(statuses), kc.ErrNotFound)
+	}
+	if added == 0 {
+		cmd.Printf("Nothing to do: every entry is present\n")
+	}
+	return nil
+}
+
+func newProjectCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &projectCmdRunner{
+		kcManager: kcManager,
+	}
+	cmd := &cobra.Command{
+		Use:   "project",
+		Short: "Allow or deny project files",
+		Long: `A project file can name any profile, domain or vault, so status, env
+and run only use project files you have allowed. Review the file, then
+allow it; if it changes, for example after a git pull, allow it again.
+
+Project files owned by another user, or writable by other users, are
+never used.
+
+Examples:
+  passkc project allow              # Allow the project file found from here
+  passkc project allow .passkc.yaml
+  passkc project setup              # Add the missing entries
+  passkc project deny               # Stop using it`,
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "allow [file]",
+		Short: "Allow a project file with its current contents",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runner.allow,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "setup",
+		Short: "Add the project's missing keychain entries, prompting for each",
+		Args:  cobra.NoArgs,
+		RunE:  runner.setup,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "deny [file]",
+		Short: "Stop using a project file",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runner.deny,
+	})
+	return cmd
+}
+
+func newStatusCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &statusCmdRunner{
+		kcManager: kcManager,
+	}
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show which credentials the current project needs and which are missing",
+		Long: `Show the credentials declared in the project file and whether each one
+is available, without reading any password.
+
+The project file is .passkc.yaml, or .passkc/project.yaml, in the current
+directory or the nearest parent that has one. Your own ~/.passkc.yaml is
+never taken for a project file.
+
+  profile: work                  # Profile for keychain entries (optional)
+  vault: ../ops-vault            # Team vault for team entries (optional;
+                                 # default .passkc/ if it holds a vault,
+                                 # else team.vault from the config file)
+  entries:
+    - domain: db.internal
+      username: app              # Optional, picks one account
+      env:
+        DB_PASSWORD: password
+        DB_USER: username
+        DB_PORT: port            # A field
+    - domain: stripe.com
+      backend: team              # keychain (default) or team
+      env:
+        STRIPE_KEY: password
+
+The exit code is 3 when an entry is missing, so CI can check it. The
+project file must be allowed first with 'passkc project allow'.
+
+Examples:
+  passkc status                  # What this project needs
+  passkc project setup           # Add what is missing
+  passkc status -o json          # For scripts
+  passkc env --write .env        # Write the project's variables
+  passkc run -- npm start        # Run with them in the environment`,
+		Args: cobra.NoArgs,
+		RunE: runner.run,
+	}
+	addColumnsFlag(cmd, []string{"domain", "username", "backend", "profile", "env", "present"})
+	return cmd
+}
+
+func newRunCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &runCmdRunner{
+		kcManager: kcManager,
+	}
+	cmd := &cobra.Command{
+		Use:   "run [flags] [--] <command> [args...]",
+		Short: "Run a command with credentials in its environment",
+		Long: `Run a command with credentials as environment variables, without
+writing them to disk.
+
+The variables are those of the project file (see 'passkc status'), or
+the ones selected with --tag and --map as for 'passkc env'. passkc exits
+with the command's exit status.
+
+Examples:
+  passkc run -- npm start                               # Variables from .passkc.yaml
+  passkc run --map PGPASSWORD=db.internal -- psql -h db.internal
+  passkc run --tag myapp -- ./deploy.sh`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runner.run,
+	}
+	// Flags after the command belong to it
+	cmd.Flags().SetInterspersed(false)
+	addEnvFlags(cmd, kcManager)
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(newProjectCmd(&LiveKeychainManager{}))
+	rootCmd.AddCommand(newStatusCmd(&LiveKeychainManager{}))
+	rootCmd.AddCommand(newRunCmd(&LiveKeychainManager{}))
+}
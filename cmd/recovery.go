@@ -0,0 +1,364 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/e6a5/passkc/shamir"
+	"github.com/e6a5/passkc/vault"
+	"github.com/skip2/go-qrcode"
+	"github.com/spf13/cobra"
+)
+
+// sharePrefix starts every recovery share code, so that codes can be found
+// in pasted card text.
+const sharePrefix = "PKCR1-"
+
+// shareCode is what one share card holds.
+type shareCode struct {
+	threshold int
+	// split identifies the recovery key the share is part of, so that
+	// cards from different splits or vaults are told apart before they
+	// are combined.
+	split [4]byte
+	share shamir.Share
+}
+
+// splitID is the split identifier of the recovery key with this recipient.
+func splitID(recipient string) [4]byte {
+	sum := sha256.Sum256([]byte(recipient))
+	return [4]byte(sum[:4])
+}
+
+// encodeShare turns a share into a code that is easy to type: base32 in
+// groups of five, with a checksum that catches typos.
+func encodeShare(c shareCode) string {
+	payload := append([]byte{byte(c.threshold)}, c.split[:]...)
+	payload = append(payload, c.share.X)
+	payload = append(payload, c.share.Y...)
+	sum := sha256.Sum256(payload)
+	payload = append(payload, sum[:4]...)
+
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(payload)
+	groups := make([]string, 0, len(encoded)/5+1)
+	for len(encoded) > 5 {
+		groups = append(groups, encoded[:5])
+		encoded = encoded[5:]
+	}
+	groups = append(groups, encoded)
+	return sharePrefix + strings.Join(groups, "-")
+}
+
+// decodeShare is the inverse of encodeShare. It ignores case, spaces and
+// dashes.
+func decodeShare(code string) (shareCode, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !strings.HasPrefix(code, sharePrefix) {
+		return shareCode{}, fmt.Errorf("not a passkc recovery share")
+	}
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.TrimPrefix(code, sharePrefix))
+
+	payload, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(code)
+	if err != nil || len(payload) < 11 {
+		return shareCode{}, fmt.Errorf("share code is damaged")
+	}
+	body, check := payload[:len(payload)-4], payload[len(payload)-4:]
+	sum := sha256.Sum256(body)
+	if !bytes.Equal(sum[:4], check) {
+		return shareCode{}, fmt.Errorf("share %d has a typo", body[5])
+	}
+	return shareCode{
+		threshold: int(body[0]),
+		split:     [4]byte(body[1:5]),
+		share:     shamir.Share{X: body[5], Y: body[6:]},
+	}, nil
+}
+
+// shareCard is the printable text for one share.
+func shareCard(vaultName string, n int, c shareCode, withQR bool) (string, error) {
+	code := encodeShare(c)
+	var b strings.Builder
+	fmt.Fprintf(&b, "passkc recovery share %d of %d\n", c.share.X, n)
+	fmt.Fprintf(&b, "Vault: %s\n", vaultName)
+	fmt.Fprintf(&b, "Any %d shares unlock the vault with 'passkc recovery combine'.\n", c.threshold)
+	fmt.Fprintf(&b, "Keep this card somewhere safe and separate from the others.\n\n")
+	if withQR {
+		qr, err := qrcode.New(code, qrcode.Medium)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(qr.ToSmallString(false))
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%s\n", code)
+	return b.String(), nil
+}
+
+func runRecoverySplit(cmd *cobra.Command, args []string) error {
+	n, _ := cmd.Flags().GetInt("shares")
+	threshold, _ := cmd.Flags().GetInt("threshold")
+	outDir, _ := cmd.Flags().GetString("out-dir")
+	noQR, _ := cmd.Flags().GetBool("no-qr")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	v, keys, err := openVault(cmd)
+	if err != nil {
+		return err
+	}
+
+	recovery, err := age.GenerateX25519Identity()
+	if err != nil {
+		return err
+	}
+	shares, err := shamir.Split([]byte(recovery.String()), n, threshold)
+	if err != nil {
+		return err
+	}
+
+	// Only switch the vault over once every card exists, so a failed
+	// write leaves the vault on its old key and the old cards working
+	vaultName := filepath.Base(filepath.Clean(v.Dir))
+	split := splitID(recovery.Recipient().String())
+	var printed strings.Builder
+	staging := ""
+	if outDir != "" {
+		if err := os.MkdirAll(outDir, 0o700); err != nil {
+			return err
+		}
+		staging, err = os.MkdirTemp(outDir, ".cards-")
+		if err != nil {
+			return err
+		}
+	}
+	for i, share := range shares {
+		code := shareCode{threshold: threshold, split: split, share: share}
+		card, err := shareCard(vaultName, n, code, !noQR && outDir == "")
+		if err != nil {
+			os.RemoveAll(staging)
+			return err
+		}
+
+		if outDir == "" {
+			if i > 0 {
+				// Form feed: one card per printed page
+				printed.WriteString("\f")
+			}
+			printed.WriteString(card)
+			continue
+		}
+
+		base := filepath.Join(staging, fmt.Sprintf("share-%d", share.X))
+		if err := os.WriteFile(base+".txt", []byte(card), 0o600); err != nil {
+			os.RemoveAll(staging)
+			return err
+		}
+		if !noQR {
+			if err := qrcode.WriteFile(encodeShare(code), qrcode.Medium, 512, base+".png"); err != nil {
+				os.RemoveAll(staging)
+				return err
+			}
+		}
+	}
+	if outDir == "" {
+		if _, err := io.WriteString(cmd.OutOrStdout(), printed.String()); err != nil {
+			return err
+		}
+	}
+
+	skipped, err := v.SetRecovery(recovery.Recipient().String(), keys)
+	if err != nil {
+		os.RemoveAll(staging)
+		return fmt.Errorf("the vault still uses its old recovery key: %w", err)
+	}
+	if len(skipped) > 0 {
+		cmd.PrintErrf("Warning: %d entries you cannot read are not recoverable yet.\n", len(skipped))
+		cmd.PrintErrf("A member who can read them should run 'passkc team reencrypt'.\n")
+	}
+
+	if outDir != "" {
+		files, err := os.ReadDir(staging)
+		if err != nil {
+			return fmt.Errorf("the vault uses the new recovery key, but its cards are still in %s: %w", staging, err)
+		}
+		for _, f := range files {
+			if err := os.Rename(filepath.Join(staging, f.Name()), filepath.Join(outDir, f.Name())); err != nil {
+				return fmt.Errorf("the vault uses the new recovery key, but its cards are still in %s: %w", staging, err)
+			}
+		}
+		os.Remove(staging)
+	}
+
+	if !quiet && outDir != "" {
+		cmd.Printf("✓ Wrote %d recovery share cards to %s (any %d unlock the vault)\n", n, outDir, threshold)
+	}
+	return nil
+}
+
+// readShareCodes collects share codes from files, or stdin if there are
+// none. Any line holding a code counts, so whole cards can be pasted.
+func readShareCodes(cmd *cobra.Command, paths []string) ([]string, error) {
+	readers := make([]io.Reader, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		readers = append(readers, bytes.NewReader(data))
+	}
+	if len(readers) == 0 {
+		readers = append(readers, cmd.InOrStdin())
+	}
+
+	codes := make([]string, 0)
+	for _, r := range readers {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if i := strings.Index(strings.ToUpper(line), sharePrefix); i >= 0 {
+				codes = append(codes, line[i:])
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func runRecoveryCombine(cmd *cobra.Command, args []string) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	dir, err := vaultDir(cmd)
+	if err != nil {
+		return err
+	}
+	v, err := vault.Open(dir)
+	if err != nil {
+		return err
+	}
+	if v.Recovery == "" {
+		return fmt.Errorf("this vault has no recovery key. Use 'passkc recovery split' to create one")
+	}
+
+	codes, err := readShareCodes(cmd, args)
+	if err != nil {
+		return err
+	}
+	// Check that the shares belong together before combining them:
+	// Combine cannot tell, and turns a mismatch into garbage
+	shares := make([]shamir.Share, 0, len(codes))
+	threshold := 0
+	for _, text := range codes {
+		code, err := decodeShare(text)
+		if err != nil {
+			return err
+		}
+		if code.split != splitID(v.Recovery) {
+			return fmt.Errorf("share %d is from another split or vault", code.share.X)
+		}
+		if threshold != 0 && code.threshold != threshold {
+			return fmt.Errorf("share %d needs %d shares but the others need %d: the card is damaged", code.share.X, code.threshold, threshold)
+		}
+		threshold = code.threshold
+		shares = append(shares, code.share)
+	}
+	if len(shares) < threshold || len(shares) < 2 {
+		return fmt.Errorf("%d shares given, %d needed", len(shares), max(threshold, 2))
+	}
+
+	secret, err := shamir.Combine(shares)
+	if err != nil {
+		return err
+	}
+	recovery, err := age.ParseX25519Identity(string(secret))
+	if err != nil || recovery.Recipient().String() != v.Recovery {
+		return fmt.Errorf("the shares do not unlock this vault: they are from another split or vault")
+	}
+
+	// Re-encrypt everything to the current members, which unlocks the
+	// vault for members added since its last admin left
+	skipped, err := v.Reencrypt(recovery)
+	if err != nil {
+		return err
+	}
+	reportSkipped(cmd, skipped)
+
+	if !quiet {
+		cmd.Printf("✓ Unlocked vault: re-encrypted %d entries to the current members\n", len(v.Entries)-len(skipped))
+	}
+	return nil
+}
+
+func newRecoveryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recovery",
+		Short: "Split a team vault's recovery key into shares, or unlock with them",
+		Long: `Protect a team vault against losing the people who can read it.
+
+'split' creates a recovery key that every entry is also encrypted to and
+splits it into share cards with Shamir's secret sharing. The key itself
+is never stored. If the members who can read some entries leave, add the
+new members, then bring any threshold of cards together and run
+'combine' to re-encrypt every entry to the current members.
+
+Running 'split' again replaces the recovery key: old cards stop working.
+
+Examples:
+  passkc recovery split --shares 5 --threshold 3 | lpr
+  passkc recovery split --shares 5 --threshold 3 --out-dir cards/
+  passkc recovery combine card-1.txt card-3.txt card-4.txt
+  passkc recovery combine          # Type or paste codes, then Ctrl-D`,
+	}
+	cmd.PersistentFlags().String("vault", "", "Vault directory (default is team.vault from the config file)")
+
+	splitCmd := &cobra.Command{
+		Use:   "split",
+		Short: "Create a recovery key and print its share cards",
+		Args:  cobra.NoArgs,
+		RunE:  runRecoverySplit,
+	}
+	splitCmd.Flags().Int("shares", 5, "Number of share cards")
+	splitCmd.Flags().Int("threshold", 3, "Number of cards needed to unlock")
+	splitCmd.Flags().String("out-dir", "", "Write share-N.txt and share-N.png cards here instead of printing")
+	splitCmd.Flags().Bool("no-qr", false, "Leave QR codes off the cards")
+
+	cmd.AddCommand(splitCmd, &cobra.Command{
+		Use:   "combine [card...]",
+		Short: "Unlock the vault with share cards",
+		RunE:  runRecoveryCombine,
+	})
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(newRecoveryCmd())
+}
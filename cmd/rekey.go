@@ -0,0 +1,314 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	"github.com/e6a5/passkc/teamkey"
+	"github.com/spf13/cobra"
+)
+
+func runRekey(cmd *cobra.Command, args []string) error {
+	rotate, _ := cmd.Flags().GetBool("rotate")
+	keepBackup, _ := cmd.Flags().GetBool("keep-backup")
+	keyfile, _ := cmd.Flags().GetString("keyfile")
+	noKeyfile, _ := cmd.Flags().GetBool("no-keyfile")
+	if keyfile != "" && noKeyfile {
+		return &usageError{msg: "--keyfile and --no-keyfile cannot be used together"}
+	}
+	if rotate && (keyfile != "" || noKeyfile || cmd.Flags().Changed("work-factor")) {
+		return &usageError{msg: "--rotate keeps the passphrase; change it in a separate rekey"}
+	}
+
+	data, err := getTeamKeyItem(teamKeyItem)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return fmt.Errorf("no team identity in the keychain. Run 'passkc team recipient' to create one")
+	}
+	keys, err := teamkey.Parse(data, unlockTeamKeys)
+	if err != nil {
+		return err
+	}
+
+	if rotate {
+		return rotateTeamKey(cmd, keys, data, keepBackup)
+	}
+	return resealTeamKeys(cmd, keys, data, keepBackup)
+}
+
+// resealTeamKeys protects the team keys with a new passphrase, work factor
+// or keyfile. The old keychain item is copied to a backup item and read
+// back before anything changes, and only removed once the new one has been
+// read back and opened with the new passphrase.
+func resealTeamKeys(cmd *cobra.Command, keys *teamkey.Keys, old []byte, keepBackup bool) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	protection, err := newProtection(cmd, keys.Protection())
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := readPassphrase("New team key passphrase (empty for none): ")
+	if err != nil {
+		return err
+	}
+	var secret string
+	if passphrase == "" {
+		if protection.Keyfile != "" {
+			return fmt.Errorf("a keyfile needs a passphrase")
+		}
+		protection = teamkey.Protection{}
+	} else {
+		confirm, err := readPassphrase("Confirm passphrase: ")
+		if err != nil {
+			return err
+		}
+		if confirm != passphrase {
+			return fmt.Errorf("passphrases do not match")
+		}
+		var contents []byte
+		if protection.Keyfile != "" {
+			if contents, err = readOrCreateKeyfile(cmd, protection.Keyfile); err != nil {
+				return err
+			}
+		}
+		secret = teamkey.Secret(passphrase, contents)
+	}
+	if err := keys.Protect(protection, secret); err != nil {
+		return err
+	}
+	sealed, err := keys.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := checkSealedKeys(sealed, keys, secret); err != nil {
+		return err
+	}
+
+	if err := setTeamKeyItem(teamKeyBackupItem, old); err != nil {
+		return err
+	}
+	backup, err := getTeamKeyItem(teamKeyBackupItem)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(backup, old) {
+		return fmt.Errorf("the backup of your team keys does not match the original; nothing was changed")
+	}
+
+	if err := setTeamKeyItem(teamKeyItem, sealed); err != nil {
+		return err
+	}
+	stored, err := getTeamKeyItem(teamKeyItem)
+	if err == nil {
+		err = checkSealedKeys(stored, keys, secret)
+	}
+	if err != nil {
+		if restoreErr := setTeamKeyItem(teamKeyItem, old); restoreErr != nil {
+			cmd.PrintErrf("Error: could not restore your team keys: %v\n", restoreErr)
+			cmd.PrintErrf("They are kept in the keychain as '%s'.\n", teamKeyBackupItem)
+		}
+		return err
+	}
+	if !keepBackup {
+		if err := removeTeamKeyItem(teamKeyBackupItem); err != nil {
+			return err
+		}
+	}
+
+	if !quiet {
+		switch {
+		case !protection.Sealed():
+			cmd.Printf("✓ Team keys are stored without a passphrase\n")
+		case protection.Keyfile != "":
+			cmd.Printf("✓ Team keys sealed with your passphrase and %s (work factor %d)\n", protection.Keyfile, protection.WorkFactor)
+		default:
+			cmd.Printf("✓ Team keys sealed with your passphrase (work factor %d)\n", protection.WorkFactor)
+		}
+		if keepBackup {
+			cmd.Printf("The previous keys are kept in the keychain as '%s'.\n", teamKeyBackupItem)
+		}
+	}
+	return nil
+}
+
+// newProtection applies --work-factor, --keyfile and --no-keyfile to the
+// current protection. Without --work-factor, keys below the default work
+// factor are upgraded to it.
+func newProtection(cmd *cobra.Command, current teamkey.Protection) (teamkey.Protection, error) {
+	workFactor, _ := cmd.Flags().GetInt("work-factor")
+	keyfile, _ := cmd.Flags().GetString("keyfile")
+	noKeyfile, _ := cmd.Flags().GetBool("no-keyfile")
+
+	protection := current
+	if !cmd.Flags().Changed("work-factor") {
+		workFactor = max(current.WorkFactor, teamkey.DefaultWorkFactor)
+	}
+	if workFactor < teamkey.MinWorkFactor || workFactor > teamkey.MaxWorkFactor {
+		return protection, &usageError{msg: fmt.Sprintf("--work-factor must be between %d and %d", teamkey.MinWorkFactor, teamkey.MaxWorkFactor)}
+	}
+	protection.WorkFactor = workFactor
+	if keyfile != "" {
+		path, err := filepath.Abs(keyfile)
+		if err != nil {
+			return protection, err
+		}
+		protection.Keyfile = path
+	}
+	if noKeyfile {
+		protection.Keyfile = ""
+	}
+	return protection, nil
+}
+
+// readOrCreateKeyfile reads a keyfile, creating it with random contents
+// if it does not exist yet.
+func readOrCreateKeyfile(cmd *cobra.Command, path string) ([]byte, error) {
+	contents, err := os.ReadFile(path)
+	if err == nil {
+		return contents, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("cannot read keyfile: %v", err)
+	}
+
+	contents = make([]byte, 32)
+	if _, err := rand.Read(contents); err != nil {
+		return nil, err
+	}
+	if err := writeSecretFile(path, contents); err != nil {
+		return nil, err
+	}
+	cmd.PrintErrf("Created keyfile %s. Keep a copy somewhere safe: without it your team keys cannot be unlocked.\n", path)
+	return contents, nil
+}
+
+// checkSealedKeys opens stored team keys with secret and checks that they
+// hold the same identities as keys.
+func checkSealedKeys(data []byte, keys *teamkey.Keys, secret string) error {
+	reopened, err := teamkey.Parse(data, func(teamkey.Protection) (string, error) { return secret, nil })
+	if err != nil {
+		return fmt.Errorf("the new team keys cannot be opened: %v", err)
+	}
+	if !reopened.Equal(keys) {
+		return fmt.Errorf("the new team keys do not match the old ones")
+	}
+	return nil
+}
+
+// rotateTeamKey replaces this user's key in the selected vault with a new
+// one. The replaced key stays in the team keys, so other vaults that
+// still encrypt to it remain readable.
+func rotateTeamKey(cmd *cobra.Command, keys *teamkey.Keys, old []byte, keepBackup bool) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	v, err := openVaultIndex(cmd)
+	if err != nil {
+		return err
+	}
+	var oldIdentity *age.X25519Identity
+	for _, m := range v.Members {
+		if identity, ok := keys.Find(m.Recipient); ok {
+			oldIdentity = identity
+		}
+	}
+	if oldIdentity == nil {
+		return fmt.Errorf("your key is not a member of this vault")
+	}
+
+	// Store the new key before the vault needs it
+	if err := keys.Rotate(); err != nil {
+		return err
+	}
+	if err := storeTeamKeys(keys); err != nil {
+		return err
+	}
+	if err := v.Rekey(oldIdentity, keys.Current, keepBackup); err != nil {
+		if restoreErr := setTeamKeyItem(teamKeyItem, old); restoreErr != nil {
+			cmd.PrintErrf("Error: could not restore your previous team keys: %v\n", restoreErr)
+		}
+		return err
+	}
+
+	if !quiet {
+		cmd.Printf("✓ Re-keyed %s: your new public key is\n  %s\n", v.Dir, keys.Current.Recipient().String())
+		if keepBackup {
+			cmd.Printf("The old entries are in entries.bak until you delete them.\n")
+		}
+		cmd.Printf("Commit the vault so other members pick up your new key.\n")
+	}
+	return nil
+}
+
+func newRekeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "Change the passphrase on your team keys, or replace your vault key",
+		Long: `Re-seal the team keys kept in your keychain with a new passphrase,
+optionally combined with a keyfile, or replace your key in a team vault.
+
+By default rekey asks for a new passphrase and derives a new key from
+it with scrypt. --work-factor tunes scrypt's cost (each step doubles
+it); keys below the default are upgraded automatically, so run rekey
+again as hardware gets faster. With --keyfile, unlocking needs both the
+passphrase and the file, which is created if it does not exist. The old
+keys are copied to a backup item and checked before anything changes,
+and the backup is only removed once the new keys have been read back
+and opened with the new passphrase.
+
+With --rotate, a new key is generated and every vault entry you can
+read is re-encrypted to it. The entries are written to a staging
+directory and each one is checked to decrypt with the new key before the
+old entries are swapped out. Your replaced key is kept with the new one,
+so other vaults that still use it stay readable. Anyone holding the old
+key can still read old copies of the entries, for example from git
+history: rotate those passwords too.
+
+Examples:
+  passkc rekey                                 # Change your passphrase
+  passkc rekey --work-factor 20                # Make guessing it slower
+  passkc rekey --keyfile ~/.passkc.key         # Require a keyfile too
+  passkc rekey --rotate --vault ~/ops-vault    # Replace your vault key
+  passkc rekey --rotate --keep-backup          # Keep the old entries in entries.bak`,
+		Args: cobra.NoArgs,
+		RunE: runRekey,
+	}
+	cmd.Flags().Bool("rotate", false, "Replace your key in the team vault and re-encrypt its entries")
+	cmd.Flags().String("vault", "", "Vault directory for --rotate (default is team.vault from the config file)")
+	cmd.Flags().Bool("keep-backup", false, "Keep the previous keys, or with --rotate the old entries in entries.bak")
+	cmd.Flags().Int("work-factor", teamkey.DefaultWorkFactor, "scrypt work factor (log2 of N) for the new passphrase")
+	cmd.Flags().String("keyfile", "", "Also require this file to unlock the keys (created if missing)")
+	cmd.Flags().Bool("no-keyfile", false, "Stop requiring a keyfile")
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(newRekeyCmd())
+}
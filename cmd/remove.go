@@ -27,6 +27,7 @@ import (
 	"strings"
 
 	"github.com/e6a5/passkc/kc"
+	"github.com/e6a5/passkc/tui"
 	"github.com/spf13/cobra"
 )
 
@@ -34,14 +35,25 @@ type removeCmdRunner struct {
 	kcManager KeychainManager
 }
 
-func (r *removeCmdRunner) run(cmd *cobra.Command, args []string) {
+func (r *removeCmdRunner) run(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 && !r.hasStdinInput() {
+		// Let the user pick an entry when run from a terminal
+		action, cred, err := pickCredential(r.kcManager, &tui.Browser{Title: "remove"})
+		if err == nil && action != tui.ActionSelect {
+			return kc.ErrCancelled
+		}
+		if err == nil {
+			args = []string{cred.Domain}
+		}
+	}
+
 	if len(args) == 0 {
 		cmd.PrintErrf("Usage: passkc remove <domain>\n\n")
 		cmd.PrintErrf("Examples:\n")
 		cmd.PrintErrf("  passkc remove github.com                 # Remove credentials for github.com\n")
 		cmd.PrintErrf("  passkc remove github.com -q              # Remove without confirmation\n")
 		cmd.PrintErrf("\nFor more help: passkc remove --help\n")
-		os.Exit(1)
+		return &usageError{msg: "no domain given"}
 	}
 
 	domain := args[0]
@@ -49,16 +61,20 @@ func (r *removeCmdRunner) run(cmd *cobra.Command, args []string) {
 	force, _ := cmd.Flags().GetBool("force")
 
 	// Validate domain
-	if err := kc.ValidateDomain(domain); err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+	domain, err := kc.NormalizeDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	domain, err = resolveExactDomain(r.kcManager, domain)
+	if err != nil {
+		return err
 	}
 
 	// Check if credentials exist first
 	cred, err := r.kcManager.GetData(domain)
 	if err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 
 	// Confirmation prompt (unless forced or quiet)
@@ -68,21 +84,25 @@ func (r *removeCmdRunner) run(cmd *cobra.Command, args []string) {
 		if scanner.Scan() {
 			response := strings.ToLower(strings.TrimSpace(scanner.Text()))
 			if response != "y" && response != "yes" {
-				cmd.Printf("Canceled.\n")
-				return
+				return kc.ErrCancelled
 			}
 		}
 	}
 
 	err = r.kcManager.RemoveData(domain)
 	if err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 
 	if !quiet {
 		cmd.Printf("✓ Removed credentials for %s\n", domain)
 	}
+	return nil
+}
+
+func (r *removeCmdRunner) hasStdinInput() bool {
+	stat, _ := os.Stdin.Stat()
+	return (stat.Mode() & os.ModeCharDevice) == 0
 }
 
 func newRemoveCmd(kcManager KeychainManager) *cobra.Command {
@@ -100,9 +120,11 @@ By default, you'll be asked to confirm the deletion.
 Examples:
   passkc remove github.com                 # Remove with confirmation prompt
   passkc remove github.com --force         # Remove without confirmation
-  passkc remove github.com -q              # Remove quietly (no output)`,
-		Args: cobra.ExactArgs(1),
-		Run:  runner.run,
+  passkc remove github.com -q              # Remove quietly (no output)
+  passkc remove                            # Pick a domain interactively`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDomain(kcManager),
+		RunE:              runner.run,
 	}
 	cmd.Flags().BoolP("force", "f", false, "Remove without confirmation prompt")
 	return cmd
@@ -23,7 +23,10 @@ package cmd
 
 import (
 	"os"
+	"strings"
 
+	"github.com/e6a5/passkc/config"
+	"github.com/e6a5/passkc/format"
 	"github.com/spf13/cobra"
 )
 
@@ -42,7 +45,19 @@ Common usage:
 
 Advanced usage:
   passkc get github.com -q | pbcopy    # Copy password to clipboard
-  passkc show | grep google            # Search for specific sites`,
+  passkc show | grep google            # Search for specific sites
+  passkc --profile work show           # Use the credentials of another profile`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Arguments and flags have been accepted, so errors from here on
+		// are not about usage and should not print it
+		cmd.SilenceUsage = true
+		if err := selectProfile(cmd); err != nil {
+			return err
+		}
+		startAudit(cmd, args)
+		return nil
+	},
+	SilenceErrors: true,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
@@ -50,11 +65,17 @@ Advanced usage:
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Errors are printed by reportError and mapped to the documented exit codes.
 func Execute() {
-	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+	cmd, err := rootCmd.ExecuteC()
+	if err == nil {
+		return
 	}
+	if !cmd.SilenceUsage {
+		// Cobra rejected the arguments or flags before the command ran
+		err = &usageError{msg: err.Error()}
+	}
+	os.Exit(reportError(cmd, err))
 }
 
 func init() {
@@ -63,12 +84,21 @@ func init() {
 
 func initializeFlags(cmd *cobra.Command) {
 	// Global flags
-	cmd.PersistentFlags().StringP("output", "o", "text", "Output format (text|json|csv)")
+	cmd.PersistentFlags().StringP("output", "o", "text", "Output format ("+strings.Join(outputFormats(), "|")+")")
 	cmd.PersistentFlags().StringP("config", "c", "", "Config file (default is $HOME/.passkc.yaml)")
 	cmd.PersistentFlags().BoolP("quiet", "q", false, "Suppress prompts and non-essential output")
+	cmd.PersistentFlags().String("profile", "", "Profile to use (default is $PASSKC_PROFILE, then profile from the config file)")
+	_ = cmd.RegisterFlagCompletionFunc("profile", completeProfile)
+	_ = cmd.RegisterFlagCompletionFunc("output", completeFixed(append([]string{"text"}, format.Names()...)...))
 
 	// Environment variable support
 	if domain := os.Getenv("PASSKC_DEFAULT_DOMAIN"); domain != "" {
 		cmd.PersistentFlags().String("domain", domain, "Default domain to use")
 	}
 }
+
+// loadConfig reads the config file selected by the --config flag.
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	path, _ := cmd.Flags().GetString("config")
+	return config.Load(path)
+}
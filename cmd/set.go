@@ -23,7 +23,11 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"strings"
 
@@ -35,29 +39,25 @@ type setCmdRunner struct {
 	kcManager KeychainManager
 }
 
-func (r *setCmdRunner) run(cmd *cobra.Command, args []string) {
+func (r *setCmdRunner) run(cmd *cobra.Command, args []string) error {
 	filePath, _ := cmd.Flags().GetString("file")
 	quiet, _ := cmd.Flags().GetBool("quiet")
 
 	if filePath != "" {
-		r.handleFileInput(cmd, filePath, quiet)
-		return
+		return r.handleFileInput(cmd, filePath, quiet)
 	}
 
 	if len(args) >= 2 {
-		r.handleDirectInput(cmd, args[0], args[1], quiet)
-		return
+		return r.handleDirectInput(cmd, args[0], args[1], quiet)
 	}
 
 	if len(args) == 1 {
-		r.handleInteractiveInput(cmd, args[0], quiet)
-		return
+		return r.handleInteractiveInput(cmd, args[0], quiet)
 	}
 
 	// No arguments provided - try stdin or show usage
 	if r.hasStdinInput() {
-		r.handleStdinInput(cmd, quiet)
-		return
+		return r.handleStdinInput(cmd, quiet)
 	}
 
 	// Show helpful usage message
@@ -67,74 +67,124 @@ func (r *setCmdRunner) run(cmd *cobra.Command, args []string) {
 	cmd.PrintErrf("  passkc set github.com myusername         # Password prompt only\n")
 	cmd.PrintErrf("  passkc set -f credentials.txt            # Import from file\n")
 	cmd.PrintErrf("\nFor more help: passkc set --help\n")
-	os.Exit(1)
+	return &usageError{msg: "no domain given"}
 }
 
-func (r *setCmdRunner) handleDirectInput(cmd *cobra.Command, domain, username string, quiet bool) {
+func (r *setCmdRunner) handleDirectInput(cmd *cobra.Command, domain, username string, quiet bool) error {
 	// Validate inputs
-	if err := kc.ValidateDomain(domain); err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+	domain, err := kc.NormalizeDomain(domain)
+	if err != nil {
+		return err
 	}
 	if err := kc.ValidateUsername(username); err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 
-	if err := r.kcManager.SetData(domain, username, ""); err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+	if err := r.save(cmd, domain, username); err != nil {
+		return err
 	}
 
 	if !quiet {
 		cmd.Printf("✓ Saved credentials for %s@%s\n", username, domain)
 	}
+	return nil
 }
 
-func (r *setCmdRunner) handleInteractiveInput(cmd *cobra.Command, domain string, quiet bool) {
+func (r *setCmdRunner) handleInteractiveInput(cmd *cobra.Command, domain string, quiet bool) error {
 	// Validate domain
-	if err := kc.ValidateDomain(domain); err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+	domain, err := kc.NormalizeDomain(domain)
+	if err != nil {
+		return err
 	}
 
 	// Interactive username prompt
 	fmt.Printf("Username for %s: ", domain)
 	scanner := bufio.NewScanner(os.Stdin)
 	if !scanner.Scan() {
-		cmd.PrintErrf("Error: failed to read username\n")
-		os.Exit(1)
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read username: %v", err)
+		}
+		return kc.ErrCancelled
 	}
 
 	username := strings.TrimSpace(scanner.Text())
 	if err := kc.ValidateUsername(username); err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 
-	if err := r.kcManager.SetData(domain, username, ""); err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+	if err := r.save(cmd, domain, username); err != nil {
+		return err
 	}
 
 	if !quiet {
 		cmd.Printf("✓ Saved credentials for %s@%s\n", username, domain)
 	}
+	return nil
 }
 
-func (r *setCmdRunner) handleFileInput(cmd *cobra.Command, filePath string, quiet bool) {
-	file, err := os.Open(filePath)
+// save stores the credential, prompting for the password. Fields given
+// with --field are added to the stored ones, and --tag replaces the tags;
+// everything else stored for the account is kept.
+func (r *setCmdRunner) save(cmd *cobra.Command, domain, username string) error {
+	fieldArgs, _ := cmd.Flags().GetStringArray("field")
+	tags, _ := cmd.Flags().GetStringSlice("tag")
+	if len(fieldArgs) == 0 && len(tags) == 0 {
+		return r.kcManager.SetData(domain, username, kc.Secret{})
+	}
+
+	fields, err := parseFields(fieldArgs)
+	if err != nil {
+		return err
+	}
+	cred, err := r.kcManager.GetAccount(domain, username)
+	if errors.Is(err, kc.ErrNotFound) {
+		cred, err = &kc.Credential{Domain: domain, Username: username}, nil
+	}
 	if err != nil {
-		cmd.PrintErrf("Error: cannot open file '%s': %v\n", filePath, err)
-		os.Exit(1)
+		return err
+	}
+	// The password is asked for again, like without flags
+	cred.Password.Destroy()
+	cred.Password = kc.Secret{}
+	if len(fields) > 0 {
+		if cred.Fields == nil {
+			cred.Fields = make(map[string]string, len(fields))
+		}
+		maps.Copy(cred.Fields, fields)
+	}
+	if len(tags) > 0 {
+		cred.Tags = tags
+	}
+	return r.kcManager.SetCredential(cred)
+}
+
+// parseFields turns repeated name=value arguments into a field map.
+func parseFields(args []string) (map[string]string, error) {
+	if len(args) == 0 {
+		return nil, nil
 	}
-	defer func() {
-		if closeErr := file.Close(); closeErr != nil {
-			cmd.PrintErrf("Warning: failed to close file: %v\n", closeErr)
+	fields := make(map[string]string, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid field '%s'. Expected: name=value", arg)
 		}
-	}()
+		fields[name] = value
+	}
+	return fields, nil
+}
 
-	scanner := bufio.NewScanner(file)
+func (r *setCmdRunner) handleFileInput(cmd *cobra.Command, filePath string, quiet bool) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("cannot open file '%s': %v", filePath, err)
+	}
+	if isStructuredInput(data) {
+		return r.importRecords(cmd, data, false, quiet)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	lineNum := 0
 	successCount := 0
 
@@ -153,11 +203,15 @@ func (r *setCmdRunner) handleFileInput(cmd *cobra.Command, filePath string, quie
 			continue
 		}
 
-		domain := parts[0]
+		domain, err := kc.NormalizeDomain(parts[0])
+		if err != nil {
+			cmd.PrintErrf("Warning: skipping line %d: %v\n", lineNum, err)
+			continue
+		}
 		username := parts[1]
-		password := ""
+		var password kc.Secret
 		if len(parts) > 2 {
-			password = parts[2]
+			password = kc.NewSecretString(parts[2])
 		}
 
 		if err := r.kcManager.SetData(domain, username, password); err != nil {
@@ -173,31 +227,121 @@ func (r *setCmdRunner) handleFileInput(cmd *cobra.Command, filePath string, quie
 	if !quiet {
 		cmd.Printf("\nImported %d credentials successfully\n", successCount)
 	}
+	return nil
 }
 
-func (r *setCmdRunner) handleStdinInput(cmd *cobra.Command, quiet bool) {
-	scanner := bufio.NewScanner(os.Stdin)
+func (r *setCmdRunner) handleStdinInput(cmd *cobra.Command, quiet bool) error {
+	data, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read stdin: %v", err)
+	}
+	if isStructuredInput(data) {
+		return r.importRecords(cmd, data, true, quiet)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	if scanner.Scan() {
 		parts := strings.Fields(scanner.Text())
 		if len(parts) >= 2 {
-			domain := parts[0]
+			domain, err := kc.NormalizeDomain(parts[0])
+			if err != nil {
+				return err
+			}
 			username := parts[1]
-			password := ""
+			var password kc.Secret
 			if len(parts) > 2 {
-				password = parts[2]
+				password = kc.NewSecretString(parts[2])
 			}
 			if err := r.kcManager.SetData(domain, username, password); err != nil {
-				cmd.PrintErrf("Error: %v\n", err)
-				os.Exit(1)
+				return err
 			}
 			if !quiet {
 				cmd.Printf("✓ Saved credentials for %s@%s\n", username, domain)
 			}
 		} else {
-			cmd.PrintErrf("Error: invalid input format. Expected: domain username [password]\n")
-			os.Exit(1)
+			return fmt.Errorf("invalid input format. Expected: domain username [password]")
 		}
 	}
+	return nil
+}
+
+// importRecords saves JSON credential records. Nothing is saved unless
+// every record is valid. A record replaces what is stored for its domain
+// and username, except that a missing or redacted part keeps the stored
+// one; a new credential without a password is prompted for, or
+// is an error when the records come from stdin.
+func (r *setCmdRunner) importRecords(cmd *cobra.Command, data []byte, fromStdin, quiet bool) error {
+	records, errs := parseRecords(data)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			cmd.PrintErrf("Error on %v\n", err)
+		}
+		return &usageError{msg: fmt.Sprintf("%d invalid records, nothing imported", len(errs))}
+	}
+
+	var firstErr error
+	failed := 0
+	for _, rec := range records {
+		cred := rec.cred
+		err := r.completeRecord(&cred, fromStdin)
+		if err == nil {
+			err = r.kcManager.SetCredential(&cred)
+		}
+		if err != nil {
+			err = &recordError{line: rec.line, err: err}
+			cmd.PrintErrf("Error on %v\n", err)
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if !quiet {
+			cmd.Printf("✓ Saved credentials for %s@%s\n", cred.Username, cred.Domain)
+		}
+	}
+
+	if !quiet {
+		cmd.Printf("\nImported %d credentials successfully\n", len(records)-failed)
+	}
+	if firstErr != nil {
+		return fmt.Errorf("%d of %d records failed: %w", failed, len(records), firstErr)
+	}
+	return nil
+}
+
+// completeRecord fills in the password, fields, tags, notes and expiry a
+// record leaves out from what is already stored.
+func (r *setCmdRunner) completeRecord(cred *kc.Credential, fromStdin bool) error {
+	if !cred.Password.IsEmpty() && cred.Fields != nil && cred.Tags != nil && cred.Notes != "" && !cred.Expires.IsZero() {
+		return nil
+	}
+	stored, err := r.kcManager.GetAccount(cred.Domain, cred.Username)
+	if errors.Is(err, kc.ErrNotFound) {
+		if cred.Password.IsEmpty() && fromStdin {
+			return fmt.Errorf("no password given for new credential %s@%s", cred.Username, cred.Domain)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if cred.Password.IsEmpty() {
+		cred.Password = stored.Password
+	}
+	if cred.Fields == nil {
+		cred.Fields = stored.Fields
+	}
+	if cred.Tags == nil {
+		cred.Tags = stored.Tags
+	}
+	if cred.Notes == "" {
+		cred.Notes = stored.Notes
+	}
+	if cred.Expires.IsZero() {
+		cred.Expires = stored.Expires
+	}
+	return nil
 }
 
 func (r *setCmdRunner) hasStdinInput() bool {
@@ -221,15 +365,33 @@ Examples:
   passkc set github.com                    # Interactive: prompts for username and password
   passkc set github.com myusername         # Prompts for password only
   passkc set -f credentials.txt            # Import multiple credentials from file
+  passkc get a.com b.com -o json | passkc set  # Import JSON or NDJSON records
+  passkc set aws-prod AKIA... --field aws_session_token=...  # Store extra fields
+  passkc set db.internal app --tag myapp   # Tag credentials for filtering
 
 File format (one per line):
   domain username [password]
   github.com user1 pass123
-  google.com user2`,
-		Args: cobra.RangeArgs(0, 2),
-		Run:  runner.run,
+  google.com user2
+
+JSON input, on stdin or with -f, is an array of credential objects or one
+object per line (NDJSON), as printed by get and show with -o json:
+  {"version": 1, "domain": "github.com", "username": "user1",
+   "password": "pass 123", "fields": {"otp": "..."}, "tags": ["work"],
+   "notes": "...", "expires": "2027-01-01T00:00:00Z"}
+
+Every record is validated before anything is saved, and errors give the
+line the record starts on. Anything a record leaves out, or lists in
+"redacted" as -o json output does, keeps what is already stored for that
+account; "tags": [] clears the tags.`,
+		Args:              cobra.RangeArgs(0, 2),
+		ValidArgsFunction: completeDomainUsername(kcManager),
+		RunE:              runner.run,
 	}
-	cmd.Flags().StringP("file", "f", "", "Import credentials from file")
+	cmd.Flags().StringP("file", "f", "", "Import credentials from a text or JSON file")
+	cmd.Flags().StringArray("field", nil, "Store an extra field with the credential (name=value, repeatable)")
+	cmd.Flags().StringSlice("tag", nil, "Tag the credential, replacing its tags (repeatable)")
+	_ = cmd.RegisterFlagCompletionFunc("tag", completeTag(kcManager))
 	return cmd
 }
 
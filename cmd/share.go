@@ -0,0 +1,313 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/e6a5/passkc/bundle"
+	"github.com/e6a5/passkc/kc"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// readPassphrase prompts for a bundle passphrase on the terminal. Tests
+// replace it.
+var readPassphrase = func(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %v", err)
+	}
+	return string(passphrase), nil
+}
+
+type shareCmdRunner struct {
+	kcManager KeychainManager
+}
+
+// shareRecipient parses --to: an age public key, or "passphrase" to prompt
+// for one.
+func shareRecipient(to string) (age.Recipient, error) {
+	if to != "passphrase" {
+		recipient, err := age.ParseX25519Recipient(to)
+		if err != nil {
+			return nil, fmt.Errorf("--to must be an age recipient (age1...) or 'passphrase': %v", err)
+		}
+		return recipient, nil
+	}
+
+	passphrase, err := readPassphrase("Bundle passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+	confirm, err := readPassphrase("Confirm passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if confirm != passphrase {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return age.NewScryptRecipient(passphrase)
+}
+
+func (r *shareCmdRunner) share(cmd *cobra.Command, args []string) error {
+	to, _ := cmd.Flags().GetString("to")
+	outPath, _ := cmd.Flags().GetString("output")
+	expires, _ := cmd.Flags().GetDuration("expires")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	domain, err := kc.NormalizeDomain(args[0])
+	if err != nil {
+		return err
+	}
+	domain, err = resolveDomain(r.kcManager, domain)
+	if err != nil {
+		return err
+	}
+
+	var cred *kc.Credential
+	if len(args) > 1 {
+		cred, err = r.kcManager.GetAccount(domain, args[1])
+	} else {
+		cred, err = r.kcManager.GetData(domain)
+	}
+	if err != nil {
+		return err
+	}
+
+	recipient, err := shareRecipient(to)
+	if err != nil {
+		return err
+	}
+	b := bundle.New(cred, expires, time.Now())
+
+	// Without a file, write armored text that can be pasted
+	if outPath == "" || outPath == "-" {
+		return bundle.Seal(cmd.OutOrStdout(), b, recipient, true)
+	}
+
+	f, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	err = bundle.Seal(f, b, recipient, false)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if !quiet {
+		cmd.Printf("✓ Wrote %s@%s to %s", cred.Username, cred.Domain, outPath)
+		if b.Expires != nil {
+			cmd.Printf(" (expires %s)", b.Expires.Local().Format(time.DateTime))
+		}
+		cmd.Printf("\n")
+	}
+	return nil
+}
+
+func (r *shareCmdRunner) receive(cmd *cobra.Command, args []string) error {
+	force, _ := cmd.Flags().GetBool("force")
+	overwrite, _ := cmd.Flags().GetBool("overwrite")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	var data []byte
+	var err error
+	if args[0] == "-" {
+		// The confirmation prompt would read from the same pipe
+		if !force {
+			return &usageError{msg: "reading a bundle from stdin needs --force"}
+		}
+		data, err = io.ReadAll(cmd.InOrStdin())
+	} else {
+		data, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	needsPassphrase, err := bundle.NeedsPassphrase(data)
+	if err != nil {
+		return err
+	}
+	var identity age.Identity
+	if needsPassphrase {
+		passphrase, err := readPassphrase("Bundle passphrase: ")
+		if err != nil {
+			return err
+		}
+		identity, err = age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return err
+		}
+	} else {
+		identity, err = loadTeamKeys(false)
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := bundle.Open(data, identity)
+	if err != nil {
+		return err
+	}
+	if b.Expired(time.Now()) {
+		return fmt.Errorf("bundle expired on %s", b.Expires.Local().Format(time.DateTime))
+	}
+	cred := &b.Credential
+	if _, err := kc.NormalizeDomain(cred.Domain); err != nil {
+		return fmt.Errorf("bundle has an invalid domain: %v", err)
+	}
+
+	// Preview before touching the keychain; field values may be secret, so
+	// only list their names
+	cmd.Printf("Domain: %s\n", cred.Domain)
+	cmd.Printf("Username: %s\n", cred.Username)
+	if len(cred.Fields) > 0 {
+		names := make([]string, 0, len(cred.Fields))
+		for name := range cred.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		cmd.Printf("Fields: %s\n", strings.Join(names, ", "))
+	}
+	if len(cred.Tags) > 0 {
+		cmd.Printf("Tags: %s\n", strings.Join(cred.Tags, ", "))
+	}
+	cmd.Printf("Shared: %s\n", b.Created.Local().Format(time.DateTime))
+	if b.Expires != nil {
+		cmd.Printf("Expires: %s\n", b.Expires.Local().Format(time.DateTime))
+	}
+
+	// A bundle must not silently replace what is stored: --force only
+	// skips the question, --overwrite allows the replacement
+	_, err = r.kcManager.GetAccount(cred.Domain, cred.Username)
+	exists := err == nil
+	if err != nil && !errors.Is(err, kc.ErrNotFound) {
+		return err
+	}
+	if exists && force && !overwrite {
+		return fmt.Errorf("%w for '%s@%s'. Use --overwrite to replace it", kc.ErrDuplicate, cred.Username, cred.Domain)
+	}
+
+	if !force {
+		question := "Save to the keychain?"
+		if exists {
+			question = fmt.Sprintf("%s@%s is already stored. Replace it?", cred.Username, cred.Domain)
+		}
+		cmd.Printf("\n%s [y/N]: ", question)
+		scanner := bufio.NewScanner(cmd.InOrStdin())
+		response := ""
+		if scanner.Scan() {
+			response = strings.ToLower(strings.TrimSpace(scanner.Text()))
+		}
+		if response != "y" && response != "yes" {
+			return kc.ErrCancelled
+		}
+	}
+
+	if err := r.kcManager.SetCredential(cred); err != nil {
+		return err
+	}
+
+	if !quiet {
+		cmd.Printf("✓ Saved %s@%s\n", cred.Username, cred.Domain)
+	}
+	return nil
+}
+
+func newShareCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &shareCmdRunner{
+		kcManager: kcManager,
+	}
+	cmd := &cobra.Command{
+		Use:   "share <domain> [username]",
+		Short: "Package one credential into an encrypted bundle",
+		Long: `Package one credential, with its fields (such as a TOTP seed) and tags,
+into an age-encrypted bundle for someone else, without giving them access to anything else.
+
+Encrypt to the receiver's public key (from 'passkc team recipient') or to
+a passphrase you give them separately. An expiring bundle is refused by
+'passkc receive' after that time; rotate the password once it is used.
+
+Examples:
+  passkc share svc.example.com --to age1... -o bundle.age --expires 72h
+  passkc share svc.example.com --to passphrase -o bundle.age
+  passkc share svc.example.com --to age1... > bundle.txt    # Armored text`,
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: completeDomainUsername(kcManager),
+		RunE:              runner.share,
+	}
+	cmd.Flags().String("to", "", "age recipient (age1...), or 'passphrase' to prompt for one")
+	// Shadows the global output format, which does not apply to bundles
+	cmd.Flags().StringP("output", "o", "", "Write the bundle to this file (default is armored text on stdout)")
+	cmd.Flags().Duration("expires", 0, "Refuse the bundle after this long, e.g. 72h")
+	_ = cmd.MarkFlagRequired("to")
+	return cmd
+}
+
+func newReceiveCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &shareCmdRunner{
+		kcManager: kcManager,
+	}
+	cmd := &cobra.Command{
+		Use:   "receive <bundle>",
+		Short: "Import a credential bundle into the keychain",
+		Long: `Decrypt a bundle made with 'passkc share', show what it contains and
+save it to the keychain after confirmation. An account that is already
+stored is only replaced after you confirm it, or with --force --overwrite.
+
+Bundles encrypted to your public key are opened with the team identity in
+your keychain; passphrase bundles prompt for the passphrase.
+
+Examples:
+  passkc receive bundle.age
+  pbpaste | passkc receive - --force   # Armored text from the clipboard
+  passkc receive bundle.age --force    # Skip the confirmation
+  passkc receive bundle.age -f --overwrite  # Also replace a stored account`,
+		Args: cobra.ExactArgs(1),
+		RunE: runner.receive,
+	}
+	cmd.Flags().BoolP("force", "f", false, "Save without confirmation prompt")
+	cmd.Flags().Bool("overwrite", false, "With --force, replace an account that is already stored")
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(newShareCmd(&LiveKeychainManager{}))
+	rootCmd.AddCommand(newReceiveCmd(&LiveKeychainManager{}))
+}
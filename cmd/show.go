@@ -22,12 +22,11 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"encoding/csv"
-	"encoding/json"
-	"os"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/e6a5/passkc/format"
 	"github.com/e6a5/passkc/kc"
 	"github.com/spf13/cobra"
 )
@@ -36,16 +35,19 @@ type showCmdRunner struct {
 	kcManager KeychainManager
 }
 
-func (r *showCmdRunner) run(cmd *cobra.Command, args []string) {
-	outputFormat, _ := cmd.Flags().GetString("output")
+func (r *showCmdRunner) run(cmd *cobra.Command, args []string) error {
+	outputFormat, err := checkOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
 	pattern, _ := cmd.Flags().GetString("pattern")
+	tags, _ := cmd.Flags().GetStringSlice("tag")
 	sortBy, _ := cmd.Flags().GetString("sort")
 	quiet, _ := cmd.Flags().GetBool("quiet")
 
 	creds, err := r.kcManager.ListData()
 	if err != nil {
-		cmd.PrintErrf("Error: %v\n", err)
-		os.Exit(1)
+		return err
 	}
 
 	// Show helpful message if no credentials exist
@@ -54,27 +56,24 @@ func (r *showCmdRunner) run(cmd *cobra.Command, args []string) {
 		cmd.Printf("To add your first credential:\n")
 		cmd.Printf("  passkc set github.com myusername\n\n")
 		cmd.Printf("For help: passkc --help\n")
-		return
+		return nil
 	}
 
 	originalCount := len(creds)
 
-	// Filter credentials if pattern is provided
-	if pattern != "" {
-		filtered := make([]kc.Credential, 0)
-		for _, cred := range creds {
-			if strings.Contains(strings.ToLower(cred.Domain), strings.ToLower(pattern)) ||
-				strings.Contains(strings.ToLower(cred.Username), strings.ToLower(pattern)) {
-				filtered = append(filtered, cred)
-			}
-		}
-		creds = filtered
+	// Filter credentials if pattern or tags are provided
+	if pattern != "" || len(tags) > 0 {
+		creds = kc.FilterCredentials(creds, pattern, tags)
 
 		// Show message if pattern filtered out all results
 		if len(creds) == 0 && outputFormat == "text" && !quiet {
-			cmd.Printf("No credentials found matching pattern '%s'.\n", pattern)
+			if pattern != "" {
+				cmd.Printf("No credentials found matching pattern '%s'.\n", pattern)
+			} else {
+				cmd.Printf("No credentials found with tag '%s'.\n", strings.Join(tags, "', '"))
+			}
 			cmd.Printf("Found %d total credentials. Try a different search pattern.\n", originalCount)
-			return
+			return nil
 		}
 	}
 
@@ -95,55 +94,52 @@ func (r *showCmdRunner) run(cmd *cobra.Command, args []string) {
 		})
 	}
 
-	// Output in requested format
-	switch outputFormat {
-	case "json":
-		// Ensure we output a valid JSON array even if creds is nil
-		if creds == nil {
-			creds = make([]kc.Credential, 0)
+	if outputFormat != "text" {
+		records := make([]any, 0, len(creds))
+		for _, cred := range creds {
+			records = append(records, cred)
 		}
-		if err := json.NewEncoder(cmd.OutOrStdout()).Encode(creds); err != nil {
-			cmd.PrintErrf("Error encoding JSON: %v\n", err)
-			os.Exit(1)
+		columns := []string{"domain", "username", "tags"}
+		if outputFormat == "csv" {
+			columns = columns[:2]
 		}
-	case "csv":
-		w := csv.NewWriter(cmd.OutOrStdout())
-		if err := w.Write([]string{"Domain", "Username"}); err != nil {
-			cmd.PrintErrf("Error writing CSV header: %v\n", err)
-			os.Exit(1)
+		return writeRecords(cmd, records, format.Options{
+			List:       true,
+			Columns:    columns,
+			AllColumns: []string{"domain", "username", "tags"},
+		})
+	}
+
+	if !quiet {
+		if pattern != "" {
+			cmd.Printf("Credentials matching '%s' (%d found):\n\n", pattern, len(creds))
+		} else {
+			cmd.Printf("Saved credentials (%d total):\n\n", len(creds))
 		}
-		for _, cred := range creds {
-			if err := w.Write([]string{cred.Domain, cred.Username}); err != nil {
-				cmd.PrintErrf("Error writing CSV row: %v\n", err)
-				os.Exit(1)
+	}
+
+	for i, cred := range creds {
+		if quiet {
+			cmd.Printf("%s\n", cred.Domain)
+		} else {
+			cmd.Printf("  %d. %s\n", i+1, cred.Domain)
+			cmd.Printf("     Username: %s\n", cred.Username)
+			if len(cred.Tags) > 0 {
+				cmd.Printf("     Tags: %s\n", strings.Join(cred.Tags, ", "))
 			}
-		}
-		w.Flush()
-	default:
-		if !quiet {
-			if pattern != "" {
-				cmd.Printf("Credentials matching '%s' (%d found):\n\n", pattern, len(creds))
-			} else {
-				cmd.Printf("Saved credentials (%d total):\n\n", len(creds))
+			if !cred.Expires.IsZero() {
+				cmd.Printf("     Expires: %s\n", cred.Expires.Format(time.DateOnly))
 			}
-		}
-
-		for i, cred := range creds {
-			if quiet {
-				cmd.Printf("%s\n", cred.Domain)
-			} else {
-				cmd.Printf("  %d. %s\n", i+1, cred.Domain)
-				cmd.Printf("     Username: %s\n", cred.Username)
-				if i < len(creds)-1 {
-					cmd.Printf("\n")
-				}
+			if i < len(creds)-1 {
+				cmd.Printf("\n")
 			}
 		}
+	}
 
-		if !quiet && len(creds) > 0 {
-			cmd.Printf("\nTip: Use 'passkc get <domain>' to retrieve a password\n")
-		}
+	if !quiet && len(creds) > 0 {
+		cmd.Printf("\nTip: Use 'passkc get <domain>' to retrieve a password\n")
 	}
+	return nil
 }
 
 func newShowCmd(kcManager KeychainManager) *cobra.Command {
@@ -161,13 +157,19 @@ Use flags to filter, sort, or change the output format.
 Examples:
   passkc show                              # List all credentials
   passkc show --pattern github            # Search for credentials containing "github"
+  passkc show --tag myapp                 # Only credentials tagged "myapp"
   passkc show --sort username             # Sort by username instead of domain
   passkc show -o json                     # Output as JSON
+  passkc show -o table --columns domain,tags  # Output as a table
   passkc show -q                          # Quiet mode (domains only)`,
-		Run: runner.run,
+		RunE: runner.run,
 	}
 	cmd.Flags().String("pattern", "", "Filter credentials by domain or username")
+	cmd.Flags().StringSlice("tag", nil, "Only show credentials with this tag (repeatable)")
 	cmd.Flags().String("sort", "", "Sort by field (domain|username)")
+	addColumnsFlag(cmd, credentialColumns)
+	_ = cmd.RegisterFlagCompletionFunc("tag", completeTag(kcManager))
+	_ = cmd.RegisterFlagCompletionFunc("sort", completeFixed("domain", "username"))
 	return cmd
 }
 
@@ -0,0 +1,539 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/e6a5/passkc/teamkey"
+	"github.com/e6a5/passkc/vault"
+	"github.com/spf13/cobra"
+)
+
+// Keychain items holding this user's team keys, and the copy kept while
+// rekey replaces them.
+const (
+	teamKeyItem       = "team-identity"
+	teamKeyBackupItem = "team-identity-backup"
+)
+
+// getTeamKeyItem, setTeamKeyItem and removeTeamKeyItem access the
+// keychain items holding this user's team keys. Tests replace them.
+var (
+	getTeamKeyItem    = kc.GetInternal
+	setTeamKeyItem    = kc.SetInternal
+	removeTeamKeyItem = kc.RemoveInternal
+)
+
+// loadTeamKeys returns this user's team keys, unlocking them if they are
+// sealed, and creates and stores them first if create is set.
+func loadTeamKeys(create bool) (*teamkey.Keys, error) {
+	data, err := getTeamKeyItem(teamKeyItem)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		return teamkey.Parse(data, unlockTeamKeys)
+	}
+	if !create {
+		return nil, fmt.Errorf("no team identity in the keychain. Run 'passkc team recipient' to create one")
+	}
+
+	keys, err := teamkey.Generate()
+	if err != nil {
+		return nil, err
+	}
+	if err := storeTeamKeys(keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// storeTeamKeys replaces the stored team keys, sealed as they were when
+// loaded.
+func storeTeamKeys(keys *teamkey.Keys) error {
+	data, err := keys.Marshal()
+	if err != nil {
+		return err
+	}
+	return setTeamKeyItem(teamKeyItem, data)
+}
+
+// unlockTeamKeys prompts for the passphrase of sealed team keys and
+// combines it with their keyfile.
+func unlockTeamKeys(p teamkey.Protection) (string, error) {
+	passphrase, err := readPassphrase("Team key passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	var keyfile []byte
+	if p.Keyfile != "" {
+		if keyfile, err = os.ReadFile(p.Keyfile); err != nil {
+			return "", fmt.Errorf("cannot read keyfile: %v", err)
+		}
+	}
+	if p.WorkFactor < teamkey.DefaultWorkFactor {
+		fmt.Fprintf(os.Stderr, "Warning: your team keys use work factor %d. Run 'passkc rekey' to raise it to %d.\n", p.WorkFactor, teamkey.DefaultWorkFactor)
+	}
+	return teamkey.Secret(passphrase, keyfile), nil
+}
+
+type teamCmdRunner struct {
+	kcManager KeychainManager
+}
+
+// vaultDir returns the vault selected by --vault or the config file.
+func vaultDir(cmd *cobra.Command) (string, error) {
+	if dir, _ := cmd.Flags().GetString("vault"); dir != "" {
+		return dir, nil
+	}
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return "", err
+	}
+	if cfg.Team.Vault == "" {
+		return "", fmt.Errorf("no team vault selected. Pass --vault or set team.vault in the config file")
+	}
+	return cfg.Team.Vault, nil
+}
+
+// openVaultIndex opens the selected vault without unlocking any keys.
+func openVaultIndex(cmd *cobra.Command) (*vault.Vault, error) {
+	dir, err := vaultDir(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return vault.Open(dir)
+}
+
+// openVault opens the selected vault and loads this user's keys.
+func openVault(cmd *cobra.Command) (*vault.Vault, *teamkey.Keys, error) {
+	v, err := openVaultIndex(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, err := loadTeamKeys(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, keys, nil
+}
+
+// reportSkipped lists entries a membership change could not re-encrypt.
+func reportSkipped(cmd *cobra.Command, skipped []vault.Entry) {
+	if len(skipped) == 0 {
+		return
+	}
+	cmd.PrintErrf("Warning: %d entries you cannot read were not re-encrypted:\n", len(skipped))
+	for _, e := range skipped {
+		cmd.PrintErrf("  %s@%s (%s)\n", e.Username, e.Domain, strings.Join(e.Groups, ", "))
+	}
+	cmd.PrintErrf("A member who can read them should run 'passkc team reencrypt'.\n")
+}
+
+func (r *teamCmdRunner) init(cmd *cobra.Command, args []string) error {
+	name, _ := cmd.Flags().GetString("name")
+	groups, _ := cmd.Flags().GetStringSlice("group")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	} else if selected, err := vaultDir(cmd); err == nil {
+		dir = selected
+	}
+	if name == "" {
+		name = os.Getenv("USER")
+	}
+
+	keys, err := loadTeamKeys(true)
+	if err != nil {
+		return err
+	}
+	_, err = vault.Init(dir, vault.Member{Name: name, Recipient: keys.Current.Recipient().String(), Groups: groups})
+	if err != nil {
+		return err
+	}
+
+	if !quiet {
+		cmd.Printf("✓ Created team vault in %s with member '%s'\n", dir, name)
+		cmd.Printf("\nCommit the directory to share it, then add teammates with:\n")
+		cmd.Printf("  passkc team add-member <name> <age-recipient> --group <group>\n")
+	}
+	return nil
+}
+
+func (r *teamCmdRunner) recipient(cmd *cobra.Command, args []string) error {
+	keys, err := loadTeamKeys(true)
+	if err != nil {
+		return err
+	}
+	cmd.Println(keys.Current.Recipient().String())
+	return nil
+}
+
+func (r *teamCmdRunner) addMember(cmd *cobra.Command, args []string) error {
+	groups, _ := cmd.Flags().GetStringSlice("group")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	v, keys, err := openVault(cmd)
+	if err != nil {
+		return err
+	}
+	_, existed := v.Member(args[0])
+	skipped, err := v.SetMember(vault.Member{Name: args[0], Recipient: args[1], Groups: groups}, keys)
+	if err != nil {
+		return err
+	}
+	reportSkipped(cmd, skipped)
+
+	if !quiet {
+		if existed {
+			cmd.Printf("✓ Updated member '%s'\n", args[0])
+		} else {
+			cmd.Printf("✓ Added member '%s'\n", args[0])
+		}
+	}
+	return nil
+}
+
+func (r *teamCmdRunner) removeMember(cmd *cobra.Command, args []string) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	v, keys, err := openVault(cmd)
+	if err != nil {
+		return err
+	}
+	skipped, err := v.RemoveMember(args[0], keys)
+	if err != nil {
+		return err
+	}
+	reportSkipped(cmd, skipped)
+
+	if !quiet {
+		cmd.Printf("✓ Removed member '%s' and re-encrypted their entries\n", args[0])
+		cmd.Printf("They may still have old copies (for example in git history): rotate those passwords.\n")
+	}
+	return nil
+}
+
+func (r *teamCmdRunner) reencrypt(cmd *cobra.Command, args []string) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	v, keys, err := openVault(cmd)
+	if err != nil {
+		return err
+	}
+	skipped, err := v.Reencrypt(keys)
+	if err != nil {
+		return err
+	}
+	reportSkipped(cmd, skipped)
+
+	if !quiet {
+		cmd.Printf("✓ Re-encrypted %d entries\n", len(v.Entries)-len(skipped))
+	}
+	return nil
+}
+
+// add copies a credential from the keychain into the vault.
+func (r *teamCmdRunner) add(cmd *cobra.Command, args []string) error {
+	groups, _ := cmd.Flags().GetStringSlice("group")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	v, err := openVaultIndex(cmd)
+	if err != nil {
+		return err
+	}
+
+	domain, err := kc.NormalizeDomain(args[0])
+	if err != nil {
+		return err
+	}
+	domain, err = resolveDomain(r.kcManager, domain)
+	if err != nil {
+		return err
+	}
+
+	var cred *kc.Credential
+	if len(args) > 1 {
+		cred, err = r.kcManager.GetAccount(domain, args[1])
+	} else {
+		cred, err = r.kcManager.GetData(domain)
+	}
+	if err != nil {
+		return err
+	}
+	// Sharing an entry again updates its password, not who can read it
+	if !cmd.Flags().Changed("group") {
+		if entry, ok := v.Find(cred.Domain, cred.Username); ok {
+			groups = entry.Groups
+		}
+	}
+	if err := v.Put(cred, groups); err != nil {
+		return err
+	}
+
+	if !quiet {
+		readers := make([]string, 0)
+		for _, m := range v.Readers(&vault.Entry{Groups: groups}) {
+			readers = append(readers, m.Name)
+		}
+		cmd.Printf("✓ Shared %s@%s with %s\n", cred.Username, cred.Domain, strings.Join(readers, ", "))
+	}
+	return nil
+}
+
+// pull decrypts a vault entry into the keychain, where the other commands
+// can use it.
+func (r *teamCmdRunner) pull(cmd *cobra.Command, args []string) error {
+	overwrite, _ := cmd.Flags().GetBool("overwrite")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	v, keys, err := openVault(cmd)
+	if err != nil {
+		return err
+	}
+
+	username := ""
+	if len(args) > 1 {
+		username = args[1]
+	}
+	entry, ok := v.Find(args[0], username)
+	if !ok {
+		return fmt.Errorf("%w in the vault for '%s'", kc.ErrNotFound, args[0])
+	}
+	cred, err := v.Get(entry, keys)
+	if err != nil {
+		return err
+	}
+
+	// The vault copy may be older than the local one: only replace a
+	// stored account when asked for
+	if !overwrite {
+		_, err := r.kcManager.GetAccount(cred.Domain, cred.Username)
+		if err != nil && !errors.Is(err, kc.ErrNotFound) {
+			return err
+		}
+		if err == nil {
+			cmd.Printf("%s@%s is already stored. Replace it? [y/N]: ", cred.Username, cred.Domain)
+			scanner := bufio.NewScanner(cmd.InOrStdin())
+			response := ""
+			if scanner.Scan() {
+				response = strings.ToLower(strings.TrimSpace(scanner.Text()))
+			}
+			if response != "y" && response != "yes" {
+				return kc.ErrCancelled
+			}
+		}
+	}
+	if err := r.kcManager.SetCredential(cred); err != nil {
+		return err
+	}
+
+	if !quiet {
+		cmd.Printf("✓ Saved %s@%s to the keychain\n", cred.Username, cred.Domain)
+	}
+	return nil
+}
+
+func (r *teamCmdRunner) remove(cmd *cobra.Command, args []string) error {
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	v, err := openVaultIndex(cmd)
+	if err != nil {
+		return err
+	}
+
+	username := ""
+	if len(args) > 1 {
+		username = args[1]
+	}
+	entry, ok := v.Find(args[0], username)
+	if !ok {
+		return fmt.Errorf("%w in the vault for '%s'", kc.ErrNotFound, args[0])
+	}
+	removed := *entry
+	if err := v.Remove(entry); err != nil {
+		return err
+	}
+
+	if !quiet {
+		cmd.Printf("✓ Removed %s@%s from the vault\n", removed.Username, removed.Domain)
+	}
+	return nil
+}
+
+type teamListing struct {
+	Members []vault.Member `json:"members"`
+	Entries []vault.Entry  `json:"entries"`
+}
+
+func (r *teamCmdRunner) list(cmd *cobra.Command, args []string) error {
+	outputFormat, _ := cmd.Flags().GetString("output")
+	if outputFormat != "text" && outputFormat != "json" {
+		return &usageError{msg: fmt.Sprintf("team list supports text and json output, not '%s'", outputFormat)}
+	}
+
+	v, err := openVaultIndex(cmd)
+	if err != nil {
+		return err
+	}
+
+	if outputFormat == "json" {
+		return json.NewEncoder(cmd.OutOrStdout()).Encode(teamListing{Members: v.Members, Entries: v.Entries})
+	}
+
+	keys, err := loadTeamKeys(false)
+	if err != nil {
+		return err
+	}
+	var me *vault.Member
+	for i := range v.Members {
+		if _, ok := keys.Find(v.Members[i].Recipient); ok {
+			me = &v.Members[i]
+		}
+	}
+
+	cmd.Printf("Members (%d):\n", len(v.Members))
+	for _, m := range v.Members {
+		cmd.Printf("  %s [%s]\n", m.Name, strings.Join(m.Groups, ", "))
+	}
+	cmd.Printf("\nEntries (%d):\n", len(v.Entries))
+	for i, e := range v.Entries {
+		access := ""
+		if me == nil || !v.Entries[i].CanRead(me) {
+			access = "  (no access)"
+		}
+		cmd.Printf("  %s@%s [%s]%s\n", e.Username, e.Domain, strings.Join(e.Groups, ", "), access)
+	}
+	return nil
+}
+
+func newTeamCmd(kcManager KeychainManager) *cobra.Command {
+	runner := &teamCmdRunner{
+		kcManager: kcManager,
+	}
+	cmd := &cobra.Command{
+		Use:   "team",
+		Short: "Share credentials with a team through an encrypted vault",
+		Long: `Share credentials through a vault directory that can be committed to git.
+
+Each entry is encrypted with age to the members of its groups, so a
+member can only decrypt the entries shared with them. Every member has
+an age X25519 key pair kept in their keychain; the vault only holds
+public keys.
+
+Examples:
+  passkc team recipient                                  # Print your public key
+  passkc team init ~/ops-vault --name alice --group oncall
+  passkc team add-member bob age1... --group oncall      # Add or update a member
+  passkc team add db.prod.example.com --group oncall     # Share a keychain entry
+  passkc team pull db.prod.example.com                   # Copy an entry to your keychain
+  passkc team remove-member bob                          # Re-encrypts without bob
+
+Set team.vault in the config file to avoid passing --vault.`,
+	}
+	cmd.PersistentFlags().String("vault", "", "Vault directory (default is team.vault from the config file)")
+
+	initCmd := &cobra.Command{
+		Use:   "init [dir]",
+		Short: "Create a vault with yourself as the first member",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runner.init,
+	}
+	initCmd.Flags().String("name", "", "Your member name (default is $USER)")
+	initCmd.Flags().StringSlice("group", nil, "Groups to join (repeatable)")
+
+	addMemberCmd := &cobra.Command{
+		Use:   "add-member <name> <age-recipient>",
+		Short: "Add a member, or change a member's key or groups",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runner.addMember,
+	}
+	addMemberCmd.Flags().StringSlice("group", nil, "Groups the member belongs to (repeatable)")
+
+	addCmd := &cobra.Command{
+		Use:               "add <domain> [username]",
+		Short:             "Share a keychain entry with the vault",
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: completeDomainUsername(kcManager),
+		RunE:              runner.add,
+	}
+	pullCmd := &cobra.Command{
+		Use:   "pull <domain> [username]",
+		Short: "Copy a vault entry into your keychain",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE:  runner.pull,
+	}
+	pullCmd.Flags().Bool("overwrite", false, "Replace an account already in the keychain without asking")
+
+	addCmd.Flags().StringSlice("group", nil, "Groups allowed to read the entry (default is every member, or its current groups)")
+
+	cmd.AddCommand(
+		initCmd,
+		&cobra.Command{
+			Use:   "recipient",
+			Short: "Print your public key for others to add you",
+			Args:  cobra.NoArgs,
+			RunE:  runner.recipient,
+		},
+		addMemberCmd,
+		&cobra.Command{
+			Use:   "remove-member <name>",
+			Short: "Remove a member and re-encrypt what they could read",
+			Args:  cobra.ExactArgs(1),
+			RunE:  runner.removeMember,
+		},
+		&cobra.Command{
+			Use:   "reencrypt",
+			Short: "Re-encrypt every entry you can read to its current members",
+			Args:  cobra.NoArgs,
+			RunE:  runner.reencrypt,
+		},
+		addCmd,
+		pullCmd,
+		&cobra.Command{
+			Use:   "remove <domain> [username]",
+			Short: "Remove an entry from the vault",
+			Args:  cobra.RangeArgs(1, 2),
+			RunE:  runner.remove,
+		},
+		&cobra.Command{
+			Use:   "list",
+			Short: "List vault members and entries",
+			Args:  cobra.NoArgs,
+			RunE:  runner.list,
+		},
+	)
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(newTeamCmd(&LiveKeychainManager{}))
+}
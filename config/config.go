@@ -0,0 +1,180 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings read from the passkc config file.
+type Config struct {
+	// Askpass maps password prompts to stored entries for the askpass
+	// and pinentry commands.
+	Askpass []PromptMapping `yaml:"askpass"`
+
+	// Audit controls the access log written by every command.
+	Audit AuditConfig `yaml:"audit"`
+
+	// Team selects the shared vault used by the team commands.
+	Team TeamConfig `yaml:"team"`
+
+	// Profile is the profile used when neither --profile nor
+	// PASSKC_PROFILE is given.
+	Profile string `yaml:"profile"`
+}
+
+// AuditConfig configures the access audit log.
+type AuditConfig struct {
+	// Disabled turns off audit logging.
+	Disabled bool `yaml:"disabled"`
+	// Path overrides the log location.
+	Path string `yaml:"path"`
+}
+
+// TeamConfig configures the shared team vault.
+type TeamConfig struct {
+	// Vault is the vault directory, usually inside a git checkout.
+	Vault string `yaml:"vault"`
+}
+
+// PromptMapping links prompt text to the domain whose password answers it.
+type PromptMapping struct {
+	// Match is a regular expression tested against the prompt text.
+	Match  string `yaml:"match"`
+	Domain string `yaml:"domain"`
+}
+
+// DefaultPath returns the config file used when --config is not given.
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find home directory: %v", err)
+	}
+	return filepath.Join(home, ".passkc.yaml"), nil
+}
+
+// Load reads the config file at path, or the default path if it is empty.
+// A missing file is not an error and yields an empty config.
+func Load(path string) (*Config, error) {
+	if path == "" {
+		var err error
+		if path, err = DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config file '%s': %v", path, err)
+	}
+
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file '%s': %v", path, err)
+	}
+	return cfg, nil
+}
+
+// SetProfile sets the default profile in the config file at path, or the
+// default path if it is empty, keeping the rest of the file as it is. An
+// empty name removes the setting.
+func SetProfile(path, name string) error {
+	if path == "" {
+		var err error
+		if path, err = DefaultPath(); err != nil {
+			return err
+		}
+	}
+
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot read config file '%s': %v", path, err)
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid config file '%s': %v", path, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("invalid config file '%s': not a mapping", path)
+	}
+
+	// Mapping content alternates keys and values
+	found := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "profile" {
+			continue
+		}
+		if name == "" {
+			root.Content = append(root.Content[:i], root.Content[i+2:]...)
+		} else {
+			root.Content[i+1].SetString(name)
+		}
+		found = true
+		break
+	}
+	if !found && name != "" {
+		key := &yaml.Node{}
+		key.SetString("profile")
+		value := &yaml.Node{}
+		value.SetString(name)
+		root.Content = append(root.Content, key, value)
+	}
+
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, out, 0o600); err != nil {
+		return fmt.Errorf("cannot write config file '%s': %v", path, err)
+	}
+	return nil
+}
+
+// MatchPrompt returns the domain of the first askpass mapping whose pattern
+// matches any of the given texts.
+func (c *Config) MatchPrompt(texts ...string) (string, bool, error) {
+	for _, m := range c.Askpass {
+		re, err := regexp.Compile(m.Match)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid askpass pattern '%s': %v", m.Match, err)
+		}
+		for _, text := range texts {
+			if text != "" && re.MatchString(text) {
+				return m.Domain, true, nil
+			}
+		}
+	}
+	return "", false, nil
+}
@@ -0,0 +1,433 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+// Package format writes records in the machine-readable output formats
+// selected with --output. Records are values that encode to a JSON
+// object, such as kc.RevealedCredential; table, csv, env and jsonpath
+// output address their fields by JSON name.
+package format
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Options control how records are written.
+type Options struct {
+	// List is set when the records are a list, rather than a single
+	// record that should be written on its own.
+	List bool
+	// Columns are the fields written by table and csv output.
+	Columns []string
+	// AllColumns, if set, are the columns that may be selected.
+	AllColumns []string
+}
+
+// Formatter writes records in one output format.
+type Formatter interface {
+	Format(w io.Writer, records []any, opts Options) error
+}
+
+// FormatterFunc adapts a function to a Formatter.
+type FormatterFunc func(w io.Writer, records []any, opts Options) error
+
+func (f FormatterFunc) Format(w io.Writer, records []any, opts Options) error {
+	return f(w, records, opts)
+}
+
+// Factory creates a formatter. arg is what follows '=' in the format
+// spec, such as the template in "template={{.Domain}}".
+type Factory func(arg string) (Formatter, error)
+
+type registration struct {
+	factory Factory
+	needArg bool
+}
+
+var registry = map[string]registration{}
+
+// Register adds a format. Formats that take an argument are selected as
+// name=argument.
+func Register(name string, needArg bool, factory Factory) {
+	registry[name] = registration{factory: factory, needArg: needArg}
+}
+
+func init() {
+	Register("json", false, fixed(writeJSON))
+	Register("ndjson", false, fixed(writeNDJSON))
+	Register("yaml", false, fixed(writeYAML))
+	Register("table", false, fixed(writeTable))
+	Register("csv", false, fixed(writeCSV))
+	Register("env", false, fixed(writeEnv))
+	Register("dotenv", false, fixed(writeEnv))
+	Register("template", true, newTemplate)
+	Register("jsonpath", true, newJSONPath)
+}
+
+func fixed(f FormatterFunc) Factory {
+	return func(string) (Formatter, error) { return f, nil }
+}
+
+// Names lists the registered formats, with a trailing '=' on those that
+// take an argument.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name, r := range registry {
+		if r.needArg {
+			name += "="
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the formatter for a format spec, such as "yaml" or
+// "jsonpath={.domain}".
+func New(spec string) (Formatter, error) {
+	name, arg, hasArg := strings.Cut(spec, "=")
+	r, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format '%s'. Use one of: text, %s", name, strings.Join(Names(), ", "))
+	}
+	if r.needArg && (!hasArg || arg == "") {
+		return nil, fmt.Errorf("output format '%s' needs an argument: -o %s=...", name, name)
+	}
+	if !r.needArg && hasArg {
+		return nil, fmt.Errorf("output format '%s' takes no argument", name)
+	}
+	return r.factory(arg)
+}
+
+// generic converts a record to its JSON form: maps, slices, strings,
+// numbers and booleans.
+func generic(record any) (any, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
+// object returns the record's JSON fields.
+func object(record any) (map[string]any, error) {
+	v, err := generic(record)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("record is not an object")
+	}
+	return obj, nil
+}
+
+// scalar renders a JSON value as a single string. Lists are joined with
+// commas; objects become their sorted key names, so that secret values,
+// such as credential fields, are not shown by accident.
+func scalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, scalar(item))
+		}
+		return strings.Join(parts, ",")
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return strings.Join(keys, ",")
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+func writeJSON(w io.Writer, records []any, opts Options) error {
+	if opts.List {
+		return json.NewEncoder(w).Encode(records)
+	}
+	for _, record := range records {
+		if err := json.NewEncoder(w).Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeNDJSON(w io.Writer, records []any, _ Options) error {
+	enc := json.NewEncoder(w)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeYAML converts through JSON, so that keys keep their JSON names and
+// order.
+func writeYAML(w io.Writer, records []any, opts Options) error {
+	write := func(v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return err
+		}
+		blockStyle(&node)
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+
+	if opts.List {
+		return write(records)
+	}
+	for i, record := range records {
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if err := write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockStyle undoes the flow style yaml gives to nodes parsed from JSON.
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle
+	if node.Kind == yaml.ScalarNode && node.Style&yaml.DoubleQuotedStyle != 0 {
+		node.Style &^= yaml.DoubleQuotedStyle
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+func checkColumns(opts Options) error {
+	if len(opts.Columns) == 0 {
+		return fmt.Errorf("no columns selected")
+	}
+	if len(opts.AllColumns) == 0 {
+		return nil
+	}
+	for _, col := range opts.Columns {
+		found := false
+		for _, known := range opts.AllColumns {
+			found = found || col == known
+		}
+		if !found {
+			return fmt.Errorf("unknown column '%s'. Use one of: %s", col, strings.Join(opts.AllColumns, ", "))
+		}
+	}
+	return nil
+}
+
+// rows returns the selected columns of every record.
+func rows(records []any, columns []string) ([][]string, error) {
+	out := make([][]string, 0, len(records))
+	for _, record := range records {
+		obj, err := object(record)
+		if err != nil {
+			return nil, err
+		}
+		row := make([]string, 0, len(columns))
+		for _, col := range columns {
+			row = append(row, scalar(obj[col]))
+		}
+		out = append(out, row)
+	}
+	return out, nil
+}
+
+func writeTable(w io.Writer, records []any, opts Options) error {
+	if err := checkColumns(opts); err != nil {
+		return err
+	}
+	body, err := rows(records, opts.Columns)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	header := make([]string, 0, len(opts.Columns))
+	for _, col := range opts.Columns {
+		header = append(header, strings.ToUpper(col))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range body {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	// Empty trailing cells are padded too
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		if _, err := io.WriteString(w, strings.TrimRight(line, " \n")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSV writes a header row for lists only, so that a single record
+// can be read with a plain IFS=, split.
+func writeCSV(w io.Writer, records []any, opts Options) error {
+	if err := checkColumns(opts); err != nil {
+		return err
+	}
+	body, err := rows(records, opts.Columns)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if opts.List {
+		header := make([]string, 0, len(opts.Columns))
+		for _, col := range opts.Columns {
+			header = append(header, strings.ToUpper(col[:1])+col[1:])
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+	}
+	if err := cw.WriteAll(body); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var nonEnvChars = regexp.MustCompile(`[^A-Z0-9_]+`)
+
+// EnvName turns s into an environment variable name: upper case, with
+// runs of other characters replaced by '_'.
+func EnvName(s string) string {
+	name := nonEnvChars.ReplaceAllString(strings.ToUpper(s), "_")
+	name = strings.Trim(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// ShellQuote quotes s for POSIX shells and dotenv files.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeEnv writes NAME='value' lines. Nested objects, such as credential
+// fields, are flattened to one variable per key. In a list every name is
+// prefixed with the record's domain, so GITHUB_COM_USERNAME.
+func writeEnv(w io.Writer, records []any, opts Options) error {
+	for _, record := range records {
+		obj, err := object(record)
+		if err != nil {
+			return err
+		}
+		prefix := ""
+		if opts.List {
+			prefix = EnvName(scalar(obj["domain"])) + "_"
+		}
+
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if nested, ok := obj[k].(map[string]any); ok {
+				names := make([]string, 0, len(nested))
+				for name := range nested {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					fmt.Fprintf(w, "%s%s=%s\n", prefix, EnvName(name), ShellQuote(scalar(nested[name])))
+				}
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "%s%s=%s\n", prefix, EnvName(k), ShellQuote(scalar(obj[k]))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newTemplate runs a Go template once per record, like kubectl's
+// -o go-template. A newline is added after each record unless the
+// template ends with one.
+func newTemplate(text string) (Formatter, error) {
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	return FormatterFunc(func(w io.Writer, records []any, _ Options) error {
+		for _, record := range records {
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, record); err != nil {
+				return fmt.Errorf("template failed: %v", err)
+			}
+			if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+				buf.WriteByte('\n')
+			}
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}), nil
+}
@@ -0,0 +1,89 @@
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type record struct {
+	Domain   string            `json:"domain"`
+	Username string            `json:"username"`
+	Password string            `json:"password,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+}
+
+var records = []any{
+	record{Domain: "github.com", Username: "octocat", Password: "it's", Fields: map[string]string{"otp": "123"}, Tags: []string{"dev", "oss"}},
+	record{Domain: "db.internal", Username: "app", Password: "true"},
+}
+
+func render(t *testing.T, spec string, recs []any, opts Options) string {
+	t.Helper()
+	f, err := New(spec)
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, f.Format(&buf, recs, opts))
+	return buf.String()
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("xml")
+	assert.ErrorContains(t, err, "unknown output format 'xml'")
+	_, err = New("template")
+	assert.ErrorContains(t, err, "needs an argument")
+	_, err = New("yaml=x")
+	assert.ErrorContains(t, err, "takes no argument")
+	_, err = New("template={{.Domain")
+	assert.ErrorContains(t, err, "invalid template")
+	assert.Contains(t, Names(), "jsonpath=")
+}
+
+func TestFormats(t *testing.T) {
+	list := Options{List: true, Columns: []string{"domain", "username", "tags"}}
+
+	assert.Equal(t, "{\"domain\":\"db.internal\",\"username\":\"app\",\"password\":\"true\"}\n",
+		render(t, "json", records[1:], Options{}))
+	assert.Equal(t, 2, bytes.Count([]byte(render(t, "ndjson", records, list)), []byte("\n")))
+
+	assert.Equal(t, `- domain: github.com
+  username: octocat
+  password: it's
+  fields:
+    otp: "123"
+  tags:
+    - dev
+    - oss
+- domain: db.internal
+  username: app
+  password: "true"
+`, render(t, "yaml", records, list))
+
+	assert.Equal(t, "DOMAIN       USERNAME  TAGS\ngithub.com   octocat   dev,oss\ndb.internal  app\n",
+		render(t, "table", records, list))
+	assert.Equal(t, "Domain,Username,Tags\ngithub.com,octocat,\"dev,oss\"\ndb.internal,app,\n",
+		render(t, "csv", records, list))
+	assert.Equal(t, "github.com,octocat,it's\n",
+		render(t, "csv", records[:1], Options{Columns: []string{"domain", "username", "password"}}))
+
+	f, _ := New("table")
+	err := f.Format(&bytes.Buffer{}, records, Options{Columns: []string{"nope"}, AllColumns: []string{"domain"}})
+	assert.ErrorContains(t, err, "unknown column 'nope'")
+
+	assert.Equal(t, "DOMAIN='github.com'\nOTP='123'\nPASSWORD='it'\\''s'\nTAGS='dev,oss'\nUSERNAME='octocat'\n",
+		render(t, "env", records[:1], Options{}))
+	assert.Contains(t, render(t, "env", records, list), "DB_INTERNAL_PASSWORD='true'\n")
+
+	assert.Equal(t, "github.com octocat\ndb.internal app\n",
+		render(t, "template={{.Domain}} {{.Username}}", records, list))
+	assert.Equal(t, "octocat@github.com 123 oss\napp@db.internal  \n",
+		render(t, `jsonpath={.username}@{.domain} {.fields.otp} {.tags[1]}`, records, list))
+	assert.Equal(t, "dev oss\n", render(t, `jsonpath={.tags[*]}{"\n"}`, records[:1], Options{}))
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "AWS_SESSION_TOKEN", EnvName("aws-session.token"))
+	assert.Equal(t, "_1PASSWORD", EnvName("1password"))
+}
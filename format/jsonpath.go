@@ -0,0 +1,169 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package format
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a kubectl-style JSONPath template: literal text with {path}
+// expressions, where a path is a series of .name, [index] and [*] steps
+// into the record's JSON form.
+type jsonPath struct {
+	parts []jsonPathPart
+}
+
+type jsonPathPart struct {
+	literal string
+	steps   []string // nil for literal text
+}
+
+func newJSONPath(text string) (Formatter, error) {
+	p := &jsonPath{}
+	for text != "" {
+		start := strings.IndexByte(text, '{')
+		if start < 0 {
+			p.parts = append(p.parts, jsonPathPart{literal: text})
+			break
+		}
+		end := strings.IndexByte(text[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid jsonpath: unclosed '{'")
+		}
+		if start > 0 {
+			p.parts = append(p.parts, jsonPathPart{literal: text[:start]})
+		}
+		expr := text[start+1 : start+end]
+		if quoted, err := strconv.Unquote(expr); err == nil {
+			// {"\n"} and friends, as in kubectl
+			p.parts = append(p.parts, jsonPathPart{literal: quoted})
+		} else {
+			steps, err := parseJSONPath(expr)
+			if err != nil {
+				return nil, err
+			}
+			p.parts = append(p.parts, jsonPathPart{steps: steps})
+		}
+		text = text[start+end+1:]
+	}
+	return p, nil
+}
+
+// parseJSONPath splits ".fields.otp" or "tags[0]" into steps. Index steps
+// keep their brackets.
+func parseJSONPath(expr string) ([]string, error) {
+	expr = strings.TrimPrefix(strings.TrimSpace(expr), "$")
+	steps := make([]string, 0)
+	for expr != "" {
+		switch expr[0] {
+		case '.':
+			expr = expr[1:]
+			n := strings.IndexAny(expr, ".[")
+			if n < 0 {
+				n = len(expr)
+			}
+			if n > 0 {
+				steps = append(steps, expr[:n])
+			}
+			expr = expr[n:]
+		case '[':
+			n := strings.IndexByte(expr, ']')
+			if n < 0 {
+				return nil, fmt.Errorf("invalid jsonpath: unclosed '['")
+			}
+			index := expr[1:n]
+			if index != "*" {
+				if _, err := strconv.Atoi(index); err != nil {
+					return nil, fmt.Errorf("invalid jsonpath index '%s'", index)
+				}
+			}
+			steps = append(steps, expr[:n+1])
+			expr = expr[n+1:]
+		default:
+			return nil, fmt.Errorf("invalid jsonpath '%s': steps start with '.' or '['", expr)
+		}
+	}
+	return steps, nil
+}
+
+// eval follows steps from v, fanning out at [*].
+func eval(v any, steps []string) []any {
+	values := []any{v}
+	for _, step := range steps {
+		next := make([]any, 0)
+		for _, value := range values {
+			switch {
+			case step == "[*]":
+				if list, ok := value.([]any); ok {
+					next = append(next, list...)
+				}
+			case strings.HasPrefix(step, "["):
+				i, _ := strconv.Atoi(step[1 : len(step)-1])
+				if list, ok := value.([]any); ok && i >= 0 && i < len(list) {
+					next = append(next, list[i])
+				}
+			default:
+				if obj, ok := value.(map[string]any); ok {
+					if field, ok := obj[step]; ok {
+						next = append(next, field)
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// Format evaluates the template once per record and ends each with a
+// newline, unless the template already does.
+func (p *jsonPath) Format(w io.Writer, records []any, _ Options) error {
+	for _, record := range records {
+		v, err := generic(record)
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		for _, part := range p.parts {
+			if part.steps == nil {
+				b.WriteString(part.literal)
+				continue
+			}
+			values := eval(v, part.steps)
+			texts := make([]string, 0, len(values))
+			for _, value := range values {
+				texts = append(texts, scalar(value))
+			}
+			b.WriteString(strings.Join(texts, " "))
+		}
+		if !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/keybase/go-keychain"
+)
+
+// Errors returned by this package wrap one of these, so that callers can
+// tell failures apart with errors.Is.
+var (
+	// ErrNotFound means there are no credentials for the domain or account.
+	ErrNotFound = errors.New("no credentials found")
+	// ErrDuplicate means the credentials already exist.
+	ErrDuplicate = errors.New("credentials already exist")
+	// ErrLocked means the keychain is locked or access to it was denied.
+	ErrLocked = errors.New("keychain is locked")
+	// ErrCancelled means the user cancelled a prompt or confirmation.
+	ErrCancelled = errors.New("canceled")
+	// ErrBackendUnavailable means the keychain cannot be reached at all.
+	ErrBackendUnavailable = errors.New("keychain is unavailable")
+)
+
+// keychainError wraps a keychain failure with the matching sentinel error.
+// Errors without one are returned unchanged.
+func keychainError(err error) error {
+	var sentinel error
+	switch err {
+	case keychain.ErrorItemNotFound:
+		sentinel = ErrNotFound
+	case keychain.ErrorDuplicateItem:
+		sentinel = ErrDuplicate
+	case keychain.ErrorInteractionNotAllowed, keychain.ErrorAuthFailed:
+		sentinel = ErrLocked
+	case keychain.ErrorUserCanceled:
+		sentinel = ErrCancelled
+	case keychain.ErrorNotAvailable, keychain.ErrorNoSuchKeychain:
+		sentinel = ErrBackendUnavailable
+	default:
+		return err
+	}
+	return fmt.Errorf("%w (%v)", sentinel, err)
+}
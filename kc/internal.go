@@ -0,0 +1,96 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kc
+
+import (
+	"fmt"
+
+	"github.com/keybase/go-keychain"
+)
+
+// internalService holds passkc's own bookkeeping items. It does not start
+// with "com.passkc." or "com.passkc@" so these items never show up as
+// credentials.
+const internalService = "com.passkc-internal"
+
+// GetInternal returns the data of a passkc bookkeeping item, or nil if it
+// does not exist.
+func GetInternal(name string) ([]byte, error) {
+	query := keychain.NewItem()
+	query.SetSecClass(keychain.SecClassGenericPassword)
+	query.SetService(internalService)
+	query.SetAccount(name)
+	query.SetMatchLimit(keychain.MatchLimitOne)
+	query.SetReturnData(true)
+
+	results, err := keychain.QueryItem(query)
+	if err == keychain.ErrorItemNotFound || (err == nil && len(results) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to access keychain: %w", keychainError(err))
+	}
+	return results[0].Data, nil
+}
+
+// SetInternal creates or replaces a passkc bookkeeping item.
+func SetInternal(name string, data []byte) error {
+	item := keychain.NewItem()
+	item.SetSecClass(keychain.SecClassGenericPassword)
+	item.SetService(internalService)
+	item.SetAccount(name)
+	item.SetData(data)
+	item.SetAccessible(keychain.AccessibleWhenUnlocked)
+	item.SetSynchronizable(keychain.SynchronizableNo)
+
+	err := keychain.AddItem(item)
+	if err == keychain.ErrorDuplicateItem {
+		query := keychain.NewItem()
+		query.SetSecClass(keychain.SecClassGenericPassword)
+		query.SetService(internalService)
+		query.SetAccount(name)
+		query.SetMatchLimit(keychain.MatchLimitOne)
+
+		attributes := keychain.NewItem()
+		attributes.SetData(data)
+		err = keychain.UpdateItem(query, attributes)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save '%s' to keychain: %w", name, keychainError(err))
+	}
+	return nil
+}
+
+// RemoveInternal deletes a passkc bookkeeping item. A missing item is not
+// an error.
+func RemoveInternal(name string) error {
+	query := keychain.NewItem()
+	query.SetSecClass(keychain.SecClassGenericPassword)
+	query.SetService(internalService)
+	query.SetAccount(name)
+
+	err := keychain.DeleteItem(query)
+	if err != nil && err != keychain.ErrorItemNotFound {
+		return fmt.Errorf("failed to remove '%s' from keychain: %w", name, keychainError(err))
+	}
+	return nil
+}
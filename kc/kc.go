@@ -22,9 +22,15 @@ THE SOFTWARE.
 package kc
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"runtime"
+	"slices"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/keybase/go-keychain"
 	"golang.org/x/term"
@@ -32,17 +38,215 @@ import (
 
 // Credential holds the data for a keychain entry.
 type Credential struct {
-	Domain   string `json:"domain"`
-	Username string `json:"username"`
-	Password string `json:"password,omitempty"`
+	Domain   string
+	Username string
+	Password Secret
+	Fields   map[string]string
+	Tags     []string
+	// Notes is free text kept encrypted with the password, so it can hold
+	// things like recovery codes.
+	Notes string
+	// Expires is when the password should be rotated, or zero.
+	Expires time.Time
+}
+
+// RevealedCredential is a Credential with its password in plain text, for
+// the output paths that have to show it.
+type RevealedCredential struct {
+	Domain   string            `json:"domain"`
+	Username string            `json:"username"`
+	Password string            `json:"password,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Notes    string            `json:"notes,omitempty"`
+	Expires  *time.Time        `json:"expires,omitempty"`
+	// Redacted lists the parts, "password" and "notes", that hold Redacted
+	// in place of their value. A password that really is "[REDACTED]" is
+	// not listed, so it survives a round trip.
+	Redacted []string `json:"redacted,omitempty"`
+}
+
+// Reveal returns the credential with its password in plain text.
+func (c *Credential) Reveal() *RevealedCredential {
+	return &RevealedCredential{
+		Domain:   c.Domain,
+		Username: c.Username,
+		Password: c.Password.Reveal(),
+		Fields:   c.Fields,
+		Tags:     c.Tags,
+		Notes:    c.Notes,
+		Expires:  expiresPtr(c.Expires),
+	}
+}
+
+func expiresPtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// MarshalJSON encodes the credential with its password and notes
+// redacted. Encode Reveal() to include them.
+func (c Credential) MarshalJSON() ([]byte, error) {
+	out := RevealedCredential{Domain: c.Domain, Username: c.Username, Fields: c.Fields, Tags: c.Tags, Expires: expiresPtr(c.Expires)}
+	if !c.Password.IsEmpty() {
+		out.Password = Redacted
+		out.Redacted = append(out.Redacted, "password")
+	}
+	if c.Notes != "" {
+		out.Notes = Redacted
+		out.Redacted = append(out.Redacted, "notes")
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a credential with its password in plain text, as
+// encoded from Reveal(). Parts listed in "redacted" are left empty.
+func (c *Credential) UnmarshalJSON(data []byte) error {
+	var in RevealedCredential
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*c = Credential{
+		Domain:   in.Domain,
+		Username: in.Username,
+		Fields:   in.Fields,
+		Tags:     in.Tags,
+	}
+	if !slices.Contains(in.Redacted, "password") {
+		c.Password = NewSecretString(in.Password)
+	}
+	if !slices.Contains(in.Redacted, "notes") {
+		c.Notes = in.Notes
+	}
+	if in.Expires != nil {
+		c.Expires = *in.Expires
+	}
+	return nil
+}
+
+// itemMetadata is stored as JSON in the keychain item's comment attribute.
+// Unlike the password and fields it can be read without unlocking the item,
+// so it must not hold anything secret.
+type itemMetadata struct {
+	Tags    []string   `json:"tags,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+func encodeMetadata(cred *Credential) (string, error) {
+	if len(cred.Tags) == 0 && cred.Expires.IsZero() {
+		return "", nil
+	}
+	data, err := json.Marshal(itemMetadata{Tags: cred.Tags, Expires: expiresPtr(cred.Expires)})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode credential tags: %v", err)
+	}
+	return string(data), nil
+}
+
+// decodeMetadata ignores comments that are not passkc metadata, such as
+// ones added by hand in Keychain Access.
+func decodeMetadata(comment string, cred *Credential) {
+	var meta itemMetadata
+	if json.Unmarshal([]byte(comment), &meta) == nil {
+		cred.Tags = meta.Tags
+		if meta.Expires != nil {
+			cred.Expires = *meta.Expires
+		}
+	}
+}
+
+// HasTag reports whether the credential carries the given tag.
+func (c *Credential) HasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterCredentials keeps the credentials whose domain or username contains
+// pattern (case-insensitively) and that carry every one of tags.
+func FilterCredentials(creds []Credential, pattern string, tags []string) []Credential {
+	filtered := make([]Credential, 0)
+	for _, cred := range creds {
+		if pattern != "" &&
+			!strings.Contains(strings.ToLower(cred.Domain), strings.ToLower(pattern)) &&
+			!strings.Contains(strings.ToLower(cred.Username), strings.ToLower(pattern)) {
+			continue
+		}
+		hasTags := true
+		for _, tag := range tags {
+			if !cred.HasTag(tag) {
+				hasTags = false
+				break
+			}
+		}
+		if hasTags {
+			filtered = append(filtered, cred)
+		}
+	}
+	return filtered
+}
+
+// secretPrefix marks keychain data that holds a JSON secret envelope rather
+// than a bare password. Entries without fields or notes are still stored as
+// the raw password so they stay readable by other tools.
+const secretPrefix = "\x00passkc1"
+
+type secretEnvelope struct {
+	Password string            `json:"password"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Notes    string            `json:"notes,omitempty"`
+}
+
+// encodeSecret serializes the password, fields and notes into keychain
+// data. The caller should wipe the result once it has been handed to the
+// keychain.
+func encodeSecret(cred *Credential) ([]byte, error) {
+	if len(cred.Fields) == 0 && cred.Notes == "" {
+		data := append([]byte(nil), cred.Password.Bytes()...)
+		runtime.KeepAlive(cred.Password)
+		return data, nil
+	}
+	data, err := json.Marshal(secretEnvelope{Password: cred.Password.Reveal(), Fields: cred.Fields, Notes: cred.Notes})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode credential fields: %v", err)
+	}
+	return append([]byte(secretPrefix), data...), nil
+}
+
+// decodeSecret is the inverse of encodeSecret, setting the password,
+// fields and notes of cred. Data that is not an envelope is taken
+// unchanged as the password. data is wiped.
+func decodeSecret(data []byte, cred *Credential) error {
+	if !bytes.HasPrefix(data, []byte(secretPrefix)) {
+		cred.Password = NewSecret(data)
+		return nil
+	}
+	defer wipe(data)
+	var env secretEnvelope
+	if err := json.Unmarshal(data[len(secretPrefix):], &env); err != nil {
+		return fmt.Errorf("failed to decode credential fields: %v", err)
+	}
+	cred.Password, cred.Fields, cred.Notes = NewSecretString(env.Password), env.Fields, env.Notes
+	return nil
 }
 
 // GetData retrieves credentials from the Keychain for a given domain.
-// It will find the first entry matching the service "com.passkc.<domain>".
+// It will find the first entry matching the service "com.passkc.<domain>",
+// or "com.passkc@<profile>.<domain>" outside the default profile.
 func GetData(domain string) (*Credential, error) {
+	return selected().GetData(domain)
+}
+
+// GetData is the package function GetData in p.
+func (p Profile) GetData(domain string) (*Credential, error) {
 	query := keychain.NewItem()
 	query.SetSecClass(keychain.SecClassGenericPassword)
-	query.SetService(fmt.Sprintf("com.passkc.%s", domain))
+	query.SetService(p.service(domain))
 	query.SetMatchLimit(keychain.MatchLimitOne)
 	query.SetReturnAttributes(true)
 	query.SetReturnData(true)
@@ -50,75 +254,186 @@ func GetData(domain string) (*Credential, error) {
 	results, err := keychain.QueryItem(query)
 	if err != nil {
 		if err == keychain.ErrorItemNotFound {
-			return nil, fmt.Errorf("no credentials found for '%s'. Use 'passkc set %s <username>' to add credentials", domain, domain)
+			return nil, fmt.Errorf("%w for '%s'. Use 'passkc set %s <username>' to add credentials", ErrNotFound, domain, domain)
 		}
-		return nil, fmt.Errorf("failed to access keychain: %v", err)
+		return nil, fmt.Errorf("failed to access keychain: %w", keychainError(err))
 	}
 
 	if len(results) == 0 {
-		return nil, fmt.Errorf("no credentials found for '%s'. Use 'passkc set %s <username>' to add credentials", domain, domain)
+		return nil, fmt.Errorf("%w for '%s'. Use 'passkc set %s <username>' to add credentials", ErrNotFound, domain, domain)
 	}
 
 	// Get the first result
 	result := results[0]
 	username := result.Account
-	password := string(result.Data)
-
-	return &Credential{
+	cred := &Credential{
 		Domain:   domain,
 		Username: username,
-		Password: password,
-	}, nil
+	}
+	if err := decodeSecret(result.Data, cred); err != nil {
+		return nil, err
+	}
+	decodeMetadata(result.Comment, cred)
+	return cred, nil
+}
+
+// GetAccount retrieves the credentials stored for one account of a domain,
+// for domains that hold more than one.
+func GetAccount(domain, username string) (*Credential, error) {
+	return selected().GetAccount(domain, username)
+}
+
+// GetAccount is the package function GetAccount in p.
+func (p Profile) GetAccount(domain, username string) (*Credential, error) {
+	cred, err := p.existingItem(domain, username)
+	if err != nil {
+		return nil, err
+	}
+	if cred.Password.IsEmpty() {
+		return nil, fmt.Errorf("%w for '%s@%s'", ErrNotFound, username, domain)
+	}
+	return cred, nil
 }
 
 // SetData stores credentials in the Keychain.
-// If an entry for the service and account already exists, it will be updated.
-// If password is an empty string, the user will be prompted to enter it securely.
-func SetData(domain, username, password string) error {
-	// Fixed: Use consistent service naming scheme
-	service := fmt.Sprintf("com.passkc.%s", domain)
+// If an entry for the service and account already exists, it will be updated
+// and any fields and tags stored with it are kept.
+// If password is empty, the user will be prompted to enter it securely.
+func SetData(domain, username string, password Secret) error {
+	return selected().SetData(domain, username, password)
+}
 
-	if password == "" {
-		// Secure password prompt
-		fmt.Printf("Enter password for %s@%s: ", username, domain)
-		bytePassword, err := term.ReadPassword(int(syscall.Stdin))
-		if err != nil {
-			return fmt.Errorf("failed to read password: %v", err)
+// SetData is the package function SetData in p.
+func (p Profile) SetData(domain, username string, password Secret) error {
+	if password.IsEmpty() {
+		var err error
+		if password, err = promptPassword(domain, username); err != nil {
+			return err
 		}
-		fmt.Println() // Add newline after password input
-		password = string(bytePassword)
+	}
+
+	cred, err := p.existingItem(domain, username)
+	if err != nil {
+		return err
+	}
+	cred.Password = password
+
+	return p.writeItem(cred)
+}
 
-		if password == "" {
-			return fmt.Errorf("password cannot be empty")
+// SetCredential stores a full credential, including its fields, tags,
+// notes and expiry, replacing whatever is stored for the same domain and
+// username.
+// If cred.Password is empty, the user will be prompted to enter it securely.
+func SetCredential(cred *Credential) error {
+	return selected().SetCredential(cred)
+}
+
+// SetCredential is the package function SetCredential in p.
+func (p Profile) SetCredential(cred *Credential) error {
+	stored := *cred
+	if stored.Password.IsEmpty() {
+		var err error
+		if stored.Password, err = promptPassword(cred.Domain, cred.Username); err != nil {
+			return err
 		}
 	}
 
+	return p.writeItem(&stored)
+}
+
+func promptPassword(domain, username string) (Secret, error) {
+	// Secure password prompt
+	fmt.Printf("Enter password for %s@%s: ", username, domain)
+	bytePassword, err := term.ReadPassword(int(syscall.Stdin))
+	if err == io.EOF {
+		// Ctrl-D at the prompt
+		fmt.Println()
+		return Secret{}, ErrCancelled
+	}
+	if err != nil {
+		return Secret{}, fmt.Errorf("failed to read password: %v", err)
+	}
+	fmt.Println() // Add newline after password input
+
+	password := NewSecret(bytePassword)
+	if password.IsEmpty() {
+		return Secret{}, fmt.Errorf("password cannot be empty")
+	}
+	return password, nil
+}
+
+// existingItem returns what is stored for an account, or a credential
+// without password, fields or tags if there is nothing yet.
+func (p Profile) existingItem(domain, username string) (*Credential, error) {
+	cred := &Credential{Domain: domain, Username: username}
+
+	query := keychain.NewItem()
+	query.SetSecClass(keychain.SecClassGenericPassword)
+	query.SetService(p.service(domain))
+	query.SetAccount(username)
+	query.SetMatchLimit(keychain.MatchLimitOne)
+	query.SetReturnAttributes(true)
+	query.SetReturnData(true)
+
+	results, err := keychain.QueryItem(query)
+	if err == keychain.ErrorItemNotFound || (err == nil && len(results) == 0) {
+		return cred, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to access keychain: %w", keychainError(err))
+	}
+
+	if err := decodeSecret(results[0].Data, cred); err != nil {
+		return nil, err
+	}
+	decodeMetadata(results[0].Comment, cred)
+	return cred, nil
+}
+
+func (p Profile) writeItem(cred *Credential) error {
+	domain := cred.Domain
+	// Fixed: Use consistent service naming scheme
+	serviceName := p.service(domain)
+
+	data, err := encodeSecret(cred)
+	if err != nil {
+		return err
+	}
+	defer wipe(data)
+	comment, err := encodeMetadata(cred)
+	if err != nil {
+		return err
+	}
+
 	item := keychain.NewItem()
 	item.SetSecClass(keychain.SecClassGenericPassword)
-	item.SetService(service)
-	item.SetAccount(username)
-	item.SetData([]byte(password))
+	item.SetService(serviceName)
+	item.SetAccount(cred.Username)
+	item.SetData(data)
+	item.SetComment(comment)
 	item.SetAccessible(keychain.AccessibleWhenUnlocked)
 	item.SetSynchronizable(keychain.SynchronizableNo)
 
-	err := keychain.AddItem(item)
+	err = keychain.AddItem(item)
 	if err == keychain.ErrorDuplicateItem {
 		// Update existing item
 		query := keychain.NewItem()
 		query.SetSecClass(keychain.SecClassGenericPassword)
-		query.SetService(service)
-		query.SetAccount(username)
+		query.SetService(serviceName)
+		query.SetAccount(cred.Username)
 		query.SetMatchLimit(keychain.MatchLimitOne)
 
 		attributes := keychain.NewItem()
-		attributes.SetData([]byte(password))
+		attributes.SetData(data)
+		attributes.SetComment(comment)
 
 		err = keychain.UpdateItem(query, attributes)
 		if err != nil {
-			return fmt.Errorf("failed to update credentials for '%s': %v", domain, err)
+			return fmt.Errorf("failed to update credentials for '%s': %w", domain, keychainError(err))
 		}
 	} else if err != nil {
-		return fmt.Errorf("failed to save credentials for '%s': %v", domain, err)
+		return fmt.Errorf("failed to save credentials for '%s': %w", domain, keychainError(err))
 	}
 
 	return nil
@@ -126,47 +441,87 @@ func SetData(domain, username, password string) error {
 
 // RemoveData removes all credential entries for a given domain.
 func RemoveData(domain string) error {
+	return selected().RemoveData(domain)
+}
+
+// RemoveData is the package function RemoveData in p.
+func (p Profile) RemoveData(domain string) error {
 	query := keychain.NewItem()
 	query.SetSecClass(keychain.SecClassGenericPassword)
-	query.SetService(fmt.Sprintf("com.passkc.%s", domain))
+	query.SetService(p.service(domain))
 	query.SetMatchLimit(keychain.MatchLimitOne)
 
 	err := keychain.DeleteItem(query)
 	if err == keychain.ErrorItemNotFound {
-		return fmt.Errorf("no credentials found for '%s'", domain)
+		return fmt.Errorf("%w for '%s'", ErrNotFound, domain)
 	}
 	if err != nil {
-		return fmt.Errorf("failed to remove credentials for '%s': %v", domain, err)
+		return fmt.Errorf("failed to remove credentials for '%s': %w", domain, keychainError(err))
 	}
 
 	return nil
 }
 
+// RemoveAccount removes the credentials of one account of a domain.
+func RemoveAccount(domain, username string) error {
+	return selected().RemoveAccount(domain, username)
+}
+
+// RemoveAccount is the package function RemoveAccount in p.
+func (p Profile) RemoveAccount(domain, username string) error {
+	query := keychain.NewItem()
+	query.SetSecClass(keychain.SecClassGenericPassword)
+	query.SetService(p.service(domain))
+	query.SetAccount(username)
+
+	err := keychain.DeleteItem(query)
+	if err == keychain.ErrorItemNotFound {
+		return fmt.Errorf("%w for '%s@%s'", ErrNotFound, username, domain)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove credentials for '%s@%s': %w", username, domain, keychainError(err))
+	}
+
+	return nil
+}
+
+// ListData returns the domain, username, tags and expiry of every passkc
+// entry in the selected profile.
+// Passwords and fields are not read.
 func ListData() ([]Credential, error) {
+	return selected().ListData()
+}
+
+// ListData is the package function ListData in p.
+func (p Profile) ListData() ([]Credential, error) {
 	query := keychain.NewItem()
 	query.SetSecClass(keychain.SecClassGenericPassword)
 	query.SetMatchLimit(keychain.MatchLimitAll)
 	query.SetReturnAttributes(true)
 
-	// Search for all items with service names starting with "com.passkc."
+	// Search for all items with service names starting with the profile's
+	// prefix, "com.passkc." by default
 	results, err := keychain.QueryItem(query)
 	if err == keychain.ErrorItemNotFound {
 		return make([]Credential, 0), nil // Not an error, just no items
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to access keychain: %v", err)
+		return nil, fmt.Errorf("failed to access keychain: %w", keychainError(err))
 	}
 
+	prefix := servicePrefix(p.Name())
 	creds := make([]Credential, 0)
 	for _, result := range results {
 		// Parse domain from service name: com.passkc.<domain>
-		if strings.HasPrefix(result.Service, "com.passkc.") {
-			domain := strings.TrimPrefix(result.Service, "com.passkc.")
+		if strings.HasPrefix(result.Service, prefix) {
+			domain := strings.TrimPrefix(result.Service, prefix)
 			username := result.Account
-			creds = append(creds, Credential{
+			cred := Credential{
 				Domain:   domain,
 				Username: username,
-			})
+			}
+			decodeMetadata(result.Comment, &cred)
+			creds = append(creds, cred)
 		}
 	}
 
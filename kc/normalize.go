@@ -0,0 +1,97 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kc
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// NormalizeDomain turns what users paste into the canonical domain passkc
+// stores: "https://login.GitHub.com:443/session?x=1" becomes
+// "login.github.com". The scheme, user info, port, path, case and trailing
+// dot are dropped and internationalized names are converted to punycode.
+// Names that are not host names, such as "aws-prod", pass through apart
+// from lower-casing.
+func NormalizeDomain(input string) (string, error) {
+	domain := strings.TrimSpace(input)
+
+	if strings.Contains(domain, "://") {
+		u, err := url.Parse(domain)
+		if err != nil || u.Hostname() == "" {
+			return "", fmt.Errorf("invalid URL '%s'", input)
+		}
+		domain = u.Host
+	} else if i := strings.IndexAny(domain, "/?#"); i >= 0 {
+		domain = domain[:i]
+	}
+
+	if host, port, err := net.SplitHostPort(domain); err == nil && isPort(port) {
+		domain = host
+	}
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+
+	if err := ValidateDomain(domain); err != nil {
+		return "", err
+	}
+
+	ascii, err := idna.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("invalid domain '%s': %v", input, err)
+	}
+	return ascii, nil
+}
+
+func isPort(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// RegistrableDomain returns the eTLD+1 of a domain according to the public
+// suffix list compiled into passkc, e.g. "bbc.co.uk" for "www.bbc.co.uk".
+// It returns an empty string for names without a public suffix.
+func RegistrableDomain(domain string) string {
+	if !strings.Contains(domain, ".") {
+		return ""
+	}
+	if _, icann := publicsuffix.PublicSuffix(domain); !icann {
+		// Not under a known TLD, e.g. "db.internal"
+		return ""
+	}
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return ""
+	}
+	return registrable
+}
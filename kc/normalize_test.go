@@ -0,0 +1,38 @@
+package kc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"github.com", "github.com"},
+		{"https://login.github.com/session?x=1", "login.github.com"},
+		{"GitHub.com:443", "github.com"},
+		{"https://user@Example.COM.:8443/path", "example.com"},
+		{"github.com/login", "github.com"},
+		{"münchen.de", "xn--mnchen-3ya.de"},
+		{"aws-prod", "aws-prod"},
+		{"[::1]:8080", "::1"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeDomain(tt.input)
+		assert.NoError(t, err, tt.input)
+		assert.Equal(t, tt.want, got, tt.input)
+	}
+
+	_, err := NormalizeDomain("  ")
+	assert.Error(t, err)
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	assert.Equal(t, "github.com", RegistrableDomain("login.github.com"))
+	assert.Equal(t, "bbc.co.uk", RegistrableDomain("www.bbc.co.uk"))
+	assert.Equal(t, "", RegistrableDomain("aws-prod"))
+	assert.Equal(t, "", RegistrableDomain("db.internal"))
+}
@@ -0,0 +1,210 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kc
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/keybase/go-keychain"
+)
+
+// DefaultProfile is the profile used when no other one is selected. Its
+// entries keep the "com.passkc.<domain>" service names from before
+// profiles existed.
+const DefaultProfile = "default"
+
+// profileServicePrefix starts the service names of the other profiles:
+// "com.passkc@<profile>.<domain>". It does not start with "com.passkc."
+// so their entries never show up in the default profile.
+const profileServicePrefix = "com.passkc@"
+
+var profileName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// profile is the profile that every credential function works in.
+var profile = DefaultProfile
+
+// ValidateProfile checks that name can be used as a profile name.
+func ValidateProfile(name string) error {
+	if !profileName.MatchString(name) {
+		return fmt.Errorf("invalid profile name '%s'. Use up to 32 lower case letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// SetProfile selects the profile used by GetData, SetData, ListData and
+// the other credential functions.
+func SetProfile(name string) error {
+	if err := ValidateProfile(name); err != nil {
+		return err
+	}
+	profile = name
+	return nil
+}
+
+// CurrentProfile returns the selected profile.
+func CurrentProfile() string {
+	return profile
+}
+
+// Profile reads and writes the credentials of one profile. GetData, SetData
+// and the other package functions work in the profile selected with
+// SetProfile; a Profile names its own, so a program using several profiles
+// at once never has to change the selection. The zero value is the default
+// profile.
+type Profile struct {
+	name string
+}
+
+// OpenProfile returns the profile called name. It does not check that the
+// profile has been created.
+func OpenProfile(name string) (Profile, error) {
+	if err := ValidateProfile(name); err != nil {
+		return Profile{}, err
+	}
+	return Profile{name: name}, nil
+}
+
+// Name returns the profile's name.
+func (p Profile) Name() string {
+	if p.name == "" {
+		return DefaultProfile
+	}
+	return p.name
+}
+
+// selected returns the profile chosen with SetProfile.
+func selected() Profile {
+	return Profile{name: profile}
+}
+
+func servicePrefix(name string) string {
+	if name == DefaultProfile {
+		return "com.passkc."
+	}
+	return profileServicePrefix + name + "."
+}
+
+// service returns the keychain service name of domain in p.
+func (p Profile) service(domain string) string {
+	return servicePrefix(p.Name()) + domain
+}
+
+// Profiles returns the default profile, the profiles created with
+// CreateProfile and any others that hold entries, sorted by name.
+func Profiles() ([]string, error) {
+	names, err := registeredProfiles()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{DefaultProfile: true}
+	for _, name := range names {
+		seen[name] = true
+	}
+
+	query := keychain.NewItem()
+	query.SetSecClass(keychain.SecClassGenericPassword)
+	query.SetMatchLimit(keychain.MatchLimitAll)
+	query.SetReturnAttributes(true)
+	results, err := keychain.QueryItem(query)
+	if err != nil && err != keychain.ErrorItemNotFound {
+		return nil, fmt.Errorf("failed to access keychain: %w", keychainError(err))
+	}
+	for _, result := range results {
+		if rest, ok := strings.CutPrefix(result.Service, profileServicePrefix); ok {
+			if name, _, ok := strings.Cut(rest, "."); ok && ValidateProfile(name) == nil {
+				seen[name] = true
+			}
+		}
+	}
+
+	profiles := make([]string, 0, len(seen))
+	for name := range seen {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
+
+// CreateProfile records an empty profile so that it can be listed and
+// selected before anything is stored in it.
+func CreateProfile(name string) error {
+	if err := ValidateProfile(name); err != nil {
+		return err
+	}
+	profiles, err := Profiles()
+	if err != nil {
+		return err
+	}
+	for _, existing := range profiles {
+		if existing == name {
+			return fmt.Errorf("%w: profile '%s'", ErrDuplicate, name)
+		}
+	}
+	names, err := registeredProfiles()
+	if err != nil {
+		return err
+	}
+	return saveProfiles(append(names, name))
+}
+
+// DeleteProfile forgets a profile created with CreateProfile. Its entries
+// are not removed; delete them first.
+func DeleteProfile(name string) error {
+	if name == DefaultProfile {
+		return fmt.Errorf("the default profile cannot be deleted")
+	}
+	names, err := registeredProfiles()
+	if err != nil {
+		return err
+	}
+	kept := make([]string, 0, len(names))
+	for _, existing := range names {
+		if existing != name {
+			kept = append(kept, existing)
+		}
+	}
+	return saveProfiles(kept)
+}
+
+func registeredProfiles() ([]string, error) {
+	data, err := GetInternal("profiles")
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("stored profile list is corrupt: %v", err)
+	}
+	return names, nil
+}
+
+func saveProfiles(names []string) error {
+	data, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	return SetInternal("profiles", data)
+}
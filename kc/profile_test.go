@@ -0,0 +1,30 @@
+package kc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileServiceNames(t *testing.T) {
+	defer func() { profile = DefaultProfile }()
+
+	assert.Equal(t, "com.passkc.github.com", selected().service("github.com"))
+	assert.Equal(t, "com.passkc.github.com", Profile{}.service("github.com"))
+
+	assert.NoError(t, SetProfile("client-a"))
+	assert.Equal(t, "client-a", CurrentProfile())
+	assert.Equal(t, "com.passkc@client-a.github.com", selected().service("github.com"))
+
+	// An opened profile does not follow the selection
+	other, err := OpenProfile("client-b")
+	assert.NoError(t, err)
+	assert.Equal(t, "com.passkc@client-b.github.com", other.service("github.com"))
+	_, err = OpenProfile("Client B")
+	assert.Error(t, err)
+
+	for _, name := range []string{"", "Work", "a.b", "-x", "has space"} {
+		assert.Error(t, SetProfile(name), name)
+	}
+	assert.Equal(t, "client-a", CurrentProfile())
+}
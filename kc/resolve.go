@@ -0,0 +1,182 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxSuggestions caps the "did you mean" list.
+const maxSuggestions = 3
+
+// AmbiguousDomainError is returned when a partial domain matches more than
+// one stored domain.
+type AmbiguousDomainError struct {
+	Query      string
+	Candidates []string
+}
+
+func (e *AmbiguousDomainError) Error() string {
+	return fmt.Sprintf("'%s' matches several domains: %s. Use the full domain",
+		e.Query, strings.Join(e.Candidates, ", "))
+}
+
+// ResolveDomain maps what the user typed to one of the stored domains.
+// An exact (case-insensitive) match wins. Otherwise a unique domain that
+// starts with the query, ends with it after a dot, or that the query is a
+// subdomain of, is used: "github" and "login.github.com" both resolve to
+// "github.com", and "prod.example.com" to "db.prod.example.com", but
+// "b.com" never resolves to "ab.com".
+// Failing that, a unique domain with the same registrable domain (eTLD+1)
+// is used, so "mail.google.com" finds "accounts.google.com".
+// Several matches give an *AmbiguousDomainError; none gives a not found
+// error with the closest domains as suggestions.
+func ResolveDomain(query string, domains []string) (string, error) {
+	q := strings.ToLower(query)
+	for _, d := range domains {
+		if strings.ToLower(d) == q {
+			return d, nil
+		}
+	}
+
+	candidates := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, d := range domains {
+		ld := strings.ToLower(d)
+		if seen[ld] {
+			continue
+		}
+		if strings.HasPrefix(ld, q) || strings.HasSuffix(ld, "."+q) || strings.HasSuffix(q, "."+ld) {
+			seen[ld] = true
+			candidates = append(candidates, d)
+		}
+	}
+
+	if len(candidates) == 0 {
+		candidates = sameRegistrableDomain(q, domains)
+	}
+
+	switch len(candidates) {
+	case 1:
+		return candidates[0], nil
+	case 0:
+		return "", notFoundError(query, suggestDomains(q, domains))
+	default:
+		sort.Strings(candidates)
+		return "", &AmbiguousDomainError{Query: query, Candidates: candidates}
+	}
+}
+
+// sameRegistrableDomain returns the domains that share the query's eTLD+1.
+func sameRegistrableDomain(query string, domains []string) []string {
+	registrable := RegistrableDomain(query)
+	if registrable == "" {
+		return nil
+	}
+	candidates := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, d := range domains {
+		ld := strings.ToLower(d)
+		if !seen[ld] && RegistrableDomain(ld) == registrable {
+			seen[ld] = true
+			candidates = append(candidates, d)
+		}
+	}
+	return candidates
+}
+
+func notFoundError(domain string, suggestions []string) error {
+	if len(suggestions) > 0 {
+		return fmt.Errorf("%w for '%s'. Did you mean: %s?", ErrNotFound, domain, strings.Join(suggestions, ", "))
+	}
+	return fmt.Errorf("%w for '%s'. Use 'passkc set %s <username>' to add credentials", ErrNotFound, domain, domain)
+}
+
+// suggestDomains returns the stored domains within a small edit distance of
+// the query, closest first.
+func suggestDomains(query string, domains []string) []string {
+	type suggestion struct {
+		domain   string
+		distance int
+	}
+
+	limit := len(query)/3 + 1
+	if limit > 3 {
+		limit = 3
+	}
+
+	found := make([]suggestion, 0)
+	seen := make(map[string]bool)
+	for _, d := range domains {
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		// Compare against the name without its TLD too, so "gthub" finds github.com
+		distance := levenshtein(query, strings.ToLower(d))
+		if name, _, ok := strings.Cut(strings.ToLower(d), "."); ok {
+			if nd := levenshtein(query, name); nd < distance {
+				distance = nd
+			}
+		}
+		if distance <= limit {
+			found = append(found, suggestion{d, distance})
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].distance != found[j].distance {
+			return found[i].distance < found[j].distance
+		}
+		return found[i].domain < found[j].domain
+	})
+
+	suggestions := make([]string, 0, maxSuggestions)
+	for i := 0; i < len(found) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, found[i].domain)
+	}
+	return suggestions
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,61 @@
+package kc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveDomain(t *testing.T) {
+	domains := []string{"github.com", "gitlab.com", "google.com", "api.github.com", "GitHub.com", "db.prod.example.com"}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"github.com", "github.com"},
+		{"GITLAB.COM", "gitlab.com"},
+		{"goog", "google.com"},
+		{"prod.example.com", "db.prod.example.com"},
+		{"api", "api.github.com"},
+	}
+	for _, tt := range tests {
+		got, err := ResolveDomain(tt.query, domains)
+		assert.NoError(t, err, tt.query)
+		assert.Equal(t, tt.want, got, tt.query)
+	}
+
+	_, err := ResolveDomain("git", domains)
+	var ambiguous *AmbiguousDomainError
+	assert.True(t, errors.As(err, &ambiguous))
+	assert.Equal(t, []string{"github.com", "gitlab.com"}, ambiguous.Candidates)
+
+	got, err := ResolveDomain("login.google.com", domains)
+	assert.NoError(t, err)
+	assert.Equal(t, "google.com", got)
+
+	got, err = ResolveDomain("mail.google.com", []string{"accounts.google.com", "bbc.co.uk"})
+	assert.NoError(t, err)
+	assert.Equal(t, "accounts.google.com", got)
+
+	_, err = ResolveDomain("news.co.uk", []string{"bbc.co.uk"})
+	assert.Error(t, err)
+
+	// A suffix only matches at a label boundary
+	_, err = ResolveDomain("b.com", []string{"ab.com"})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = ResolveDomain("gogle", domains)
+	assert.EqualError(t, err, "no credentials found for 'gogle'. Did you mean: google.com?")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = ResolveDomain("example.org", domains)
+	assert.ErrorContains(t, err, "Use 'passkc set example.org <username>'")
+}
+
+func TestLevenshtein(t *testing.T) {
+	assert.Equal(t, 0, levenshtein("abc", "abc"))
+	assert.Equal(t, 1, levenshtein("gthub", "github"))
+	assert.Equal(t, 3, levenshtein("kitten", "sitting"))
+}
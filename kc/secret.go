@@ -0,0 +1,177 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// Redacted is what a Secret prints as, and what JSON output shows in place
+// of a password.
+const Redacted = "[REDACTED]"
+
+// Secret holds a password in memory that is locked against being swapped
+// to disk and wiped when it is destroyed or garbage collected. String,
+// GoString and MarshalJSON redact it, so it cannot end up in output, logs
+// or error messages by accident: use Bytes or Reveal to read it.
+//
+// Copying a Secret, or a Credential holding one, does not copy the
+// password: the copies share one buffer, and destroying any of them
+// empties them all. Use Clone for an independent copy.
+//
+// The zero value is an empty secret.
+type Secret struct {
+	buf *secretBuffer
+}
+
+type secretBuffer struct {
+	data []byte
+	// region is the whole anonymous mapping holding data.
+	region []byte
+}
+
+// NewSecret copies b into locked memory and wipes b.
+func NewSecret(b []byte) Secret {
+	if len(b) == 0 {
+		return Secret{}
+	}
+	buf := &secretBuffer{}
+	size := (len(b) + os.Getpagesize() - 1) / os.Getpagesize() * os.Getpagesize()
+	region, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err == nil {
+		// Locking can fail under a low RLIMIT_MEMLOCK; the memory is still
+		// wiped, so carry on without it
+		_ = unix.Mlock(region)
+		buf.region = region
+		buf.data = region[:len(b)]
+	} else {
+		buf.data = make([]byte, len(b))
+	}
+	copy(buf.data, b)
+	wipe(b)
+
+	runtime.SetFinalizer(buf, (*secretBuffer).destroy)
+	return Secret{buf: buf}
+}
+
+// NewSecretString copies s into locked memory. The string itself cannot be
+// wiped, so prefer NewSecret where the bytes are available.
+func NewSecretString(s string) Secret {
+	return NewSecret([]byte(s))
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func (b *secretBuffer) destroy() {
+	wipe(b.data)
+	if b.region != nil {
+		_ = unix.Munlock(b.region)
+		_ = unix.Munmap(b.region)
+		b.region = nil
+	}
+	b.data = nil
+}
+
+// Len returns the length of the secret in bytes.
+func (s Secret) Len() int {
+	if s.buf == nil {
+		return 0
+	}
+	return len(s.buf.data)
+}
+
+// IsEmpty reports whether the secret has no content.
+func (s Secret) IsEmpty() bool {
+	return s.Len() == 0
+}
+
+// Bytes returns the secret without copying it. The slice is only valid
+// until Destroy and must not be modified or kept. The memory is released
+// when s is garbage collected, so call runtime.KeepAlive(s) after the last
+// use of the slice.
+func (s Secret) Bytes() []byte {
+	if s.buf == nil {
+		return nil
+	}
+	return s.buf.data
+}
+
+// Reveal returns the secret as a string. Go strings cannot be wiped, so
+// use it only where a string is required, such as an output format.
+func (s Secret) Reveal() string {
+	defer runtime.KeepAlive(s.buf)
+	return string(s.Bytes())
+}
+
+// Clone returns a copy of the secret in its own locked memory, which can be
+// destroyed independently.
+func (s Secret) Clone() Secret {
+	defer runtime.KeepAlive(s.buf)
+	return NewSecret(append([]byte(nil), s.Bytes()...))
+}
+
+// Equal reports whether two secrets hold the same bytes, in constant time.
+func (s Secret) Equal(other Secret) bool {
+	defer runtime.KeepAlive(other.buf)
+	defer runtime.KeepAlive(s.buf)
+	return subtle.ConstantTimeCompare(s.Bytes(), other.Bytes()) == 1
+}
+
+// Destroy wipes and releases the secret. Copies made with Reveal are not
+// affected.
+func (s Secret) Destroy() {
+	if s.buf != nil {
+		s.buf.destroy()
+	}
+}
+
+func (s Secret) String() string {
+	return Redacted
+}
+
+func (s Secret) GoString() string {
+	return Redacted
+}
+
+// MarshalJSON redacts the secret.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Redacted)
+}
+
+// UnmarshalJSON reads a secret from a JSON string.
+func (s *Secret) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*s = NewSecretString(value)
+	return nil
+}
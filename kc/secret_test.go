@@ -0,0 +1,100 @@
+package kc
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecret(t *testing.T) {
+	input := []byte("hunter2")
+	s := NewSecret(input)
+	assert.Equal(t, make([]byte, 7), input, "input is wiped")
+	assert.Equal(t, "hunter2", s.Reveal())
+	assert.Equal(t, 7, s.Len())
+	assert.True(t, s.Equal(NewSecretString("hunter2")))
+	assert.False(t, s.Equal(NewSecretString("hunter3")))
+
+	// Formatting never shows the secret
+	for _, format := range []string{"%s", "%v", "%+v", "%#v", "%q", "%x"} {
+		assert.NotContains(t, fmt.Sprintf(format, s), "hunter2", format)
+	}
+	assert.NotContains(t, fmt.Errorf("failed with %v", s).Error(), "hunter2")
+	data, err := json.Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, `"[REDACTED]"`, string(data))
+
+	var decoded Secret
+	assert.NoError(t, json.Unmarshal([]byte(`"hunter2"`), &decoded))
+	assert.True(t, decoded.Equal(s))
+
+	// Copies share the buffer, clones do not
+	clone := s.Clone()
+	shared := s
+	view := s.Bytes()
+	s.Destroy()
+	assert.True(t, shared.IsEmpty())
+	assert.Equal(t, "hunter2", clone.Reveal())
+	assert.True(t, s.IsEmpty())
+	assert.Empty(t, s.Reveal())
+	_ = view
+
+	var zero Secret
+	assert.True(t, zero.IsEmpty())
+	zero.Destroy()
+}
+
+func TestCredentialJSON(t *testing.T) {
+	cred := Credential{Domain: "github.com", Username: "octocat", Password: NewSecretString("hunter2")}
+
+	data, err := json.Marshal(cred)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"domain":"github.com","username":"octocat","password":"[REDACTED]","redacted":["password"]}`, string(data))
+	var redacted Credential
+	assert.NoError(t, json.Unmarshal(data, &redacted))
+	assert.True(t, redacted.Password.IsEmpty())
+
+	data, err = json.Marshal(cred.Reveal())
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"domain":"github.com","username":"octocat","password":"hunter2"}`, string(data))
+
+	// Credentials without a password, as listed by ListData, omit it
+	data, err = json.Marshal([]Credential{{Domain: "github.com", Username: "octocat"}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"domain":"github.com","username":"octocat"}]`, string(data))
+
+	var decoded Credential
+	assert.NoError(t, json.Unmarshal([]byte(`{"domain":"a.com","username":"me","password":"pw","fields":{"k":"v"}}`), &decoded))
+	assert.Equal(t, "pw", decoded.Password.Reveal())
+	assert.Equal(t, "v", decoded.Fields["k"])
+}
+
+func TestCredentialStorage(t *testing.T) {
+	expires := time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC)
+	cred := Credential{Password: NewSecretString("hunter2"), Notes: "line one\nline two", Expires: expires}
+
+	// Notes live with the password, the expiry in the readable metadata
+	data, err := encodeSecret(&cred)
+	assert.NoError(t, err)
+	var decoded Credential
+	assert.NoError(t, decodeSecret(data, &decoded))
+	assert.Equal(t, "hunter2", decoded.Password.Reveal())
+	assert.Equal(t, cred.Notes, decoded.Notes)
+
+	comment, err := encodeMetadata(&cred)
+	assert.NoError(t, err)
+	assert.NotContains(t, comment, "line one")
+	decodeMetadata(comment, &decoded)
+	assert.True(t, expires.Equal(decoded.Expires))
+
+	// Notes are redacted like the password unless revealed
+	data, err = json.Marshal(cred)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "line one")
+	data, err = json.Marshal(cred.Reveal())
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"expires":"2027-01-31T00:00:00Z"`)
+}
@@ -0,0 +1,494 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+// Package passkc is the Go client library for passkc. It reads and writes
+// the same keychain entries as the passkc command, so programs can fetch
+// credentials directly instead of running "passkc get -q":
+//
+//	store, err := passkc.Open(passkc.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	cred, err := store.Get(ctx, "db.internal", nil)
+//	if errors.Is(err, passkc.ErrNotFound) {
+//		...
+//	}
+//	dsn := fmt.Sprintf("postgres://%s:%s@db.internal/app", cred.Username, cred.Password.Reveal())
+//
+// The package follows semantic versioning: its API only changes in
+// incompatible ways with a new major version of the module. The other
+// packages in this module are implementation details of the command and
+// make no such promise.
+package passkc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/e6a5/passkc/audit"
+	"github.com/e6a5/passkc/config"
+	"github.com/e6a5/passkc/kc"
+)
+
+// Credential is a stored entry. Its Password, Fields and Notes are only
+// filled in by Get.
+type Credential struct {
+	Domain   string
+	Username string
+	Password Secret
+	// Fields are extra named values, such as a TOTP seed.
+	Fields map[string]string
+	Tags   []string
+	// Notes is free text kept encrypted with the password.
+	Notes string
+	// Expires is when the password should be rotated, or zero.
+	Expires time.Time
+}
+
+// fromKC converts a credential of the command's keychain layer, which has
+// no compatibility promise, to this package's type. The password is
+// shared, not copied.
+func fromKC(c *kc.Credential) *Credential {
+	return &Credential{
+		Domain:   c.Domain,
+		Username: c.Username,
+		Password: Secret{secret: c.Password},
+		Fields:   c.Fields,
+		Tags:     c.Tags,
+		Notes:    c.Notes,
+		Expires:  c.Expires,
+	}
+}
+
+// toKC is the inverse of fromKC.
+func (c *Credential) toKC() *kc.Credential {
+	return &kc.Credential{
+		Domain:   c.Domain,
+		Username: c.Username,
+		Password: c.Password.secret,
+		Fields:   c.Fields,
+		Tags:     c.Tags,
+		Notes:    c.Notes,
+		Expires:  c.Expires,
+	}
+}
+
+// AmbiguousDomainError is returned by Get when a partial domain matches
+// more than one stored domain.
+type AmbiguousDomainError struct {
+	// Query is the domain as given.
+	Query string
+	// Candidates are the stored domains it matches, sorted.
+	Candidates []string
+}
+
+func (e *AmbiguousDomainError) Error() string {
+	return fmt.Sprintf("'%s' matches several domains: %s. Use the full domain",
+		e.Query, strings.Join(e.Candidates, ", "))
+}
+
+// Errors returned by a Store wrap one of these; test for them with
+// errors.Is.
+var (
+	ErrNotFound           = kc.ErrNotFound
+	ErrDuplicate          = kc.ErrDuplicate
+	ErrLocked             = kc.ErrLocked
+	ErrCancelled          = kc.ErrCancelled
+	ErrBackendUnavailable = kc.ErrBackendUnavailable
+)
+
+// Store reads and writes credentials. Every method fails with the
+// context's error if ctx is already done. Get, List and Watch also stop
+// waiting when ctx ends; Put and Delete always wait for the keychain, so
+// their result is the write's. See Open.
+type Store interface {
+	// Get returns the credential for domain. Domains are normalized and
+	// partial domains resolved as on the command line, so "github"
+	// finds "github.com"; opts may be nil.
+	Get(ctx context.Context, domain string, opts *GetOptions) (*Credential, error)
+	// Put stores cred, replacing the entry for the same domain and
+	// username unless opts.NoOverwrite is set; opts may be nil.
+	Put(ctx context.Context, cred *Credential, opts *PutOptions) error
+	// List returns the stored credentials without their passwords or
+	// fields; opts may be nil.
+	List(ctx context.Context, opts *ListOptions) ([]Credential, error)
+	// Delete removes the credentials for domain, which must be given in
+	// full; opts may be nil.
+	Delete(ctx context.Context, domain string, opts *DeleteOptions) error
+	// Watch reports credentials being added, removed or retagged until
+	// ctx is done, then closes the channel; opts may be nil.
+	Watch(ctx context.Context, opts *WatchOptions) (<-chan Event, error)
+}
+
+// Options configures Open.
+type Options struct {
+	// ConfigPath is the config file, like the command's --config flag.
+	// Empty means ~/.passkc.yaml.
+	ConfigPath string
+	// Profile is the profile to read and write, like the command's
+	// --profile flag. Empty means $PASSKC_PROFILE, then the config file's
+	// profile, then the default profile. Stores on different profiles can
+	// be used at the same time.
+	Profile string
+	// Client names the program in the access log. Empty means the
+	// executable's name.
+	Client string
+	// OnAuditError is called when an access cannot be written to the
+	// access log. As with the command, the access itself still goes
+	// ahead.
+	OnAuditError func(error)
+}
+
+// GetOptions configures Store.Get.
+type GetOptions struct {
+	// Username selects one account of a domain that holds several.
+	Username string
+	// Exact turns off partial domain resolution.
+	Exact bool
+}
+
+// PutOptions configures Store.Put.
+type PutOptions struct {
+	// NoOverwrite makes Put fail with ErrDuplicate if the account is
+	// already stored.
+	NoOverwrite bool
+}
+
+// ListOptions configures Store.List.
+type ListOptions struct {
+	// Pattern keeps credentials whose domain or username contains it,
+	// ignoring case.
+	Pattern string
+	// Tags keeps credentials that carry every one of these tags.
+	Tags []string
+}
+
+// DeleteOptions configures Store.Delete.
+type DeleteOptions struct {
+	// Username removes only this account of the domain.
+	Username string
+}
+
+// WatchOptions configures Store.Watch.
+type WatchOptions struct {
+	ListOptions
+	// Interval is how often the keychain is checked. Zero means
+	// DefaultWatchInterval.
+	Interval time.Duration
+}
+
+// DefaultWatchInterval is how often Watch checks the keychain by default.
+const DefaultWatchInterval = 5 * time.Second
+
+// EventType says what happened to a watched credential.
+type EventType int
+
+const (
+	// EventAdded is sent for a credential that was not there before.
+	EventAdded EventType = iota + 1
+	// EventRemoved is sent for a credential that is gone.
+	EventRemoved
+	// EventChanged is sent when a credential's tags change. Password and
+	// field changes cannot be seen without reading every entry, so they
+	// are not reported.
+	EventChanged
+	// EventError is sent when checking the keychain fails. Watching
+	// carries on at the next interval.
+	EventError
+)
+
+// Event is one change seen by Watch. Credential has no password or fields.
+type Event struct {
+	Type       EventType
+	Credential Credential
+	Err        error
+}
+
+// backend is the credential storage a store works on. Tests use an
+// in-memory one.
+type backend interface {
+	List() ([]kc.Credential, error)
+	Get(domain string) (*kc.Credential, error)
+	GetAccount(domain, username string) (*kc.Credential, error)
+	Put(cred *kc.Credential) error
+	Delete(domain string) error
+	DeleteAccount(domain, username string) error
+}
+
+// keychainBackend works in its own profile rather than the one selected
+// with kc.SetProfile, which is global to the process.
+type keychainBackend struct {
+	profile kc.Profile
+}
+
+func (b keychainBackend) List() ([]kc.Credential, error)            { return b.profile.ListData() }
+func (b keychainBackend) Get(domain string) (*kc.Credential, error) { return b.profile.GetData(domain) }
+func (b keychainBackend) GetAccount(domain, username string) (*kc.Credential, error) {
+	return b.profile.GetAccount(domain, username)
+}
+func (b keychainBackend) Put(cred *kc.Credential) error { return b.profile.SetCredential(cred) }
+func (b keychainBackend) Delete(domain string) error    { return b.profile.RemoveData(domain) }
+func (b keychainBackend) DeleteAccount(domain, username string) error {
+	return b.profile.RemoveAccount(domain, username)
+}
+
+type store struct {
+	backend      backend
+	audit        config.AuditConfig
+	secrets      audit.Secrets
+	client       string
+	onAuditError func(error)
+}
+
+// Open returns a Store on the macOS keychain, configured from the same
+// config file as the command: accesses are written to the access log
+// unless it is disabled there.
+//
+// Keychain calls cannot be interrupted. When ctx ends during a read, Get
+// or List returns at once and the read finishes in the background, with
+// its result discarded. Put and Delete check ctx only before they start:
+// returning early would report an error for a write that still happens.
+func Open(opts Options) (Store, error) {
+	cfg, err := config.Load(opts.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := kc.OpenProfile(profileName(opts.Profile, cfg))
+	if err != nil {
+		return nil, err
+	}
+	client := opts.Client
+	if client == "" {
+		client = filepath.Base(os.Args[0])
+	}
+	return &store{
+		backend:      keychainBackend{profile: profile},
+		audit:        cfg.Audit,
+		secrets:      audit.KeychainSecrets{},
+		client:       client,
+		onAuditError: opts.OnAuditError,
+	}, nil
+}
+
+// profileName picks the profile as the command's --profile flag does.
+func profileName(name string, cfg *config.Config) string {
+	if name == "" {
+		name = os.Getenv("PASSKC_PROFILE")
+	}
+	if name == "" {
+		name = cfg.Profile
+	}
+	if name == "" {
+		name = kc.DefaultProfile
+	}
+	return name
+}
+
+// call runs fn unless ctx is already done, and stops waiting for it when
+// ctx ends.
+func call[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// mutate runs fn unless ctx is already done. Unlike call it waits for fn
+// however long it takes, so that the caller never sees ctx's error for a
+// write that still goes ahead.
+func mutate(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// record appends an access to the access log, like the command does.
+func (s *store) record(action, domain, username string, accessErr error) {
+	if s.audit.Disabled {
+		return
+	}
+	entry := audit.Entry{
+		Action:   action,
+		Domain:   domain,
+		Username: username,
+		Command:  s.client,
+		Success:  accessErr == nil,
+	}
+	if accessErr != nil {
+		entry.Error = accessErr.Error()
+	}
+
+	path, err := audit.ConfigPath(s.audit)
+	if err == nil {
+		err = audit.Record(path, s.secrets, entry)
+	}
+	if err != nil && s.onAuditError != nil {
+		s.onAuditError(err)
+	}
+}
+
+// resolve normalizes domain and, unless exact is set, maps a partial
+// domain to a stored one.
+func (s *store) resolve(domain string, exact bool) (string, error) {
+	domain, err := kc.NormalizeDomain(domain)
+	if err != nil || exact {
+		return domain, err
+	}
+	creds, err := s.backend.List()
+	if err != nil {
+		return "", err
+	}
+	domains := make([]string, 0, len(creds))
+	for _, cred := range creds {
+		domains = append(domains, cred.Domain)
+	}
+	resolved, err := kc.ResolveDomain(domain, domains)
+	var ambiguous *kc.AmbiguousDomainError
+	if errors.As(err, &ambiguous) {
+		return "", &AmbiguousDomainError{Query: ambiguous.Query, Candidates: ambiguous.Candidates}
+	}
+	return resolved, err
+}
+
+func (s *store) Get(ctx context.Context, domain string, opts *GetOptions) (*Credential, error) {
+	if opts == nil {
+		opts = &GetOptions{}
+	}
+	return call(ctx, func() (*Credential, error) {
+		domain, err := s.resolve(domain, opts.Exact)
+		if err != nil {
+			return nil, err
+		}
+
+		var cred *kc.Credential
+		if opts.Username != "" {
+			cred, err = s.backend.GetAccount(domain, opts.Username)
+		} else {
+			cred, err = s.backend.Get(domain)
+		}
+		username := opts.Username
+		if cred != nil {
+			username = cred.Username
+		}
+		s.record("get", domain, username, err)
+		if err != nil {
+			return nil, err
+		}
+		return fromKC(cred), nil
+	})
+}
+
+func (s *store) Put(ctx context.Context, cred *Credential, opts *PutOptions) error {
+	if opts == nil {
+		opts = &PutOptions{}
+	}
+	return mutate(ctx, func() error {
+		domain, err := kc.NormalizeDomain(cred.Domain)
+		if err != nil {
+			return err
+		}
+		if err := kc.ValidateUsername(cred.Username); err != nil {
+			return err
+		}
+		// The keychain functions prompt for an empty password, which a
+		// library must never do
+		if cred.Password.IsEmpty() {
+			return fmt.Errorf("password cannot be empty")
+		}
+
+		if opts.NoOverwrite {
+			_, err := s.backend.GetAccount(domain, cred.Username)
+			if err == nil {
+				return fmt.Errorf("%w for '%s@%s'", ErrDuplicate, cred.Username, domain)
+			}
+			if !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+
+		stored := cred.toKC()
+		stored.Domain = domain
+		err = s.backend.Put(stored)
+		s.record("set", domain, cred.Username, err)
+		return err
+	})
+}
+
+func (s *store) List(ctx context.Context, opts *ListOptions) ([]Credential, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	return call(ctx, func() ([]Credential, error) {
+		creds, err := s.backend.List()
+		if err != nil {
+			return nil, err
+		}
+		filtered := kc.FilterCredentials(creds, opts.Pattern, opts.Tags)
+		list := make([]Credential, 0, len(filtered))
+		for i := range filtered {
+			list = append(list, *fromKC(&filtered[i]))
+		}
+		return list, nil
+	})
+}
+
+func (s *store) Delete(ctx context.Context, domain string, opts *DeleteOptions) error {
+	if opts == nil {
+		opts = &DeleteOptions{}
+	}
+	return mutate(ctx, func() error {
+		domain, err := kc.NormalizeDomain(domain)
+		if err != nil {
+			return err
+		}
+		if opts.Username != "" {
+			err = s.backend.DeleteAccount(domain, opts.Username)
+		} else {
+			err = s.backend.Delete(domain)
+		}
+		s.record("remove", domain, opts.Username, err)
+		return err
+	})
+}
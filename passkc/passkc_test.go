@@ -0,0 +1,267 @@
+package passkc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/e6a5/passkc/audit"
+	"github.com/e6a5/passkc/config"
+	"github.com/e6a5/passkc/kc"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryBackend stores credentials in a map keyed by domain and username.
+type memoryBackend struct {
+	mu    sync.Mutex
+	creds []kc.Credential
+	block chan struct{}
+}
+
+func (m *memoryBackend) List() ([]kc.Credential, error) {
+	if m.block != nil {
+		<-m.block
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]kc.Credential, 0, len(m.creds))
+	for _, cred := range m.creds {
+		list = append(list, kc.Credential{Domain: cred.Domain, Username: cred.Username, Tags: cred.Tags})
+	}
+	return list, nil
+}
+
+func (m *memoryBackend) Get(domain string) (*kc.Credential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, cred := range m.creds {
+		if cred.Domain == domain {
+			return &cred, nil
+		}
+	}
+	return nil, fmt.Errorf("%w for '%s'", kc.ErrNotFound, domain)
+}
+
+func (m *memoryBackend) GetAccount(domain, username string) (*kc.Credential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, cred := range m.creds {
+		if cred.Domain == domain && cred.Username == username {
+			return &cred, nil
+		}
+	}
+	return nil, fmt.Errorf("%w for '%s@%s'", kc.ErrNotFound, username, domain)
+}
+
+func (m *memoryBackend) Put(cred *kc.Credential) error {
+	if m.block != nil {
+		<-m.block
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.creds {
+		if m.creds[i].Domain == cred.Domain && m.creds[i].Username == cred.Username {
+			m.creds[i] = *cred
+			return nil
+		}
+	}
+	m.creds = append(m.creds, *cred)
+	return nil
+}
+
+func (m *memoryBackend) Delete(domain string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.creds {
+		if m.creds[i].Domain == domain {
+			m.creds = append(m.creds[:i], m.creds[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w for '%s'", kc.ErrNotFound, domain)
+}
+
+func (m *memoryBackend) DeleteAccount(domain, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.creds {
+		if m.creds[i].Domain == domain && m.creds[i].Username == username {
+			m.creds = append(m.creds[:i], m.creds[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w for '%s@%s'", kc.ErrNotFound, username, domain)
+}
+
+type memorySecrets struct {
+	key  []byte
+	head *audit.Head
+}
+
+func (m *memorySecrets) Key() ([]byte, error)           { return m.key, nil }
+func (m *memorySecrets) SetKey(key []byte) error        { m.key = key; return nil }
+func (m *memorySecrets) LoadHead() (*audit.Head, error) { return m.head, nil }
+func (m *memorySecrets) SaveHead(h *audit.Head) error   { m.head = h; return nil }
+
+func newTestStore(t *testing.T, creds ...kc.Credential) (*store, string) {
+	t.Helper()
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	return &store{
+		backend: &memoryBackend{creds: creds},
+		audit:   config.AuditConfig{Path: logPath},
+		secrets: &memorySecrets{},
+		client:  "test-service",
+	}, logPath
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s, logPath := newTestStore(t,
+		kc.Credential{Domain: "github.com", Username: "octocat", Password: kc.NewSecretString("hunter2"), Tags: []string{"dev"}},
+		kc.Credential{Domain: "db.internal", Username: "app", Password: kc.NewSecretString("db-secret")},
+	)
+
+	// Partial domains resolve as on the command line
+	cred, err := s.Get(ctx, "github", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", cred.Password.Reveal())
+	_, err = s.Get(ctx, "github", &GetOptions{Exact: true})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Errors and credentials are the package's own types
+	assert.NoError(t, s.Put(ctx, &Credential{Domain: "gitlab.com", Username: "tanuki", Password: NewSecretString("pw"), Notes: "2fa codes"}, nil))
+	_, err = s.Get(ctx, "git", nil)
+	var ambiguous *AmbiguousDomainError
+	assert.ErrorAs(t, err, &ambiguous)
+	assert.Equal(t, []string{"github.com", "gitlab.com"}, ambiguous.Candidates)
+	cred, err = s.Get(ctx, "gitlab.com", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "2fa codes", cred.Notes)
+	assert.Equal(t, Redacted, fmt.Sprint(cred.Password))
+	data, err := json.Marshal(cred)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "pw")
+	assert.NoError(t, s.Delete(ctx, "gitlab.com", nil))
+
+	assert.NoError(t, s.Put(ctx, &Credential{Domain: "https://API.example.com/v1", Username: "svc", Password: NewSecretString("token")}, nil))
+	cred, err = s.Get(ctx, "api.example.com", &GetOptions{Username: "svc"})
+	assert.NoError(t, err)
+	assert.Equal(t, "token", cred.Password.Reveal())
+
+	err = s.Put(ctx, &Credential{Domain: "api.example.com", Username: "svc", Password: NewSecretString("other")}, &PutOptions{NoOverwrite: true})
+	assert.ErrorIs(t, err, ErrDuplicate)
+	assert.Error(t, s.Put(ctx, &Credential{Domain: "api.example.com", Username: "svc"}, nil))
+
+	creds, err := s.List(ctx, &ListOptions{Tags: []string{"dev"}})
+	assert.NoError(t, err)
+	assert.Len(t, creds, 1)
+	assert.True(t, creds[0].Password.IsEmpty())
+
+	assert.NoError(t, s.Delete(ctx, "db.internal", &DeleteOptions{Username: "app"}))
+	assert.ErrorIs(t, s.Delete(ctx, "db.internal", nil), ErrNotFound)
+
+	// Accesses are logged under the client name
+	entries, err := audit.Read(logPath)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 9)
+	assert.Equal(t, "test-service", entries[0].Command)
+	assert.NoError(t, audit.Verify(logPath, s.secrets.(*memorySecrets).key, s.secrets))
+}
+
+func TestOpenProfile(t *testing.T) {
+	t.Setenv("PASSKC_PROFILE", "")
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+
+	s, err := Open(Options{ConfigPath: cfgPath})
+	assert.NoError(t, err)
+	assert.Equal(t, kc.DefaultProfile, s.(*store).backend.(keychainBackend).profile.Name())
+
+	assert.NoError(t, config.SetProfile(cfgPath, "from-config"))
+	s, err = Open(Options{ConfigPath: cfgPath})
+	assert.NoError(t, err)
+	assert.Equal(t, "from-config", s.(*store).backend.(keychainBackend).profile.Name())
+
+	t.Setenv("PASSKC_PROFILE", "from-env")
+	s, err = Open(Options{ConfigPath: cfgPath})
+	assert.NoError(t, err)
+	assert.Equal(t, "from-env", s.(*store).backend.(keychainBackend).profile.Name())
+
+	// Options.Profile wins, and does not change the command's selection
+	s, err = Open(Options{ConfigPath: cfgPath, Profile: "client-a"})
+	assert.NoError(t, err)
+	assert.Equal(t, "client-a", s.(*store).backend.(keychainBackend).profile.Name())
+	assert.Equal(t, kc.DefaultProfile, kc.CurrentProfile())
+
+	_, err = Open(Options{ConfigPath: cfgPath, Profile: "Not Valid"})
+	assert.Error(t, err)
+}
+
+func TestStoreContext(t *testing.T) {
+	s, _ := newTestStore(t, kc.Credential{Domain: "github.com", Username: "octocat"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := s.Get(ctx, "github.com", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// A keychain call that hangs does not hold up the caller
+	backend := s.backend.(*memoryBackend)
+	backend.block = make(chan struct{})
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = s.List(ctx, nil)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// A write is waited for, so its result is never hidden by ctx
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(backend.block)
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = s.Put(ctx, &Credential{Domain: "gitlab.com", Username: "tanuki", Password: NewSecretString("pw")}, nil)
+	assert.NoError(t, err)
+	backend.mu.Lock()
+	assert.Len(t, backend.creds, 2)
+	backend.mu.Unlock()
+}
+
+func TestStoreWatch(t *testing.T) {
+	s, _ := newTestStore(t,
+		kc.Credential{Domain: "github.com", Username: "octocat"},
+		kc.Credential{Domain: "db.internal", Username: "app"},
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := s.Watch(ctx, &WatchOptions{Interval: time.Millisecond})
+	assert.NoError(t, err)
+
+	backend := s.backend.(*memoryBackend)
+	backend.mu.Lock()
+	backend.creds = []kc.Credential{
+		{Domain: "github.com", Username: "octocat", Tags: []string{"dev"}},
+		{Domain: "api.example.com", Username: "svc"},
+	}
+	backend.mu.Unlock()
+
+	got := make([]Event, 0, 3)
+	for len(got) < 3 {
+		got = append(got, <-events)
+	}
+	assert.Equal(t, EventChanged, got[0].Type)
+	assert.Equal(t, "github.com", got[0].Credential.Domain)
+	assert.Equal(t, EventAdded, got[1].Type)
+	assert.Equal(t, "api.example.com", got[1].Credential.Domain)
+	assert.Equal(t, EventRemoved, got[2].Type)
+	assert.Equal(t, "db.internal", got[2].Credential.Domain)
+
+	cancel()
+	for range events {
+	}
+}
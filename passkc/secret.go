@@ -0,0 +1,110 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package passkc
+
+import (
+	"encoding/json"
+
+	"github.com/e6a5/passkc/kc"
+)
+
+// Redacted is what a Secret prints as, and what JSON shows in place of a
+// password.
+const Redacted = "[REDACTED]"
+
+// Secret holds a password in memory that is locked against being swapped
+// to disk and wiped when it is destroyed or garbage collected. String,
+// GoString and MarshalJSON redact it: use Bytes or Reveal to read it.
+//
+// Copying a Secret, or a Credential holding one, does not copy the
+// password: the copies share one buffer, and destroying any of them
+// empties them all. Use Clone for an independent copy.
+//
+// The zero value is an empty secret.
+type Secret struct {
+	secret kc.Secret
+}
+
+// NewSecret copies b into locked memory and wipes b.
+func NewSecret(b []byte) Secret {
+	return Secret{secret: kc.NewSecret(b)}
+}
+
+// NewSecretString copies s into locked memory. The string itself cannot be
+// wiped.
+func NewSecretString(s string) Secret {
+	return Secret{secret: kc.NewSecretString(s)}
+}
+
+// Len returns the length of the secret in bytes.
+func (s Secret) Len() int {
+	return s.secret.Len()
+}
+
+// IsEmpty reports whether the secret has no content.
+func (s Secret) IsEmpty() bool {
+	return s.secret.IsEmpty()
+}
+
+// Bytes returns the secret without copying it. The slice is only valid
+// until Destroy and must not be modified or kept. The memory is released
+// when s is garbage collected, so call runtime.KeepAlive(s) after the last
+// use of the slice.
+func (s Secret) Bytes() []byte {
+	return s.secret.Bytes()
+}
+
+// Reveal returns the secret as a string. Go strings cannot be wiped, so
+// use it only where a string is required.
+func (s Secret) Reveal() string {
+	return s.secret.Reveal()
+}
+
+// Clone returns a copy of the secret in its own locked memory, which can be
+// destroyed independently.
+func (s Secret) Clone() Secret {
+	return Secret{secret: s.secret.Clone()}
+}
+
+// Equal reports whether two secrets hold the same bytes, in constant time.
+func (s Secret) Equal(other Secret) bool {
+	return s.secret.Equal(other.secret)
+}
+
+// Destroy wipes and releases the secret. Copies made with Reveal are not
+// affected.
+func (s Secret) Destroy() {
+	s.secret.Destroy()
+}
+
+func (s Secret) String() string {
+	return Redacted
+}
+
+func (s Secret) GoString() string {
+	return Redacted
+}
+
+// MarshalJSON redacts the secret.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Redacted)
+}
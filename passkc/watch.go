@@ -0,0 +1,123 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package passkc
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+)
+
+// The keychain has no change notifications, so Watch polls it.
+func (s *store) Watch(ctx context.Context, opts *WatchOptions) (<-chan Event, error) {
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	initial, err := s.List(ctx, &opts.ListOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		send := func(e Event) bool {
+			select {
+			case events <- e:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		known := indexCredentials(initial)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			current, err := s.List(ctx, &opts.ListOptions)
+			if err != nil {
+				if ctx.Err() != nil || !send(Event{Type: EventError, Err: err}) {
+					return
+				}
+				continue
+			}
+			next := indexCredentials(current)
+			for _, e := range diffCredentials(known, next, current) {
+				if !send(e) {
+					return
+				}
+			}
+			known = next
+		}
+	}()
+	return events, nil
+}
+
+func credentialKey(cred Credential) string {
+	return cred.Domain + "\x00" + cred.Username
+}
+
+func indexCredentials(creds []Credential) map[string]Credential {
+	index := make(map[string]Credential, len(creds))
+	for _, cred := range creds {
+		index[credentialKey(cred)] = cred
+	}
+	return index
+}
+
+// diffCredentials returns the events that turn before into after. current
+// is after as a list, so that events come in keychain order.
+func diffCredentials(before, after map[string]Credential, current []Credential) []Event {
+	events := make([]Event, 0)
+	for _, cred := range current {
+		old, ok := before[credentialKey(cred)]
+		switch {
+		case !ok:
+			events = append(events, Event{Type: EventAdded, Credential: cred})
+		case !slices.Equal(old.Tags, cred.Tags):
+			events = append(events, Event{Type: EventChanged, Credential: cred})
+		}
+	}
+	removed := make([]string, 0)
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		events = append(events, Event{Type: EventRemoved, Credential: before[key]})
+	}
+	return events
+}
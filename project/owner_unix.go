@@ -0,0 +1,15 @@
+//go:build unix
+
+package project
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByOther reports whether a file belongs to someone other than the
+// current user.
+func ownedByOther(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) != os.Getuid()
+}
@@ -0,0 +1,266 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+// Package project reads the .passkc.yaml file that declares the
+// credentials a repository needs and the environment variables they go in.
+package project
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/e6a5/passkc/format"
+	"github.com/e6a5/passkc/kc"
+	"github.com/e6a5/passkc/vault"
+	"gopkg.in/yaml.v3"
+)
+
+// Where a project is declared, relative to its root directory. The
+// .passkc directory can also hold the project's team vault.
+const (
+	FileName = ".passkc.yaml"
+	DirName  = ".passkc"
+	// dirFile is the project file inside DirName.
+	dirFile = "project.yaml"
+)
+
+// Backends an entry can come from.
+const (
+	BackendKeychain = "keychain"
+	BackendTeam     = "team"
+)
+
+// Project is a project file.
+type Project struct {
+	// Path is the file the project was read from.
+	Path string `yaml:"-"`
+	// Root is the directory the project belongs to.
+	Root string `yaml:"-"`
+	// Hash is the SHA-256 of the file's contents, which is what an
+	// Allowlist records.
+	Hash string `yaml:"-"`
+
+	// Profile is the profile keychain entries come from, unless an entry
+	// names its own. Empty means the profile selected for the command.
+	Profile string `yaml:"profile"`
+	// Vault is the team vault directory for team entries, relative to
+	// Root. Empty means the .passkc directory when it holds a vault, else
+	// team.vault from the config file.
+	Vault   string  `yaml:"vault"`
+	Entries []Entry `yaml:"entries"`
+}
+
+// Entry is a credential the project needs.
+type Entry struct {
+	Domain string `yaml:"domain"`
+	// Username picks one account when the domain has several.
+	Username string `yaml:"username"`
+	Profile  string `yaml:"profile"`
+	// Backend is BackendKeychain, the default, or BackendTeam.
+	Backend string `yaml:"backend"`
+	// Env maps variable names to "password", "username" or a field name.
+	Env map[string]string `yaml:"env"`
+}
+
+// Find looks for a project file in dir and its parents, like git looks for
+// .git. The file at skip, the user's own config file, is not a project
+// file even though it has the same name. It returns "" if there is none.
+func Find(dir, skip string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if skip != "" {
+		if skip, err = filepath.Abs(skip); err != nil {
+			return "", err
+		}
+	}
+	for {
+		for _, path := range []string{filepath.Join(dir, FileName), filepath.Join(dir, DirName, dirFile)} {
+			if path == skip {
+				continue
+			}
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				return path, nil
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Load reads and validates the project file at path. Files that another
+// user could have written are refused: ones owned by someone else, and
+// ones that are group- or world-writable.
+func Load(path string) (*Project, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read project file '%s': %v", path, err)
+	}
+	defer func() { _ = f.Close() }()
+	// Check the file that was opened, not whatever is at path now
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read project file '%s': %v", path, err)
+	}
+	if ownedByOther(info) {
+		return nil, fmt.Errorf("project file '%s' is owned by another user", path)
+	}
+	if info.Mode().Perm()&0o022 != 0 {
+		return nil, fmt.Errorf("project file '%s' is writable by other users. Run 'chmod go-w %s'", path, path)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read project file '%s': %v", path, err)
+	}
+
+	digest := sha256.Sum256(data)
+	p := &Project{Path: path, Root: filepath.Dir(path), Hash: hex.EncodeToString(digest[:])}
+	if filepath.Base(p.Root) == DirName {
+		p.Root = filepath.Dir(p.Root)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid project file '%s': %v", path, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid project file '%s': %v", path, err)
+	}
+	return p, nil
+}
+
+func (p *Project) validate() error {
+	if p.Profile != "" {
+		if err := kc.ValidateProfile(p.Profile); err != nil {
+			return err
+		}
+	}
+	names := make(map[string]string)
+	for i := range p.Entries {
+		e := &p.Entries[i]
+		if e.Domain == "" {
+			return fmt.Errorf("entry %d has no domain", i+1)
+		}
+		domain, err := kc.NormalizeDomain(e.Domain)
+		if err != nil {
+			return fmt.Errorf("entry %d: %v", i+1, err)
+		}
+		e.Domain = domain
+		switch e.Backend {
+		case "":
+			e.Backend = BackendKeychain
+		case BackendKeychain, BackendTeam:
+		default:
+			return fmt.Errorf("%s: unknown backend '%s'. Use %s or %s", e.Domain, e.Backend, BackendKeychain, BackendTeam)
+		}
+		if e.Profile != "" {
+			if e.Backend == BackendTeam {
+				return fmt.Errorf("%s: team entries have no profile", e.Domain)
+			}
+			if err := kc.ValidateProfile(e.Profile); err != nil {
+				return fmt.Errorf("%s: %v", e.Domain, err)
+			}
+		}
+		if len(e.Env) == 0 {
+			return fmt.Errorf("%s: no env variables", e.Domain)
+		}
+		for name, part := range e.Env {
+			if format.EnvName(name) != name {
+				return fmt.Errorf("%s: invalid variable name '%s'", e.Domain, name)
+			}
+			if part == "" {
+				return fmt.Errorf("%s: %s does not say which part to use", e.Domain, name)
+			}
+			if other, ok := names[name]; ok {
+				return fmt.Errorf("%s is set by both %s and %s", name, other, e.Domain)
+			}
+			names[name] = e.Domain
+		}
+	}
+	return nil
+}
+
+// EntryProfile returns the profile a keychain entry comes from, or "" for
+// the profile selected for the command.
+func (p *Project) EntryProfile(e *Entry) string {
+	if e.Profile != "" {
+		return e.Profile
+	}
+	return p.Profile
+}
+
+// VaultDir returns the team vault directory for team entries, or "" to
+// use the one from the config file.
+func (p *Project) VaultDir() string {
+	if p.Vault != "" {
+		if filepath.IsAbs(p.Vault) {
+			return p.Vault
+		}
+		return filepath.Join(p.Root, p.Vault)
+	}
+	if dir := filepath.Join(p.Root, DirName); vault.Exists(dir) {
+		return dir
+	}
+	return ""
+}
+
+// Names returns the variable names of an entry, sorted.
+func (e *Entry) Names() []string {
+	names := make([]string, 0, len(e.Env))
+	for name := range e.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Allowlist holds the project files the user has reviewed and allowed,
+// by path, with the hash of the contents they saw. A project file can
+// name any profile or domain, so commands that hand out secrets only use
+// allowed ones; a file that changes has to be allowed again.
+type Allowlist map[string]string
+
+// Allow records the project file as it is now.
+func (a Allowlist) Allow(p *Project) {
+	a[p.Path] = p.Hash
+}
+
+// Allowed reports whether the project file was allowed with its current
+// contents.
+func (a Allowlist) Allowed(p *Project) bool {
+	hash, ok := a[p.Path]
+	return ok && hash == p.Hash
+}
@@ -0,0 +1,102 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestFind(t *testing.T) {
+	home := t.TempDir()
+	repo := filepath.Join(home, "src", "repo")
+	deep := filepath.Join(repo, "cmd", "server")
+	assert.NoError(t, os.MkdirAll(deep, 0o700))
+
+	// The user's own config is not a project file
+	write(t, filepath.Join(home, FileName), "audit:\n  disabled: true\n")
+	path, err := Find(deep, filepath.Join(home, FileName))
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+
+	write(t, filepath.Join(repo, DirName, "project.yaml"), "entries: []\n")
+	path, err = Find(deep, filepath.Join(home, FileName))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(repo, DirName, "project.yaml"), path)
+
+	p, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, repo, p.Root)
+
+	// A file closer to the working directory wins
+	write(t, filepath.Join(repo, "cmd", FileName), "entries: []\n")
+	path, err = Find(deep, "")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(repo, "cmd", FileName), path)
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, FileName)
+	write(t, path, `profile: work
+vault: ../ops-vault
+entries:
+  - domain: https://DB.internal/
+    env:
+      DB_PASSWORD: password
+      DB_USER: username
+  - domain: stripe.com
+    backend: team
+    env:
+      STRIPE_KEY: password
+`)
+	p, err := Load(path)
+	assert.NoError(t, err)
+	assert.Len(t, p.Entries, 2)
+	assert.Equal(t, "db.internal", p.Entries[0].Domain)
+	assert.Equal(t, BackendKeychain, p.Entries[0].Backend)
+	assert.Equal(t, "work", p.EntryProfile(&p.Entries[0]))
+	assert.Equal(t, []string{"DB_PASSWORD", "DB_USER"}, p.Entries[0].Names())
+	assert.Equal(t, filepath.Join(filepath.Dir(dir), "ops-vault"), p.VaultDir())
+
+	for content, msg := range map[string]string{
+		"entries:\n  - env: {A: password}\n":                                                               "no domain",
+		"entries:\n  - domain: a.com\n    backend: s3\n    env: {A: password}\n":                           "unknown backend",
+		"entries:\n  - domain: a.com\n    env: {a-b: password}\n":                                          "invalid variable name",
+		"entries:\n  - domain: a.com\n    env: {A: password}\n  - domain: b.com\n    env: {A: password}\n": "A is set by both",
+		"entries:\n  - domain: a.com\n    secret: x\n":                                                     "field secret not found",
+	} {
+		write(t, path, content)
+		_, err := Load(path)
+		assert.ErrorContains(t, err, msg)
+	}
+}
+
+func TestLoadRefusesUnsafeFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	write(t, path, "entries: []\n")
+	p, err := Load(path)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Chmod(path, 0o666))
+	_, err = Load(path)
+	assert.ErrorContains(t, err, "writable by other users")
+	assert.NoError(t, os.Chmod(path, 0o644))
+
+	// Allowing covers the contents at the time, not later changes
+	allowed := Allowlist{}
+	assert.False(t, allowed.Allowed(p))
+	allowed.Allow(p)
+	assert.True(t, allowed.Allowed(p))
+	write(t, path, "profile: personal\nentries: []\n")
+	p, err = Load(path)
+	assert.NoError(t, err)
+	assert.False(t, allowed.Allowed(p))
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+// Package shamir implements Shamir's secret sharing over GF(2^8), splitting a
+// secret into shares of which any threshold recover it and fewer reveal
+// nothing about it.
+package shamir
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// Share is one part of a split secret. X is its non-zero evaluation point
+// and Y holds one byte per byte of the secret.
+type Share struct {
+	X byte
+	Y []byte
+}
+
+// Split divides secret into n shares, any threshold of which recover it.
+func Split(secret []byte, n, threshold int) ([]Share, error) {
+	if threshold < 2 || threshold > n {
+		return nil, fmt.Errorf("threshold must be between 2 and the number of shares")
+	}
+	if n > 255 {
+		return nil, fmt.Errorf("cannot make more than 255 shares")
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("cannot split an empty secret")
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{X: byte(i + 1), Y: make([]byte, len(secret))}
+	}
+
+	// One random polynomial of degree threshold-1 per secret byte, with the
+	// secret byte as its constant term
+	coeffs := make([]byte, threshold)
+	for b, s := range secret {
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		coeffs[0] = s
+		for i := range shares {
+			shares[i].Y[b] = evaluate(coeffs, shares[i].X)
+		}
+	}
+	return shares, nil
+}
+
+// Combine recovers a secret from at least threshold shares. With fewer it
+// returns garbage, so callers should check the result.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("at least 2 shares are needed")
+	}
+	size := len(shares[0].Y)
+	seen := make(map[byte]bool, len(shares))
+	for _, s := range shares {
+		if s.X == 0 || len(s.Y) != size {
+			return nil, fmt.Errorf("shares are not from the same split")
+		}
+		if seen[s.X] {
+			return nil, fmt.Errorf("share %d was given twice", s.X)
+		}
+		seen[s.X] = true
+	}
+
+	// Lagrange interpolation at x = 0
+	secret := make([]byte, size)
+	for i, si := range shares {
+		basis := byte(1)
+		for j, sj := range shares {
+			if i != j {
+				basis = mul(basis, div(sj.X, sj.X^si.X))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= mul(si.Y[b], basis)
+		}
+	}
+	return secret, nil
+}
+
+// evaluate computes the polynomial with the given coefficients at x.
+func evaluate(coeffs []byte, x byte) byte {
+	result := byte(0)
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		result = mul(result, x) ^ coeffs[i]
+	}
+	return result
+}
+
+// mul multiplies in GF(2^8) with the AES polynomial x^8+x^4+x^3+x+1.
+func mul(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+// div divides in GF(2^8); b must not be zero.
+func div(a, b byte) byte {
+	// b^254 is the inverse of b
+	inv := byte(1)
+	for i := 0; i < 254; i++ {
+		inv = mul(inv, b)
+	}
+	return mul(a, inv)
+}
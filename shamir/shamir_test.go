@@ -0,0 +1,48 @@
+package shamir
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("AGE-SECRET-KEY-1EXAMPLE")
+	shares, err := Split(secret, 5, 3)
+	assert.NoError(t, err)
+	assert.Len(t, shares, 5)
+
+	// Any three shares recover the secret
+	for _, pick := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		subset := make([]Share, 0, len(pick))
+		for _, i := range pick {
+			subset = append(subset, shares[i])
+		}
+		got, err := Combine(subset)
+		assert.NoError(t, err)
+		assert.Equal(t, secret, got)
+	}
+
+	// Two do not
+	got, err := Combine(shares[:2])
+	assert.NoError(t, err)
+	assert.NotEqual(t, secret, got)
+
+	_, err = Combine([]Share{shares[0], shares[0]})
+	assert.ErrorContains(t, err, "twice")
+}
+
+func TestSplitErrors(t *testing.T) {
+	_, err := Split([]byte("x"), 3, 4)
+	assert.Error(t, err)
+	_, err = Split([]byte("x"), 3, 1)
+	assert.Error(t, err)
+	_, err = Split(nil, 3, 2)
+	assert.Error(t, err)
+}
+
+func TestFieldArithmetic(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		assert.Equal(t, byte(1), mul(byte(a), div(1, byte(a))))
+	}
+}
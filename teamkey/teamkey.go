@@ -0,0 +1,281 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+// Package teamkey stores a user's team vault identities. The current
+// identity is the one other members encrypt to; identities it replaced
+// are kept so that vaults still encrypting to them stay readable. The
+// stored form can be sealed with a passphrase, optionally combined with
+// a keyfile, through scrypt with a tunable work factor.
+package teamkey
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// version is bumped when the sealed form changes incompatibly.
+const version = 1
+
+// Work factors are log2 of the scrypt N parameter. Each step doubles the
+// time and memory needed to try a passphrase.
+const (
+	MinWorkFactor     = 15
+	DefaultWorkFactor = 18
+	MaxWorkFactor     = 30
+)
+
+// ErrWrongPassphrase is returned when sealed keys cannot be opened with
+// the given passphrase and keyfile.
+var ErrWrongPassphrase = errors.New("wrong passphrase or keyfile")
+
+// Protection describes how stored keys are sealed.
+type Protection struct {
+	// WorkFactor is the scrypt work factor. Zero means the keys are
+	// stored unsealed and rely on the keychain alone.
+	WorkFactor int `json:"work_factor"`
+	// Keyfile is the path of a file whose contents are needed along
+	// with the passphrase.
+	Keyfile string `json:"keyfile,omitempty"`
+}
+
+// Sealed reports whether a passphrase is needed to open the keys.
+func (p Protection) Sealed() bool {
+	return p.WorkFactor > 0
+}
+
+// Keys is a user's set of team identities.
+type Keys struct {
+	Current  *age.X25519Identity
+	Previous []*age.X25519Identity
+
+	protection Protection
+	sealer     *age.ScryptRecipient
+}
+
+// sealedKeys is the stored form of sealed keys. The parameters are kept
+// outside the ciphertext so that the right prompts can be shown.
+type sealedKeys struct {
+	Version int `json:"version"`
+	Protection
+	Keys string `json:"keys"`
+}
+
+// Generate returns a new, unsealed set with a single identity.
+func Generate() (*Keys, error) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, err
+	}
+	return &Keys{Current: identity}, nil
+}
+
+// Secret combines a passphrase with the contents of a keyfile, if any,
+// into the passphrase given to scrypt.
+func Secret(passphrase string, keyfile []byte) string {
+	if keyfile == nil {
+		return passphrase
+	}
+	digest := sha256.Sum256(keyfile)
+	return passphrase + "\x00" + hex.EncodeToString(digest[:])
+}
+
+// Parse reads stored keys. For sealed keys, unlock is called with their
+// protection and returns the secret to open them with, usually from
+// Secret.
+func Parse(data []byte, unlock func(Protection) (string, error)) (*Keys, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return parseIdentities(string(data))
+	}
+
+	var sealed sealedKeys
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return nil, fmt.Errorf("invalid team keys: %v", err)
+	}
+	if sealed.Version != version {
+		return nil, fmt.Errorf("unsupported team keys version %d", sealed.Version)
+	}
+	secret, err := unlock(sealed.Protection)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.NewScryptIdentity(secret)
+	if err != nil {
+		return nil, err
+	}
+	identity.SetMaxWorkFactor(MaxWorkFactor)
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(sealed.Keys)), identity)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid team keys: %v", err)
+	}
+
+	keys, err := parseIdentities(string(plaintext))
+	if err != nil {
+		return nil, err
+	}
+	if err := keys.Protect(sealed.Protection, secret); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// parseIdentities reads one identity per line, the current one first.
+func parseIdentities(text string) (*Keys, error) {
+	identities, err := age.ParseIdentities(strings.NewReader(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid team keys: %v", err)
+	}
+	keys := &Keys{}
+	for _, identity := range identities {
+		x25519, ok := identity.(*age.X25519Identity)
+		if !ok {
+			return nil, fmt.Errorf("invalid team keys: unexpected identity type %T", identity)
+		}
+		if keys.Current == nil {
+			keys.Current = x25519
+		} else {
+			keys.Previous = append(keys.Previous, x25519)
+		}
+	}
+	return keys, nil
+}
+
+// Protection returns how the keys are sealed when marshaled.
+func (k *Keys) Protection() Protection {
+	return k.protection
+}
+
+// Protect changes how the keys are sealed. A zero work factor stores them
+// unsealed and ignores secret.
+func (k *Keys) Protect(p Protection, secret string) error {
+	if !p.Sealed() {
+		if p.Keyfile != "" {
+			return fmt.Errorf("a keyfile needs a passphrase")
+		}
+		k.protection, k.sealer = p, nil
+		return nil
+	}
+	if p.WorkFactor < MinWorkFactor || p.WorkFactor > MaxWorkFactor {
+		return fmt.Errorf("work factor must be between %d and %d", MinWorkFactor, MaxWorkFactor)
+	}
+	if secret == "" {
+		return fmt.Errorf("passphrase cannot be empty")
+	}
+	sealer, err := age.NewScryptRecipient(secret)
+	if err != nil {
+		return err
+	}
+	sealer.SetWorkFactor(p.WorkFactor)
+	k.protection, k.sealer = p, sealer
+	return nil
+}
+
+// Marshal returns the stored form of the keys, sealed as set by Protect.
+func (k *Keys) Marshal() ([]byte, error) {
+	text := k.identities()
+	if k.sealer == nil {
+		return []byte(text), nil
+	}
+
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, k.sealer)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, text); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealedKeys{Version: version, Protection: k.protection, Keys: buf.String()})
+}
+
+// identities lists every identity, one per line, the current one first.
+func (k *Keys) identities() string {
+	var b strings.Builder
+	for _, identity := range k.All() {
+		b.WriteString(identity.String() + "\n")
+	}
+	return b.String()
+}
+
+// All returns every identity, the current one first.
+func (k *Keys) All() []*age.X25519Identity {
+	return append([]*age.X25519Identity{k.Current}, k.Previous...)
+}
+
+// Equal reports whether both sets hold the same identities in the same
+// order.
+func (k *Keys) Equal(other *Keys) bool {
+	return k.identities() == other.identities()
+}
+
+// Find returns the identity whose public key is recipient.
+func (k *Keys) Find(recipient string) (*age.X25519Identity, bool) {
+	for _, identity := range k.All() {
+		if identity.Recipient().String() == recipient {
+			return identity, true
+		}
+	}
+	return nil, false
+}
+
+// Rotate generates a new current identity. The one it replaces is kept
+// for the vaults that still encrypt to it.
+func (k *Keys) Rotate() error {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return err
+	}
+	k.Previous = append([]*age.X25519Identity{k.Current}, k.Previous...)
+	k.Current = identity
+	return nil
+}
+
+// Unwrap implements age.Identity by trying every identity in turn, so
+// files encrypted to a replaced identity can still be decrypted.
+func (k *Keys) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	for _, identity := range k.All() {
+		fileKey, err := identity.Unwrap(stanzas)
+		if errors.Is(err, age.ErrIncorrectIdentity) {
+			continue
+		}
+		return fileKey, err
+	}
+	return nil, age.ErrIncorrectIdentity
+}
@@ -0,0 +1,76 @@
+package teamkey
+
+import (
+	"bytes"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeysRotate(t *testing.T) {
+	keys, err := Generate()
+	assert.NoError(t, err)
+	old := keys.Current
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, old.Recipient())
+	assert.NoError(t, err)
+	_, _ = w.Write([]byte("secret"))
+	assert.NoError(t, w.Close())
+
+	assert.NoError(t, keys.Rotate())
+	assert.NotEqual(t, old.String(), keys.Current.String())
+	assert.Equal(t, []*age.X25519Identity{old}, keys.Previous)
+
+	// Files encrypted to the replaced identity stay readable
+	_, err = age.Decrypt(&buf, keys)
+	assert.NoError(t, err)
+	found, ok := keys.Find(old.Recipient().String())
+	assert.True(t, ok)
+	assert.Equal(t, old, found)
+
+	// Unsealed keys are plain identity lines, as older versions stored
+	data, err := keys.Marshal()
+	assert.NoError(t, err)
+	parsed, err := Parse(data, nil)
+	assert.NoError(t, err)
+	assert.True(t, keys.Equal(parsed))
+	parsed, err = Parse([]byte(old.String()), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, old.String(), parsed.Current.String())
+}
+
+func TestKeysSealed(t *testing.T) {
+	keys, err := Generate()
+	assert.NoError(t, err)
+	secret := Secret("correct horse", []byte("keyfile contents"))
+	assert.NotEqual(t, Secret("correct horse", nil), secret)
+
+	assert.ErrorContains(t, keys.Protect(Protection{WorkFactor: 5}, secret), "work factor")
+	assert.ErrorContains(t, keys.Protect(Protection{Keyfile: "/key"}, ""), "needs a passphrase")
+	protection := Protection{WorkFactor: MinWorkFactor, Keyfile: "/key"}
+	assert.NoError(t, keys.Protect(protection, secret))
+	data, err := keys.Marshal()
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), keys.Current.String())
+
+	unlock := func(s string) func(Protection) (string, error) {
+		return func(p Protection) (string, error) {
+			assert.Equal(t, protection, p)
+			return s, nil
+		}
+	}
+	_, err = Parse(data, unlock(Secret("correct horse", nil)))
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+	parsed, err := Parse(data, unlock(secret))
+	assert.NoError(t, err)
+	assert.True(t, keys.Equal(parsed))
+	assert.Equal(t, protection, parsed.Protection())
+
+	// Re-marshaling keeps the protection
+	data, err = parsed.Marshal()
+	assert.NoError(t, err)
+	_, err = Parse(data, unlock(secret))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,427 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package tui
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/e6a5/passkc/kc"
+)
+
+// Action tells the caller why the browser returned.
+type Action int
+
+const (
+	// ActionQuit means the user left without choosing an entry.
+	ActionQuit Action = iota
+	// ActionSelect means the user pressed Enter on an entry.
+	ActionSelect
+	// ActionEdit means the user asked to edit an entry. Editing needs the
+	// normal terminal, so the caller does it after the browser has closed.
+	ActionEdit
+)
+
+// Browser is a full-screen fuzzy finder over credentials.
+type Browser struct {
+	// Title is shown in the header, e.g. the command that opened the browser.
+	Title   string
+	Entries []kc.Credential
+
+	// Load fetches the password and fields of an entry. It is only called
+	// when the user reveals or copies one, since it may ask to unlock the
+	// keychain; the result is kept until the browser returns.
+	Load func(kc.Credential) (*kc.Credential, error)
+	// Copy puts a password on the clipboard. Nil disables Ctrl-Y.
+	Copy func(password kc.Secret) error
+	// Delete removes one account after the user confirmed. Nil disables
+	// Ctrl-D.
+	Delete func(kc.Credential) error
+	// AllowEdit enables Ctrl-E.
+	AllowEdit bool
+
+	query      []rune
+	matches    []kc.Credential
+	cursor     int
+	offset     int
+	details    map[string]loaded
+	revealed   bool
+	confirming bool
+	status     string
+}
+
+// loaded is the outcome of Load for one entry. Failures are kept too, so
+// a failing entry is not retried on every redraw.
+type loaded struct {
+	cred *kc.Credential
+	err  error
+}
+
+// Run shows the browser until the user selects an entry or quits. The
+// returned credential holds no password.
+func (b *Browser) Run(t Terminal) (Action, *kc.Credential, error) {
+	b.details = make(map[string]loaded)
+	defer b.forget()
+	b.filter()
+
+	for {
+		if err := b.draw(t); err != nil {
+			return ActionQuit, nil, err
+		}
+
+		key, err := t.ReadKey()
+		if err == io.EOF {
+			return ActionQuit, nil, nil
+		}
+		if err != nil {
+			return ActionQuit, nil, err
+		}
+
+		if action, cred, done := b.handle(key); done {
+			return action, cred, nil
+		}
+	}
+}
+
+// handle applies a key press and reports whether the browser is done.
+func (b *Browser) handle(key Key) (Action, *kc.Credential, bool) {
+	// Revealing only lasts until the next key press
+	wasRevealed := b.revealed
+	b.revealed = false
+	b.status = ""
+
+	if b.confirming {
+		b.confirming = false
+		cred := b.selected()
+		if key.Code == KeyRune && unicode.ToLower(key.Rune) == 'y' && cred != nil {
+			if err := b.Delete(*cred); err != nil {
+				b.status = fmt.Sprintf("Error: %v", err)
+			} else {
+				b.remove(*cred)
+				b.status = fmt.Sprintf("✓ Removed credentials for %s@%s", cred.Username, cred.Domain)
+			}
+		} else {
+			b.status = "Canceled."
+		}
+		return ActionQuit, nil, false
+	}
+
+	switch key.Code {
+	case KeyEscape, KeyCtrlC:
+		return ActionQuit, nil, true
+	case KeyEnter:
+		if cred := b.selected(); cred != nil {
+			return ActionSelect, cred, true
+		}
+	case KeyUp, KeyCtrlP:
+		if b.cursor > 0 {
+			b.cursor--
+		}
+	case KeyDown, KeyCtrlN:
+		if b.cursor < len(b.matches)-1 {
+			b.cursor++
+		}
+	case KeyBackspace:
+		if len(b.query) > 0 {
+			b.query = b.query[:len(b.query)-1]
+			b.filter()
+		}
+	case KeyCtrlU:
+		b.query = nil
+		b.filter()
+	case KeyRune:
+		b.query = append(b.query, key.Rune)
+		b.filter()
+	case KeyCtrlR:
+		b.revealed = !wasRevealed && b.selected() != nil
+	case KeyCtrlY:
+		b.copySelected()
+	case KeyCtrlE:
+		if cred := b.selected(); cred != nil && b.AllowEdit {
+			return ActionEdit, cred, true
+		}
+	case KeyCtrlD:
+		if cred := b.selected(); cred != nil && b.Delete != nil {
+			b.confirming = true
+			b.status = fmt.Sprintf("Remove credentials for '%s' (username: %s)? [y/N]", cred.Domain, cred.Username)
+		}
+	}
+	return ActionQuit, nil, false
+}
+
+func (b *Browser) selected() *kc.Credential {
+	if b.cursor < 0 || b.cursor >= len(b.matches) {
+		return nil
+	}
+	cred := b.matches[b.cursor]
+	return &cred
+}
+
+// detail returns the loaded credential, loading it on first use so
+// unlocking is only asked for entries the user reveals or copies.
+func (b *Browser) detail(cred kc.Credential) (*kc.Credential, error) {
+	key := cred.Domain + "\x00" + cred.Username
+	if d, ok := b.details[key]; ok {
+		return d.cred, d.err
+	}
+	if b.Load == nil {
+		return &cred, nil
+	}
+	full, err := b.Load(cred)
+	b.details[key] = loaded{cred: full, err: err}
+	return full, err
+}
+
+// forget destroys the loaded passwords.
+func (b *Browser) forget() {
+	for key, d := range b.details {
+		if d.cred != nil {
+			d.cred.Password.Destroy()
+		}
+		delete(b.details, key)
+	}
+}
+
+func (b *Browser) copySelected() {
+	cred := b.selected()
+	if cred == nil || b.Copy == nil {
+		return
+	}
+	full, err := b.detail(*cred)
+	if err == nil {
+		err = b.Copy(full.Password)
+	}
+	if err != nil {
+		b.status = fmt.Sprintf("Error: %v", err)
+		return
+	}
+	b.status = fmt.Sprintf("✓ Copied password for %s@%s", cred.Username, cred.Domain)
+}
+
+func (b *Browser) remove(cred kc.Credential) {
+	entries := b.Entries[:0]
+	for _, entry := range b.Entries {
+		if entry.Domain != cred.Domain || entry.Username != cred.Username {
+			entries = append(entries, entry)
+		}
+	}
+	b.Entries = entries
+	b.filter()
+}
+
+// filter recomputes the matches for the current query, best first.
+func (b *Browser) filter() {
+	type scored struct {
+		cred  kc.Credential
+		score int
+	}
+	query := string(b.query)
+	found := make([]scored, 0, len(b.Entries))
+	for _, cred := range b.Entries {
+		if score, ok := FuzzyScore(query, cred.Domain+" "+cred.Username); ok {
+			found = append(found, scored{cred, score})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].score != found[j].score {
+			return found[i].score > found[j].score
+		}
+		return found[i].cred.Domain < found[j].cred.Domain
+	})
+
+	b.matches = make([]kc.Credential, len(found))
+	for i, f := range found {
+		b.matches[i] = f.cred
+	}
+	b.cursor = 0
+	b.offset = 0
+}
+
+// FuzzyScore reports whether the characters of pattern appear in text in
+// order, and how good the match is. Consecutive characters and characters at
+// the start of a word score higher.
+func FuzzyScore(pattern, text string) (int, bool) {
+	if pattern == "" {
+		return 0, true
+	}
+	p := []rune(strings.ToLower(pattern))
+	t := []rune(strings.ToLower(text))
+
+	score, pi, last := 0, 0, -1
+	for ti := 0; ti < len(t) && pi < len(p); ti++ {
+		if t[ti] != p[pi] {
+			continue
+		}
+		score++
+		if last == ti-1 {
+			score += 5
+		}
+		if ti == 0 || strings.ContainsRune(" .-_@/:", t[ti-1]) {
+			score += 8
+		}
+		last = ti
+		pi++
+	}
+	if pi < len(p) {
+		return 0, false
+	}
+	// Prefer shorter texts when the match is otherwise equal
+	return score*100 - len(t), true
+}
+
+const (
+	headerLines = 3
+	detailLines = 7
+	footerLines = 1
+)
+
+func (b *Browser) draw(t Terminal) error {
+	width, height := t.Size()
+	listHeight := height - headerLines - detailLines - footerLines
+	if listHeight < 1 {
+		listHeight = 1
+	}
+
+	// Keep the cursor on screen
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+listHeight {
+		b.offset = b.cursor - listHeight + 1
+	}
+
+	lines := make([]string, 0, height)
+	title := "passkc"
+	if b.Title != "" {
+		title += " " + b.Title
+	}
+	lines = append(lines,
+		fmt.Sprintf("%s  (%d/%d)", title, len(b.matches), len(b.Entries)),
+		"> "+string(b.query)+"_",
+		strings.Repeat("─", width))
+
+	for i := b.offset; i < b.offset+listHeight; i++ {
+		if i >= len(b.matches) {
+			lines = append(lines, "")
+			continue
+		}
+		cred := b.matches[i]
+		row := fmt.Sprintf("  %-30s %s", cred.Domain, cred.Username)
+		if i == b.cursor {
+			// Reverse video for the selected row
+			row = "\x1b[7m> " + fit(row[2:], width-2) + "\x1b[0m"
+		}
+		lines = append(lines, row)
+	}
+
+	lines = append(lines, strings.Repeat("─", width))
+	lines = append(lines, b.detailLines()...)
+	for len(lines) < height-footerLines {
+		lines = append(lines, "")
+	}
+
+	footer := b.status
+	if footer == "" {
+		footer = b.help()
+	}
+	lines = append(lines, footer)
+
+	var out strings.Builder
+	out.WriteString("\x1b[H\x1b[2J")
+	for i, line := range lines {
+		if i >= height {
+			break
+		}
+		if !strings.HasPrefix(line, "\x1b[7m") {
+			line = fit(line, width)
+		}
+		out.WriteString(line)
+		if i < len(lines)-1 && i < height-1 {
+			out.WriteString("\r\n")
+		}
+	}
+	_, err := io.WriteString(t, out.String())
+	return err
+}
+
+func (b *Browser) detailLines() []string {
+	cred := b.selected()
+	if cred == nil {
+		return []string{"No matching credentials"}
+	}
+
+	// Only what the list already holds, unless the user reveals the
+	// entry: loading the rest may ask to unlock the keychain
+	lines := []string{
+		"Domain:   " + cred.Domain,
+		"Username: " + cred.Username,
+	}
+	if !b.revealed {
+		lines = append(lines, "Password: ••••••••")
+	} else if full, err := b.detail(*cred); err != nil {
+		lines = append(lines, "Error: "+err.Error())
+	} else {
+		lines = append(lines, "Password: "+full.Password.Reveal())
+		if len(full.Fields) > 0 {
+			names := make([]string, 0, len(full.Fields))
+			for name := range full.Fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			lines = append(lines, "Fields:   "+strings.Join(names, ", "))
+		}
+	}
+	if len(cred.Tags) > 0 {
+		lines = append(lines, "Tags:     "+strings.Join(cred.Tags, ", "))
+	}
+	return lines
+}
+
+func (b *Browser) help() string {
+	keys := []string{"↑/↓ move", "Enter select"}
+	if b.Copy != nil {
+		keys = append(keys, "^Y copy")
+	}
+	keys = append(keys, "^R reveal")
+	if b.AllowEdit {
+		keys = append(keys, "^E edit")
+	}
+	if b.Delete != nil {
+		keys = append(keys, "^D delete")
+	}
+	return strings.Join(append(keys, "Esc quit"), " · ")
+}
+
+// fit truncates s to width runes.
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	return string(r[:width])
+}
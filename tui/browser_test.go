@@ -0,0 +1,177 @@
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/e6a5/passkc/kc"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTerminal replays scripted keys and records every frame drawn.
+type fakeTerminal struct {
+	keys   []Key
+	frames []string
+}
+
+func (f *fakeTerminal) Write(p []byte) (int, error) {
+	f.frames = append(f.frames, string(p))
+	return len(p), nil
+}
+
+func (f *fakeTerminal) ReadKey() (Key, error) {
+	if len(f.keys) == 0 {
+		return Key{}, io.EOF
+	}
+	key := f.keys[0]
+	f.keys = f.keys[1:]
+	return key, nil
+}
+
+func (f *fakeTerminal) Size() (int, int) {
+	return 80, 20
+}
+
+func (f *fakeTerminal) lastFrame() string {
+	return f.frames[len(f.frames)-1]
+}
+
+func typed(s string) []Key {
+	keys := make([]Key, 0, len(s))
+	for _, r := range s {
+		keys = append(keys, Key{Code: KeyRune, Rune: r})
+	}
+	return keys
+}
+
+func testEntries() []kc.Credential {
+	return []kc.Credential{
+		{Domain: "github.com", Username: "octocat"},
+		{Domain: "gitlab.com", Username: "tanuki"},
+		{Domain: "google.com", Username: "someone"},
+	}
+}
+
+func loadWithPassword(cred kc.Credential) (*kc.Credential, error) {
+	cred.Password = kc.NewSecretString("secret-" + cred.Domain)
+	cred.Fields = map[string]string{"otp": "x"}
+	return &cred, nil
+}
+
+func TestBrowserFuzzySelect(t *testing.T) {
+	term := &fakeTerminal{keys: append(typed("glab"), Key{Code: KeyEnter})}
+	b := &Browser{Entries: testEntries(), Load: loadWithPassword}
+
+	action, cred, err := b.Run(term)
+	assert.NoError(t, err)
+	assert.Equal(t, ActionSelect, action)
+	assert.Equal(t, "gitlab.com", cred.Domain)
+	assert.Contains(t, term.lastFrame(), "(1/3)")
+}
+
+func TestBrowserRevealIsTemporary(t *testing.T) {
+	term := &fakeTerminal{keys: []Key{{Code: KeyDown}, {Code: KeyCtrlR}}}
+	b := &Browser{Entries: testEntries(), Load: loadWithPassword}
+
+	_, _, err := b.Run(term)
+	assert.NoError(t, err)
+	assert.NotContains(t, term.frames[1], "secret-")
+	assert.NotContains(t, term.frames[1], "Fields:")
+	assert.Contains(t, term.frames[2], "Password: secret-gitlab.com")
+	assert.Contains(t, term.frames[2], "Fields:   otp")
+
+	b.handle(Key{Code: KeyDown})
+	assert.False(t, b.revealed)
+}
+
+func TestBrowserLoadsOnDemand(t *testing.T) {
+	loads := make([]string, 0)
+	var secrets []kc.Secret
+	term := &fakeTerminal{keys: []Key{
+		{Code: KeyDown}, {Code: KeyUp}, {Code: KeyCtrlR},
+		{Code: KeyDown}, {Code: KeyCtrlR}, {Code: KeyCtrlR}, {Code: KeyCtrlR},
+		{Code: KeyCtrlY},
+	}}
+	b := &Browser{
+		Entries: testEntries(),
+		Load: func(cred kc.Credential) (*kc.Credential, error) {
+			loads = append(loads, cred.Domain)
+			if cred.Domain == "gitlab.com" {
+				return nil, errors.New("keychain is locked")
+			}
+			full, err := loadWithPassword(cred)
+			secrets = append(secrets, full.Password)
+			return full, err
+		},
+		Copy: func(kc.Secret) error { return nil },
+	}
+
+	_, _, err := b.Run(term)
+	assert.NoError(t, err)
+	// Moving loads nothing, a failure is not retried, and what was loaded
+	// is destroyed when the browser returns
+	assert.Equal(t, []string{"github.com", "gitlab.com"}, loads)
+	assert.Contains(t, term.frames[7], "Error: keychain is locked")
+	assert.Len(t, secrets, 1)
+	assert.True(t, secrets[0].IsEmpty())
+}
+
+func TestBrowserActions(t *testing.T) {
+	var copied string
+	var deleted []string
+	term := &fakeTerminal{keys: []Key{
+		{Code: KeyCtrlY},
+		{Code: KeyCtrlD}, {Code: KeyRune, Rune: 'n'},
+		{Code: KeyCtrlD}, {Code: KeyRune, Rune: 'y'},
+		{Code: KeyCtrlE},
+	}}
+	b := &Browser{
+		Entries: append(testEntries(), kc.Credential{Domain: "github.com", Username: "hubot"}),
+		Load:    loadWithPassword,
+		Copy: func(password kc.Secret) error {
+			copied = password.Reveal()
+			return nil
+		},
+		Delete: func(cred kc.Credential) error {
+			deleted = append(deleted, cred.Username+"@"+cred.Domain)
+			return nil
+		},
+		AllowEdit: true,
+	}
+
+	action, cred, err := b.Run(term)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret-github.com", copied)
+	assert.Equal(t, []string{"octocat@github.com"}, deleted)
+	assert.Equal(t, ActionEdit, action)
+	// Only the deleted account is gone, not the whole domain
+	assert.Equal(t, "hubot@github.com", cred.Username+"@"+cred.Domain)
+	assert.Len(t, b.Entries, 3)
+}
+
+func TestFuzzyScore(t *testing.T) {
+	_, ok := FuzzyScore("gthb", "github.com")
+	assert.True(t, ok)
+	_, ok = FuzzyScore("hubgit", "github.com")
+	assert.False(t, ok)
+
+	prefix, _ := FuzzyScore("git", "github.com")
+	scattered, _ := FuzzyScore("git", "digit.io")
+	assert.Greater(t, prefix, scattered)
+}
+
+func TestReadKey(t *testing.T) {
+	in := bufio.NewReader(strings.NewReader("a\x1b[B\r\x7f\x12"))
+	var codes []KeyCode
+	for {
+		key, err := readKey(in)
+		if err != nil {
+			break
+		}
+		codes = append(codes, key.Code)
+	}
+	assert.Equal(t, []KeyCode{KeyRune, KeyDown, KeyEnter, KeyBackspace, KeyCtrlR}, codes)
+}
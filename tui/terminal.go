@@ -0,0 +1,188 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// KeyCode identifies a key press. Printable characters use KeyRune.
+type KeyCode int
+
+const (
+	KeyUnknown KeyCode = iota
+	KeyRune
+	KeyEnter
+	KeyEscape
+	KeyBackspace
+	KeyUp
+	KeyDown
+	KeyCtrlC
+	KeyCtrlD
+	KeyCtrlE
+	KeyCtrlN
+	KeyCtrlP
+	KeyCtrlR
+	KeyCtrlU
+	KeyCtrlY
+)
+
+// Key is a single key press read from the terminal.
+type Key struct {
+	Code KeyCode
+	Rune rune
+}
+
+// Terminal is the screen and keyboard the browser draws on. TTY is the real
+// implementation; tests drive the browser with a scripted fake.
+type Terminal interface {
+	io.Writer
+	ReadKey() (Key, error)
+	Size() (width, height int)
+}
+
+// ErrNoTerminal is returned by OpenTTY when the process has no controlling
+// terminal, for example in a pipeline or under cron.
+var ErrNoTerminal = errors.New("no terminal available")
+
+// TTY is a Terminal on the controlling terminal, in raw mode on the
+// alternate screen so the user's scrollback is left untouched.
+type TTY struct {
+	file  *os.File
+	state *term.State
+	in    *bufio.Reader
+}
+
+// OpenTTY switches the controlling terminal into full-screen mode. Close
+// must be called to restore it.
+func OpenTTY() (*TTY, error) {
+	file, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoTerminal, err)
+	}
+	state, err := term.MakeRaw(int(file.Fd()))
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("cannot set up terminal: %v", err)
+	}
+
+	t := &TTY{file: file, state: state, in: bufio.NewReader(file)}
+	// Alternate screen, hidden cursor
+	if _, err := t.Write([]byte("\x1b[?1049h\x1b[?25l")); err != nil {
+		_ = t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Close leaves the alternate screen and restores the terminal mode.
+func (t *TTY) Close() error {
+	_, _ = t.Write([]byte("\x1b[?25h\x1b[?1049l"))
+	restoreErr := term.Restore(int(t.file.Fd()), t.state)
+	if err := t.file.Close(); err != nil {
+		return err
+	}
+	return restoreErr
+}
+
+func (t *TTY) Write(p []byte) (int, error) {
+	return t.file.Write(p)
+}
+
+// Size returns the terminal size, or 80x24 if it cannot be determined.
+func (t *TTY) Size() (int, int) {
+	width, height, err := term.GetSize(int(t.file.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+func (t *TTY) ReadKey() (Key, error) {
+	return readKey(t.in)
+}
+
+// readKey decodes one key press from raw terminal input.
+func readKey(in *bufio.Reader) (Key, error) {
+	r, _, err := in.ReadRune()
+	if err != nil {
+		return Key{}, err
+	}
+
+	switch r {
+	case '\r', '\n':
+		return Key{Code: KeyEnter}, nil
+	case 0x7f, 0x08:
+		return Key{Code: KeyBackspace}, nil
+	case 0x03:
+		return Key{Code: KeyCtrlC}, nil
+	case 0x04:
+		return Key{Code: KeyCtrlD}, nil
+	case 0x05:
+		return Key{Code: KeyCtrlE}, nil
+	case 0x0e:
+		return Key{Code: KeyCtrlN}, nil
+	case 0x10:
+		return Key{Code: KeyCtrlP}, nil
+	case 0x12:
+		return Key{Code: KeyCtrlR}, nil
+	case 0x15:
+		return Key{Code: KeyCtrlU}, nil
+	case 0x19:
+		return Key{Code: KeyCtrlY}, nil
+	case 0x1b:
+		// A lone escape is the Esc key; arrow keys arrive as one burst
+		if in.Buffered() == 0 {
+			return Key{Code: KeyEscape}, nil
+		}
+		next, _ := in.ReadByte()
+		if next != '[' && next != 'O' {
+			return Key{Code: KeyEscape}, nil
+		}
+		final, _ := in.ReadByte()
+		switch final {
+		case 'A':
+			return Key{Code: KeyUp}, nil
+		case 'B':
+			return Key{Code: KeyDown}, nil
+		}
+		// Drain the rest of longer sequences such as ESC [ 3 ~
+		for final >= '0' && final <= '9' || final == ';' {
+			if final, err = in.ReadByte(); err != nil {
+				break
+			}
+		}
+		return Key{Code: KeyUnknown}, nil
+	}
+
+	if r == utf8.RuneError || r < 0x20 {
+		return Key{Code: KeyUnknown}, nil
+	}
+	return Key{Code: KeyRune, Rune: r}, nil
+}
@@ -0,0 +1,517 @@
+/*
+Copyright © 2023 Hiep Tran <tranhiepqna@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/e6a5/passkc/kc"
+	"gopkg.in/yaml.v3"
+)
+
+// indexFile lists the members and entries of a vault. It holds only public
+// data so that it can be reviewed in git.
+const indexFile = "vault.yaml"
+
+// Member is a person who can decrypt entries shared with their groups.
+type Member struct {
+	Name string `yaml:"name"`
+	// Recipient is the member's age X25519 public key.
+	Recipient string   `yaml:"recipient"`
+	Groups    []string `yaml:"groups,omitempty"`
+}
+
+// Entry describes one encrypted credential.
+type Entry struct {
+	Domain   string `yaml:"domain"`
+	Username string `yaml:"username"`
+	// Groups lists who may decrypt the entry. An entry without groups is
+	// shared with every member.
+	Groups []string `yaml:"groups,omitempty"`
+}
+
+// Vault is a directory of age-encrypted credentials, each encrypted to the
+// members allowed to read it.
+type Vault struct {
+	Dir     string   `yaml:"-"`
+	Members []Member `yaml:"members"`
+	// Recovery is an age recipient every entry is also encrypted to. Its
+	// identity is not stored anywhere; it is split into recovery shares.
+	Recovery string  `yaml:"recovery,omitempty"`
+	Entries  []Entry `yaml:"entries"`
+
+	// entriesDir overrides where ciphertexts live, for staging a rekey.
+	entriesDir string
+}
+
+// Init creates an empty vault in dir with one member.
+func Init(dir string, owner Member) (*Vault, error) {
+	if _, err := os.Stat(filepath.Join(dir, indexFile)); err == nil {
+		return nil, fmt.Errorf("'%s' already contains a vault", dir)
+	}
+	if _, err := age.ParseX25519Recipient(owner.Recipient); err != nil {
+		return nil, fmt.Errorf("invalid recipient for '%s': %v", owner.Name, err)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("cannot create vault directory: %v", err)
+	}
+
+	v := &Vault{Dir: dir, Members: []Member{owner}}
+	return v, v.Save()
+}
+
+// Exists reports whether dir holds a vault.
+func Exists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, indexFile))
+	return err == nil
+}
+
+// Open reads the vault in dir.
+func Open(dir string) (*Vault, error) {
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no vault in '%s'. Use 'passkc team init' to create one", dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read vault: %v", err)
+	}
+
+	v := &Vault{}
+	if err := yaml.Unmarshal(data, v); err != nil {
+		return nil, fmt.Errorf("invalid vault index '%s': %v", filepath.Join(dir, indexFile), err)
+	}
+	v.Dir = dir
+	return v, nil
+}
+
+// Save writes the vault index.
+func (v *Vault) Save() error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(v.Dir, indexFile), data, 0o600)
+}
+
+// Member returns the member with the given name.
+func (v *Vault) Member(name string) (*Member, bool) {
+	for i := range v.Members {
+		if v.Members[i].Name == name {
+			return &v.Members[i], true
+		}
+	}
+	return nil, false
+}
+
+// Find returns the entry for domain and, if given, username.
+func (v *Vault) Find(domain, username string) (*Entry, bool) {
+	for i := range v.Entries {
+		e := &v.Entries[i]
+		if e.Domain == domain && (username == "" || e.Username == username) {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// CanRead reports whether a member is allowed to decrypt an entry.
+func (e *Entry) CanRead(m *Member) bool {
+	if len(e.Groups) == 0 {
+		return true
+	}
+	for _, g := range e.Groups {
+		if slices.Contains(m.Groups, g) {
+			return true
+		}
+	}
+	return false
+}
+
+// Readers returns the members allowed to decrypt an entry.
+func (v *Vault) Readers(e *Entry) []Member {
+	readers := make([]Member, 0)
+	for i := range v.Members {
+		if e.CanRead(&v.Members[i]) {
+			readers = append(readers, v.Members[i])
+		}
+	}
+	return readers
+}
+
+func (v *Vault) recipients(e *Entry) ([]age.Recipient, error) {
+	readers := v.Readers(e)
+	if len(readers) == 0 {
+		return nil, fmt.Errorf("no member can read '%s@%s': add a member to one of its groups (%s)",
+			e.Username, e.Domain, strings.Join(e.Groups, ", "))
+	}
+	recipients := make([]age.Recipient, 0, len(readers))
+	for _, m := range readers {
+		r, err := age.ParseX25519Recipient(m.Recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient for '%s': %v", m.Name, err)
+		}
+		recipients = append(recipients, r)
+	}
+	if v.Recovery != "" {
+		r, err := age.ParseX25519Recipient(v.Recovery)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recovery recipient: %v", err)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// entryPath returns where an entry's ciphertext is stored.
+func (v *Vault) entryPath(e *Entry) string {
+	dir := v.entriesDir
+	if dir == "" {
+		dir = filepath.Join(v.Dir, "entries")
+	}
+	return filepath.Join(dir, url.PathEscape(e.Domain), url.PathEscape(e.Username)+".age")
+}
+
+// Put encrypts a credential to the members of groups and records it in the
+// index, replacing any entry for the same domain and username.
+func (v *Vault) Put(cred *kc.Credential, groups []string) error {
+	entry, ok := v.Find(cred.Domain, cred.Username)
+	if !ok {
+		v.Entries = append(v.Entries, Entry{Domain: cred.Domain, Username: cred.Username})
+		entry = &v.Entries[len(v.Entries)-1]
+	}
+	entry.Groups = groups
+
+	if err := v.write(entry, cred); err != nil {
+		return err
+	}
+	return v.Save()
+}
+
+func (v *Vault) write(e *Entry, cred *kc.Credential) error {
+	ciphertext, err := v.seal(e, cred)
+	if err != nil {
+		return err
+	}
+	return v.store(e, ciphertext)
+}
+
+// seal encrypts a credential to the current readers of e.
+func (v *Vault) seal(e *Entry, cred *kc.Credential) ([]byte, error) {
+	recipients, err := v.recipients(e)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(cred.Reveal())
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// store writes an entry's ciphertext.
+func (v *Vault) store(e *Entry, ciphertext []byte) error {
+	path := v.entryPath(e)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("cannot create vault directory: %v", err)
+	}
+	return os.WriteFile(path, ciphertext, 0o600)
+}
+
+// Get decrypts an entry with the caller's identity.
+func (v *Vault) Get(e *Entry, identity age.Identity) (*kc.Credential, error) {
+	f, err := os.Open(v.entryPath(e))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read vault entry '%s@%s': %v", e.Username, e.Domain, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	r, err := age.Decrypt(armor.NewReader(f), identity)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, fmt.Errorf("you are not allowed to read '%s@%s'", e.Username, e.Domain)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt '%s@%s': %v", e.Username, e.Domain, err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt '%s@%s': %v", e.Username, e.Domain, err)
+	}
+
+	cred := &kc.Credential{}
+	if err := json.Unmarshal(plaintext, cred); err != nil {
+		return nil, fmt.Errorf("vault entry '%s@%s' is corrupt: %v", e.Username, e.Domain, err)
+	}
+	return cred, nil
+}
+
+// Remove deletes an entry.
+func (v *Vault) Remove(e *Entry) error {
+	if err := os.Remove(v.entryPath(e)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("cannot remove vault entry: %v", err)
+	}
+	v.Entries = slices.DeleteFunc(v.Entries, func(x Entry) bool {
+		return x.Domain == e.Domain && x.Username == e.Username
+	})
+	return v.Save()
+}
+
+// SetMember adds a member, or updates the recipient and groups of an
+// existing one, and re-encrypts the entries this changes.
+func (v *Vault) SetMember(m Member, identity age.Identity) ([]Entry, error) {
+	if _, err := age.ParseX25519Recipient(m.Recipient); err != nil {
+		return nil, fmt.Errorf("invalid recipient for '%s': %v", m.Name, err)
+	}
+	before, members := v.readerSets(), slices.Clone(v.Members)
+	if existing, ok := v.Member(m.Name); ok {
+		*existing = m
+	} else {
+		v.Members = append(v.Members, m)
+	}
+	skipped, err := v.reencrypt(before, identity)
+	if err != nil {
+		v.Members = members
+	}
+	return skipped, err
+}
+
+// RemoveMember removes a member and re-encrypts every entry they could read
+// so that new copies are unreadable to them. Copies they already have, for
+// example in git history, stay readable: rotate those passwords.
+func (v *Vault) RemoveMember(name string, identity age.Identity) ([]Entry, error) {
+	if _, ok := v.Member(name); !ok {
+		return nil, fmt.Errorf("no member named '%s'", name)
+	}
+	if len(v.Members) == 1 {
+		return nil, fmt.Errorf("cannot remove the last member of a vault")
+	}
+	before, members := v.readerSets(), slices.Clone(v.Members)
+	v.Members = slices.DeleteFunc(slices.Clone(v.Members), func(m Member) bool { return m.Name == name })
+	skipped, err := v.reencrypt(before, identity)
+	if err != nil {
+		v.Members = members
+	}
+	return skipped, err
+}
+
+// SetRecovery sets the recovery recipient and re-encrypts every entry the
+// caller can read to include it. Skipped entries cannot be recovered until
+// a member who can read them runs Reencrypt.
+func (v *Vault) SetRecovery(recipient string, identity age.Identity) ([]Entry, error) {
+	if _, err := age.ParseX25519Recipient(recipient); err != nil {
+		return nil, fmt.Errorf("invalid recovery recipient: %v", err)
+	}
+	v.Recovery = recipient
+	return v.Reencrypt(identity)
+}
+
+// readerSets records the recipients of every entry, to find out which ones
+// need re-encrypting after a membership change.
+func (v *Vault) readerSets() []string {
+	sets := make([]string, len(v.Entries))
+	for i := range v.Entries {
+		for _, m := range v.Readers(&v.Entries[i]) {
+			sets[i] += m.Recipient + "\n"
+		}
+	}
+	return sets
+}
+
+// Reencrypt rewrites every entry the caller can read to its current
+// readers. Use it to finish a membership change that skipped entries the
+// member who made it could not read.
+func (v *Vault) Reencrypt(identity age.Identity) ([]Entry, error) {
+	return v.reencrypt(nil, identity)
+}
+
+// reencrypt rewrites the entries whose readers changed since before, or all
+// entries if before is nil. Entries the caller cannot decrypt are skipped
+// and returned so that a member who can read them can run Reencrypt. The
+// index is saved either way.
+//
+// Every entry is encrypted before any is written, so an entry that would
+// be left without readers fails the change without touching the vault.
+func (v *Vault) reencrypt(before []string, identity age.Identity) ([]Entry, error) {
+	after := v.readerSets()
+	for i := range v.Entries {
+		if before != nil && before[i] == after[i] {
+			continue
+		}
+		if _, err := v.recipients(&v.Entries[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	skipped := make([]Entry, 0)
+	sealed := make(map[int][]byte)
+	for i := range v.Entries {
+		if before != nil && before[i] == after[i] {
+			continue
+		}
+		e := &v.Entries[i]
+		cred, err := v.Get(e, identity)
+		if err != nil {
+			skipped = append(skipped, *e)
+			continue
+		}
+		if sealed[i], err = v.seal(e, cred); err != nil {
+			return nil, err
+		}
+	}
+	for i, ciphertext := range sealed {
+		if err := v.store(&v.Entries[i], ciphertext); err != nil {
+			return skipped, err
+		}
+	}
+	return skipped, v.Save()
+}
+
+// Rekey replaces the key of the member holding oldIdentity with newIdentity.
+// Every entry is written to a staging directory first and checked to be
+// readable with the new key; only then are the entries swapped in. The old
+// entries are kept in entries.bak if keepBackup is set.
+func (v *Vault) Rekey(oldIdentity, newIdentity *age.X25519Identity, keepBackup bool) error {
+	var member *Member
+	for i := range v.Members {
+		if v.Members[i].Recipient == oldIdentity.Recipient().String() {
+			member = &v.Members[i]
+		}
+	}
+	if member == nil {
+		return fmt.Errorf("your key is not a member of this vault")
+	}
+
+	// Decrypt first so that nothing changes if an entry is unreadable
+	creds := make([]*kc.Credential, len(v.Entries))
+	for i := range v.Entries {
+		if !v.Entries[i].CanRead(member) {
+			continue
+		}
+		cred, err := v.Get(&v.Entries[i], oldIdentity)
+		if err != nil {
+			return err
+		}
+		creds[i] = cred
+	}
+
+	staging := filepath.Join(v.Dir, ".rekey")
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+	staged := *v
+	staged.entriesDir = staging
+	staged.Members = slices.Clone(v.Members)
+	for i := range staged.Members {
+		if staged.Members[i].Name == member.Name {
+			staged.Members[i].Recipient = newIdentity.Recipient().String()
+		}
+	}
+
+	for i := range v.Entries {
+		e := &v.Entries[i]
+		if creds[i] == nil {
+			// Not ours to read: carry the ciphertext over unchanged
+			if err := copyFile(v.entryPath(e), staged.entryPath(e)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := staged.write(e, creds[i]); err != nil {
+			return err
+		}
+		got, err := staged.Get(e, newIdentity)
+		if err != nil {
+			return fmt.Errorf("re-encrypted '%s@%s' is not readable with the new key: %v", e.Username, e.Domain, err)
+		}
+		if !reflect.DeepEqual(got, creds[i]) {
+			return fmt.Errorf("re-encrypted '%s@%s' does not match the original", e.Username, e.Domain)
+		}
+	}
+
+	// Swap the staged entries in
+	entries := filepath.Join(v.Dir, "entries")
+	backup := filepath.Join(v.Dir, "entries.bak")
+	if err := os.RemoveAll(backup); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(entries, 0o750); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(staging, 0o750); err != nil {
+		return err
+	}
+	if err := os.Rename(entries, backup); err != nil {
+		return fmt.Errorf("cannot move old entries aside: %v", err)
+	}
+	if err := os.Rename(staging, entries); err != nil {
+		_ = os.Rename(backup, entries)
+		return fmt.Errorf("cannot move new entries in: %v", err)
+	}
+	member.Recipient = newIdentity.Recipient().String()
+	if err := v.Save(); err != nil {
+		return err
+	}
+
+	if !keepBackup {
+		return os.RemoveAll(backup)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0o600)
+}
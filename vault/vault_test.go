@@ -0,0 +1,190 @@
+package vault
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/e6a5/passkc/kc"
+	"github.com/stretchr/testify/assert"
+)
+
+func newIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	return id
+}
+
+func TestVaultGroups(t *testing.T) {
+	alice, bob := newIdentity(t), newIdentity(t)
+	dir := t.TempDir()
+
+	v, err := Init(dir, Member{Name: "alice", Recipient: alice.Recipient().String(), Groups: []string{"oncall", "admin"}})
+	assert.NoError(t, err)
+	_, err = Init(dir, Member{Name: "alice", Recipient: alice.Recipient().String()})
+	assert.Error(t, err)
+
+	skipped, err := v.SetMember(Member{Name: "bob", Recipient: bob.Recipient().String(), Groups: []string{"oncall"}}, alice)
+	assert.NoError(t, err)
+	assert.Empty(t, skipped)
+
+	db := &kc.Credential{Domain: "db.prod", Username: "admin", Password: kc.NewSecretString("db-secret"), Fields: map[string]string{"port": "5432"}}
+	root := &kc.Credential{Domain: "aws.prod", Username: "root", Password: kc.NewSecretString("root-secret")}
+	assert.NoError(t, v.Put(db, []string{"oncall"}))
+	assert.NoError(t, v.Put(root, []string{"admin"}))
+
+	// The index round-trips through disk
+	v, err = Open(dir)
+	assert.NoError(t, err)
+	assert.Len(t, v.Entries, 2)
+
+	entry, ok := v.Find("db.prod", "")
+	assert.True(t, ok)
+	cred, err := v.Get(entry, bob)
+	assert.NoError(t, err)
+	assert.Equal(t, db, cred)
+
+	entry, _ = v.Find("aws.prod", "root")
+	_, err = v.Get(entry, bob)
+	assert.ErrorContains(t, err, "not allowed")
+	cred, err = v.Get(entry, alice)
+	assert.NoError(t, err)
+	assert.Equal(t, "root-secret", cred.Password.Reveal())
+}
+
+func TestVaultRemoveMember(t *testing.T) {
+	alice, bob := newIdentity(t), newIdentity(t)
+	v, err := Init(t.TempDir(), Member{Name: "alice", Recipient: alice.Recipient().String()})
+	assert.NoError(t, err)
+	_, err = v.SetMember(Member{Name: "bob", Recipient: bob.Recipient().String()}, alice)
+	assert.NoError(t, err)
+
+	assert.NoError(t, v.Put(&kc.Credential{Domain: "db.prod", Username: "admin", Password: kc.NewSecretString("secret")}, nil))
+	entry, _ := v.Find("db.prod", "admin")
+	_, err = v.Get(entry, bob)
+	assert.NoError(t, err)
+
+	// Removing bob re-encrypts so that he can no longer read the entry
+	skipped, err := v.RemoveMember("bob", alice)
+	assert.NoError(t, err)
+	assert.Empty(t, skipped)
+	_, err = v.Get(entry, bob)
+	assert.ErrorContains(t, err, "not allowed")
+	_, err = v.Get(entry, alice)
+	assert.NoError(t, err)
+
+	_, err = v.RemoveMember("alice", alice)
+	assert.ErrorContains(t, err, "last member")
+	_, err = v.RemoveMember("carol", alice)
+	assert.Error(t, err)
+}
+
+func TestVaultRemoveMemberLeavingNoReaders(t *testing.T) {
+	alice, bob := newIdentity(t), newIdentity(t)
+	dir := t.TempDir()
+	v, err := Init(dir, Member{Name: "alice", Recipient: alice.Recipient().String()})
+	assert.NoError(t, err)
+	_, err = v.SetMember(Member{Name: "bob", Recipient: bob.Recipient().String(), Groups: []string{"oncall"}}, alice)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Put(&kc.Credential{Domain: "shared", Username: "app", Password: kc.NewSecretString("a")}, nil))
+	assert.NoError(t, v.Put(&kc.Credential{Domain: "pager", Username: "bob", Password: kc.NewSecretString("b")}, []string{"oncall"}))
+
+	// Only bob can read the pager entry, so removing him fails before
+	// anything is rewritten
+	_, err = v.RemoveMember("bob", bob)
+	assert.ErrorContains(t, err, "no member can read 'bob@pager'")
+	_, ok := v.Member("bob")
+	assert.True(t, ok)
+	shared, _ := v.Find("shared", "app")
+	_, err = v.Get(shared, bob)
+	assert.NoError(t, err)
+	reopened, err := Open(dir)
+	assert.NoError(t, err)
+	assert.Len(t, reopened.Members, 2)
+}
+
+func TestVaultSkipsUnreadableEntries(t *testing.T) {
+	alice, bob, carol := newIdentity(t), newIdentity(t), newIdentity(t)
+	v, err := Init(t.TempDir(), Member{Name: "alice", Recipient: alice.Recipient().String(), Groups: []string{"admin"}})
+	assert.NoError(t, err)
+	_, err = v.SetMember(Member{Name: "bob", Recipient: bob.Recipient().String(), Groups: []string{"oncall"}}, alice)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Put(&kc.Credential{Domain: "aws.prod", Username: "root", Password: kc.NewSecretString("secret")}, []string{"admin"}))
+
+	// Bob cannot read the admin entry, so adding carol to admin skips it
+	skipped, err := v.SetMember(Member{Name: "carol", Recipient: carol.Recipient().String(), Groups: []string{"admin"}}, bob)
+	assert.NoError(t, err)
+	assert.Len(t, skipped, 1)
+
+	// Until alice re-encrypts it
+	skipped, err = v.Reencrypt(alice)
+	assert.NoError(t, err)
+	assert.Empty(t, skipped)
+	entry, _ := v.Find("aws.prod", "root")
+	_, err = v.Get(entry, carol)
+	assert.NoError(t, err)
+}
+
+func TestVaultRecovery(t *testing.T) {
+	alice, recovery, bob := newIdentity(t), newIdentity(t), newIdentity(t)
+	v, err := Init(t.TempDir(), Member{Name: "alice", Recipient: alice.Recipient().String()})
+	assert.NoError(t, err)
+	assert.NoError(t, v.Put(&kc.Credential{Domain: "db.prod", Username: "admin", Password: kc.NewSecretString("secret")}, nil))
+
+	skipped, err := v.SetRecovery(recovery.Recipient().String(), alice)
+	assert.NoError(t, err)
+	assert.Empty(t, skipped)
+
+	// Alice leaves: bob is added but cannot re-encrypt, the recovery key can
+	_, err = v.SetMember(Member{Name: "bob", Recipient: bob.Recipient().String()}, bob)
+	assert.NoError(t, err)
+	_, err = v.RemoveMember("alice", bob)
+	assert.NoError(t, err)
+	entry, _ := v.Find("db.prod", "admin")
+	_, err = v.Get(entry, bob)
+	assert.Error(t, err)
+
+	skipped, err = v.Reencrypt(recovery)
+	assert.NoError(t, err)
+	assert.Empty(t, skipped)
+	cred, err := v.Get(entry, bob)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", cred.Password.Reveal())
+}
+
+func TestVaultRekey(t *testing.T) {
+	alice, bob, newAlice := newIdentity(t), newIdentity(t), newIdentity(t)
+	v, err := Init(t.TempDir(), Member{Name: "alice", Recipient: alice.Recipient().String(), Groups: []string{"admin"}})
+	assert.NoError(t, err)
+	_, err = v.SetMember(Member{Name: "bob", Recipient: bob.Recipient().String(), Groups: []string{"dev"}}, alice)
+	assert.NoError(t, err)
+	assert.NoError(t, v.Put(&kc.Credential{Domain: "aws.prod", Username: "root", Password: kc.NewSecretString("admin-secret")}, []string{"admin"}))
+	assert.NoError(t, v.Put(&kc.Credential{Domain: "ci.dev", Username: "bot", Password: kc.NewSecretString("dev-secret")}, []string{"dev"}))
+
+	assert.Error(t, v.Rekey(newIdentity(t), newAlice, false))
+	assert.NoError(t, v.Rekey(alice, newAlice, true))
+
+	v, err = Open(v.Dir)
+	assert.NoError(t, err)
+	member, _ := v.Member("alice")
+	assert.Equal(t, newAlice.Recipient().String(), member.Recipient)
+
+	admin, _ := v.Find("aws.prod", "root")
+	_, err = v.Get(admin, alice)
+	assert.Error(t, err)
+	cred, err := v.Get(admin, newAlice)
+	assert.NoError(t, err)
+	assert.Equal(t, "admin-secret", cred.Password.Reveal())
+
+	// Entries alice could not read are carried over untouched
+	dev, _ := v.Find("ci.dev", "bot")
+	cred, err = v.Get(dev, bob)
+	assert.NoError(t, err)
+	assert.Equal(t, "dev-secret", cred.Password.Reveal())
+
+	assert.DirExists(t, filepath.Join(v.Dir, "entries.bak"))
+	_, err = os.Stat(filepath.Join(v.Dir, ".rekey"))
+	assert.True(t, os.IsNotExist(err))
+}